@@ -9,8 +9,11 @@ import (
 	"github.com/odysseia-greek/agora/plato/service"
 	pb "github.com/odysseia-greek/delphi/aristides/proto"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"os"
+	"strings"
 )
 
 // GetSecret creates a 1 time token and returns the secret from vault
@@ -33,8 +36,8 @@ func (a *AmbassadorServiceImpl) GetSecret(ctx context.Context, request *pb.Vault
 	}
 	logging.Debug(fmt.Sprintf("setting token: %s", generatedToken))
 	a.Vault.SetOnetimeToken(generatedToken)
-	logging.Debug(fmt.Sprintf("gathering secret: %s", a.PodName))
-	secret, err := a.Vault.GetSecret(a.PodName)
+	logging.Debug(fmt.Sprintf("gathering secret: %s", a.secretPath(a.PodName)))
+	secret, err := a.Vault.GetSecret(a.secretPath(a.PodName))
 	if err != nil {
 		return nil, err
 	}
@@ -56,6 +59,10 @@ func (a *AmbassadorServiceImpl) GetSecret(ctx context.Context, request *pb.Vault
 		}
 	}
 
+	if expiresAt, ok := LeaseExpiry(&elasticModel); ok {
+		logging.Debug(fmt.Sprintf("credentials for %s expire at %s", elasticModel.ElasticUsername, expiresAt))
+	}
+
 	responseMd := metadata.New(map[string]string{service.HeaderKey: traceID})
 	grpc.SendHeader(ctx, responseMd)
 
@@ -85,8 +92,8 @@ func (a *AmbassadorServiceImpl) GetNamedSecret(ctx context.Context, request *pb.
 
 	a.Vault.SetOnetimeToken(oneTimeToken)
 
-	logging.Debug(fmt.Sprintf("gathering secret: %s", request.PodName))
-	secret, err := a.Vault.GetSecret(request.PodName)
+	logging.Debug(fmt.Sprintf("gathering secret: %s", a.secretPath(request.PodName)))
+	secret, err := a.Vault.GetSecret(a.secretPath(request.PodName))
 	if err != nil {
 		return nil, err
 	}
@@ -108,6 +115,10 @@ func (a *AmbassadorServiceImpl) GetNamedSecret(ctx context.Context, request *pb.
 		}
 	}
 
+	if expiresAt, ok := LeaseExpiry(&elasticModel); ok {
+		logging.Debug(fmt.Sprintf("credentials for %s expire at %s", elasticModel.ElasticUsername, expiresAt))
+	}
+
 	responseMd := metadata.New(map[string]string{service.HeaderKey: traceID})
 	grpc.SendHeader(ctx, responseMd)
 
@@ -128,10 +139,31 @@ func (a *AmbassadorServiceImpl) Health(context.Context, *pb.HealthRequest) (*pb.
 	}, nil
 }
 
+// secretPath is where solon stores the secret of a pod, a name without a namespace is looked up in the namespace of this pod
+func (a *AmbassadorServiceImpl) secretPath(podName string) string {
+	if strings.Contains(podName, "/") {
+		return podName
+	}
+
+	return fmt.Sprintf("%s/%s", a.Namespace, podName)
+}
+
 func (a *AmbassadorServiceImpl) getOneTimeToken(traceId string) (string, error) {
 	response, err := a.HttpClients.Solon().OneTimeToken(traceId)
 	if err != nil {
-		return "", err
+		if response == nil {
+			return "", err
+		}
+
+		defer response.Body.Close()
+
+		var solonErr SolonError
+		decodeErr := json.NewDecoder(response.Body).Decode(&solonErr)
+		if decodeErr != nil || solonErr.Code == "" {
+			return "", err
+		}
+
+		return "", status.Error(solonErr.GrpcCode(), solonErr.Error())
 	}
 
 	defer response.Body.Close()
@@ -145,3 +177,37 @@ func (a *AmbassadorServiceImpl) getOneTimeToken(traceId string) (string, error)
 	logging.Debug(fmt.Sprintf("received token: %s", tokenModel.Token))
 	return tokenModel.Token, nil
 }
+
+// SolonError mirrors the error envelope solon returns for every failed request
+type SolonError struct {
+	UniqueCode string `json:"uniqueCode"`
+	Code       string `json:"code"`
+	Field      string `json:"field,omitempty"`
+	Message    string `json:"message"`
+}
+
+func (e *SolonError) Error() string {
+	return fmt.Sprintf("solon returned %s: %s", e.Code, e.Message)
+}
+
+// GrpcCode translates the solon error code so callers of the sidecar can tell a denied request from an outage
+func (e *SolonError) GrpcCode() codes.Code {
+	switch e.Code {
+	case "invalid-request":
+		return codes.InvalidArgument
+	case "unauthenticated":
+		return codes.Unauthenticated
+	case "pod-not-found":
+		return codes.NotFound
+	case "pod-not-serving", "pod-name-mismatch", "annotation-mismatch", "admin-required":
+		return codes.PermissionDenied
+	case "registration-conflict":
+		return codes.AlreadyExists
+	case "rate-limited":
+		return codes.ResourceExhausted
+	case "service-unavailable":
+		return codes.Unavailable
+	default:
+		return codes.Internal
+	}
+}
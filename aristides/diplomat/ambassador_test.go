@@ -7,7 +7,9 @@ import (
 	"github.com/odysseia-greek/agora/plato/service"
 	pb "github.com/odysseia-greek/delphi/aristides/proto"
 	"github.com/stretchr/testify/assert"
+	grpccodes "google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"testing"
 )
 
@@ -71,6 +73,44 @@ func TestGetOneTimeToken(t *testing.T) {
 		assert.NotNil(t, err)
 		assert.Equal(t, "", sut)
 	})
+
+	t.Run("GetWithSolonError", func(t *testing.T) {
+		codes := []int{
+			404,
+		}
+
+		responses := []string{
+			`{"uniqueCode":"abc","code":"pod-not-found","field":"pod","message":"no pod could be found"}`,
+		}
+
+		testClient, err := service.NewFakeClient(config, codes, responses)
+		assert.Nil(t, err)
+
+		handler := AmbassadorServiceImpl{
+			HttpClients: testClient,
+		}
+
+		sut, err := handler.getOneTimeToken(uuid)
+		assert.NotNil(t, err)
+		assert.Equal(t, "", sut)
+		assert.Equal(t, grpccodes.NotFound, status.Code(err))
+	})
+}
+
+func TestSolonErrorCode(t *testing.T) {
+	for code, expected := range map[string]grpccodes.Code{
+		"invalid-request":       grpccodes.InvalidArgument,
+		"unauthenticated":       grpccodes.Unauthenticated,
+		"admin-required":        grpccodes.PermissionDenied,
+		"pod-not-serving":       grpccodes.PermissionDenied,
+		"registration-conflict": grpccodes.AlreadyExists,
+		"rate-limited":          grpccodes.ResourceExhausted,
+		"service-unavailable":   grpccodes.Unavailable,
+		"vault-token-failed":    grpccodes.Internal,
+	} {
+		solonErr := SolonError{Code: code}
+		assert.Equal(t, expected, solonErr.GrpcCode(), code)
+	}
 }
 
 func TestHealthEndpoint(t *testing.T) {
@@ -165,3 +205,15 @@ func TestGetSecrets(t *testing.T) {
 		assert.Equal(t, "", sut.ElasticUsername)
 	})
 }
+
+func TestSecretPath(t *testing.T) {
+	handler := AmbassadorServiceImpl{PodName: "alexandros-api-202", Namespace: "odysseia"}
+
+	t.Run("OwnNamespace", func(t *testing.T) {
+		assert.Equal(t, "odysseia/alexandros-api-202", handler.secretPath(handler.PodName))
+	})
+
+	t.Run("ExplicitNamespace", func(t *testing.T) {
+		assert.Equal(t, "staging/herodotos-api-101", handler.secretPath("staging/herodotos-api-101"))
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/odysseia-greek/agora/diogenes"
 	"github.com/odysseia-greek/agora/plato/config"
 	"github.com/odysseia-greek/agora/plato/logging"
+	"os"
 )
 
 func CreateNewConfig() (*AmbassadorServiceImpl, error) {
@@ -12,6 +13,11 @@ func CreateNewConfig() (*AmbassadorServiceImpl, error) {
 		return nil, err
 	}
 
+	err = withServiceAccountToken(http, config.StringFromEnv(EnvTokenPath, DefaultTokenPath), os.Getenv(EnvCertRoot))
+	if err != nil {
+		return nil, err
+	}
+
 	vault, err := diogenes.CreateVaultClient(true)
 	if err != nil {
 		logging.Error(err.Error())
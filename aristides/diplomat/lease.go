@@ -0,0 +1,76 @@
+package diplomat
+
+import (
+	"context"
+	"fmt"
+	"github.com/odysseia-greek/agora/plato/logging"
+	pb "github.com/odysseia-greek/delphi/aristides/proto"
+	"time"
+)
+
+// refreshRetryInterval is how long WatchSecret waits before asking again when solon has not renewed the lease yet
+// or the secret could not be fetched
+var refreshRetryInterval = 10 * time.Second
+
+// LeaseExpiry returns the moment solon revokes the credentials, ok is false for credentials that do not expire
+func LeaseExpiry(config *pb.ElasticConfigVault) (time.Time, bool) {
+	if config.GetLeaseExpiresAt() == "" {
+		return time.Time{}, false
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339, config.GetLeaseExpiresAt())
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return expiresAt, true
+}
+
+// WatchSecret hands the credentials of the pod to onChange and keeps leased credentials fresh, margin before a lease
+// expires the secret is fetched again and onChange gets the credentials of the next lease. It returns once the
+// credentials are static or the context is done, only a failure to fetch the first credentials is an error
+func WatchSecret(ctx context.Context, ambassador AmbassadorService, margin time.Duration, onChange func(config *pb.ElasticConfigVault)) error {
+	config, err := ambassador.GetSecret(ctx, &pb.VaultRequest{})
+	if err != nil {
+		return fmt.Errorf("failed to fetch credentials: %w", err)
+	}
+
+	onChange(config)
+
+	expiresAt, ok := LeaseExpiry(config)
+	if !ok {
+		return nil
+	}
+
+	wait := time.Until(expiresAt.Add(-margin))
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+
+		wait = refreshRetryInterval
+
+		next, err := ambassador.GetSecret(ctx, &pb.VaultRequest{})
+		if err != nil {
+			logging.Error(fmt.Sprintf("failed to refresh credentials that expire at %s: %s", expiresAt, err.Error()))
+			continue
+		}
+
+		nextExpiresAt, ok := LeaseExpiry(next)
+		if ok && !nextExpiresAt.After(expiresAt) {
+			logging.Debug(fmt.Sprintf("credentials that expire at %s have not been renewed yet", expiresAt))
+			continue
+		}
+
+		onChange(next)
+
+		if !ok {
+			return nil
+		}
+
+		expiresAt = nextExpiresAt
+		wait = time.Until(expiresAt.Add(-margin))
+	}
+}
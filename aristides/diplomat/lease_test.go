@@ -0,0 +1,83 @@
+package diplomat
+
+import (
+	"context"
+	"errors"
+	pb "github.com/odysseia-greek/delphi/aristides/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+)
+
+func TestLease(t *testing.T) {
+	t.Run("LeasedCredentials", func(t *testing.T) {
+		config := &pb.ElasticConfigVault{ElasticUsername: "sokratesabcde_1730548800000000000", LeaseExpiresAt: "2024-11-02T15:00:00Z"}
+
+		expiresAt, ok := LeaseExpiry(config)
+		assert.True(t, ok)
+		assert.Equal(t, time.Date(2024, 11, 2, 15, 0, 0, 0, time.UTC), expiresAt.UTC())
+	})
+
+	t.Run("StaticCredentials", func(t *testing.T) {
+		_, ok := LeaseExpiry(&pb.ElasticConfigVault{ElasticUsername: "sokratesabcde"})
+		assert.False(t, ok)
+	})
+
+	t.Run("NanosecondsFromSolon", func(t *testing.T) {
+		expiresAt, ok := LeaseExpiry(&pb.ElasticConfigVault{LeaseExpiresAt: "2024-11-02T15:00:00.123456789Z"})
+		assert.True(t, ok)
+		assert.Equal(t, 123456789, expiresAt.Nanosecond())
+	})
+}
+
+func TestWatchSecret(t *testing.T) {
+	refreshRetryInterval = time.Millisecond
+	leased := func(username string, expiresAt time.Time) *pb.ElasticConfigVault {
+		return &pb.ElasticConfigVault{ElasticUsername: username, LeaseExpiresAt: expiresAt.Format(time.RFC3339Nano)}
+	}
+
+	t.Run("StaticCredentialsAreHandedOutOnce", func(t *testing.T) {
+		ambassador := new(MockTraceService)
+		ambassador.On("GetSecret", mock.Anything).Return(&pb.ElasticConfigVault{ElasticUsername: "sokratesabcde"}, nil).Once()
+
+		var seen []string
+		err := WatchSecret(context.Background(), ambassador, time.Minute, func(config *pb.ElasticConfigVault) {
+			seen = append(seen, config.ElasticUsername)
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"sokratesabcde"}, seen)
+		ambassador.AssertExpectations(t)
+	})
+
+	t.Run("RefreshesBeforeExpiry", func(t *testing.T) {
+		now := time.Now()
+		ambassador := new(MockTraceService)
+		ambassador.On("GetSecret", mock.Anything).Return(leased("sokratesabcde_1", now.Add(time.Minute)), nil).Once()
+		ambassador.On("GetSecret", mock.Anything).Return((*pb.ElasticConfigVault)(nil), errors.New("connection refused")).Once()
+		ambassador.On("GetSecret", mock.Anything).Return(leased("sokratesabcde_1", now.Add(time.Minute)), nil).Once()
+		ambassador.On("GetSecret", mock.Anything).Return(leased("sokratesabcde_2", now.Add(time.Hour)), nil).Once()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var seen []string
+		err := WatchSecret(ctx, ambassador, time.Minute, func(config *pb.ElasticConfigVault) {
+			seen = append(seen, config.ElasticUsername)
+			if len(seen) == 2 {
+				cancel()
+			}
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"sokratesabcde_1", "sokratesabcde_2"}, seen, "a failed fetch or a lease that was not renewed yet is not handed out")
+		ambassador.AssertExpectations(t)
+	})
+
+	t.Run("FirstFetchFails", func(t *testing.T) {
+		ambassador := new(MockTraceService)
+		ambassador.On("GetSecret", mock.Anything).Return((*pb.ElasticConfigVault)(nil), errors.New("connection refused")).Once()
+
+		err := WatchSecret(context.Background(), ambassador, time.Minute, func(config *pb.ElasticConfigVault) {
+			t.Fatal("no credentials to hand out")
+		})
+		assert.ErrorContains(t, err, "connection refused")
+	})
+}
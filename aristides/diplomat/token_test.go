@@ -0,0 +1,44 @@
+package diplomat
+
+import (
+	"github.com/odysseia-greek/agora/plato/service"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestServiceAccountToken(t *testing.T) {
+	t.Run("SentForAOneTimeToken", func(t *testing.T) {
+		var authorization string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authorization = r.Header.Get("Authorization")
+			w.Write([]byte(`{"token":"s.49uwenfke9fue"}`))
+		}))
+		t.Cleanup(server.Close)
+
+		serverUrl, err := url.Parse(server.URL)
+		assert.Nil(t, err)
+		clients, err := service.NewClient(service.ClientConfig{Solon: service.OdysseiaApi{Url: serverUrl.Host, Scheme: serverUrl.Scheme}})
+		assert.Nil(t, err)
+
+		tokenPath := filepath.Join(t.TempDir(), "token")
+		assert.Nil(t, os.WriteFile(tokenPath, []byte("projected-token"), 0600))
+		err = withServiceAccountToken(clients, tokenPath, "")
+		assert.Nil(t, err)
+
+		handler := AmbassadorServiceImpl{HttpClients: clients}
+		token, err := handler.getOneTimeToken("thisisnotauuid")
+		assert.Nil(t, err)
+		assert.Equal(t, "s.49uwenfke9fue", token)
+		assert.Equal(t, "Bearer projected-token", authorization)
+	})
+
+	t.Run("OnlyThePlatoClient", func(t *testing.T) {
+		err := withServiceAccountToken(&service.Odysseia{}, "", "")
+		assert.NotNil(t, err)
+	})
+}
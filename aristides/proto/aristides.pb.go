@@ -199,6 +199,8 @@ type ElasticConfigVault struct {
 	ElasticUsername string `protobuf:"bytes,1,opt,name=elasticUsername,proto3" json:"elasticUsername,omitempty"`
 	ElasticPassword string `protobuf:"bytes,2,opt,name=elasticPassword,proto3" json:"elasticPassword,omitempty"`
 	ElasticCERT     string `protobuf:"bytes,3,opt,name=ElasticCERT,proto3" json:"ElasticCERT,omitempty"`
+	// RFC 3339 time the credentials are revoked at, empty when they do not expire
+	LeaseExpiresAt string `protobuf:"bytes,4,opt,name=leaseExpiresAt,proto3" json:"leaseExpiresAt,omitempty"`
 }
 
 func (x *ElasticConfigVault) Reset() {
@@ -254,6 +256,13 @@ func (x *ElasticConfigVault) GetElasticCERT() string {
 	return ""
 }
 
+func (x *ElasticConfigVault) GetLeaseExpiresAt() string {
+	if x != nil {
+		return x.LeaseExpiresAt
+	}
+	return ""
+}
+
 type HealthResponse struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -352,7 +361,7 @@ var file_proto_aristides_proto_rawDesc = []byte{
 	0x6c, 0x74, 0x68, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0x25, 0x0a, 0x0f, 0x53, 0x68,
 	0x75, 0x74, 0x44, 0x6f, 0x77, 0x6e, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x12, 0x0a,
 	0x04, 0x63, 0x6f, 0x64, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x63, 0x6f, 0x64,
-	0x65, 0x22, 0x8a, 0x01, 0x0a, 0x12, 0x45, 0x6c, 0x61, 0x73, 0x74, 0x69, 0x63, 0x43, 0x6f, 0x6e,
+	0x65, 0x22, 0xb2, 0x01, 0x0a, 0x12, 0x45, 0x6c, 0x61, 0x73, 0x74, 0x69, 0x63, 0x43, 0x6f, 0x6e,
 	0x66, 0x69, 0x67, 0x56, 0x61, 0x75, 0x6c, 0x74, 0x12, 0x28, 0x0a, 0x0f, 0x65, 0x6c, 0x61, 0x73,
 	0x74, 0x69, 0x63, 0x55, 0x73, 0x65, 0x72, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28,
 	0x09, 0x52, 0x0f, 0x65, 0x6c, 0x61, 0x73, 0x74, 0x69, 0x63, 0x55, 0x73, 0x65, 0x72, 0x6e, 0x61,
@@ -360,37 +369,40 @@ var file_proto_aristides_proto_rawDesc = []byte{
 	0x73, 0x77, 0x6f, 0x72, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0f, 0x65, 0x6c, 0x61,
 	0x73, 0x74, 0x69, 0x63, 0x50, 0x61, 0x73, 0x73, 0x77, 0x6f, 0x72, 0x64, 0x12, 0x20, 0x0a, 0x0b,
 	0x45, 0x6c, 0x61, 0x73, 0x74, 0x69, 0x63, 0x43, 0x45, 0x52, 0x54, 0x18, 0x03, 0x20, 0x01, 0x28,
-	0x09, 0x52, 0x0b, 0x45, 0x6c, 0x61, 0x73, 0x74, 0x69, 0x63, 0x43, 0x45, 0x52, 0x54, 0x22, 0x28,
-	0x0a, 0x0e, 0x48, 0x65, 0x61, 0x6c, 0x74, 0x68, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
-	0x12, 0x16, 0x0a, 0x06, 0x68, 0x65, 0x61, 0x6c, 0x74, 0x68, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08,
-	0x52, 0x06, 0x68, 0x65, 0x61, 0x6c, 0x74, 0x68, 0x22, 0x12, 0x0a, 0x10, 0x53, 0x68, 0x75, 0x74,
-	0x44, 0x6f, 0x77, 0x6e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x32, 0xe3, 0x02, 0x0a,
-	0x09, 0x41, 0x72, 0x69, 0x73, 0x74, 0x69, 0x64, 0x65, 0x73, 0x12, 0x53, 0x0a, 0x09, 0x47, 0x65,
-	0x74, 0x53, 0x65, 0x63, 0x72, 0x65, 0x74, 0x12, 0x1e, 0x2e, 0x64, 0x65, 0x6c, 0x70, 0x68, 0x69,
-	0x5f, 0x61, 0x72, 0x69, 0x73, 0x74, 0x69, 0x64, 0x65, 0x73, 0x2e, 0x56, 0x61, 0x75, 0x6c, 0x74,
-	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x24, 0x2e, 0x64, 0x65, 0x6c, 0x70, 0x68, 0x69,
-	0x5f, 0x61, 0x72, 0x69, 0x73, 0x74, 0x69, 0x64, 0x65, 0x73, 0x2e, 0x45, 0x6c, 0x61, 0x73, 0x74,
-	0x69, 0x63, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x56, 0x61, 0x75, 0x6c, 0x74, 0x22, 0x00, 0x12,
-	0x5d, 0x0a, 0x0e, 0x47, 0x65, 0x74, 0x4e, 0x61, 0x6d, 0x65, 0x64, 0x53, 0x65, 0x63, 0x72, 0x65,
-	0x74, 0x12, 0x23, 0x2e, 0x64, 0x65, 0x6c, 0x70, 0x68, 0x69, 0x5f, 0x61, 0x72, 0x69, 0x73, 0x74,
-	0x69, 0x64, 0x65, 0x73, 0x2e, 0x56, 0x61, 0x75, 0x6c, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
-	0x74, 0x4e, 0x61, 0x6d, 0x65, 0x64, 0x1a, 0x24, 0x2e, 0x64, 0x65, 0x6c, 0x70, 0x68, 0x69, 0x5f,
-	0x61, 0x72, 0x69, 0x73, 0x74, 0x69, 0x64, 0x65, 0x73, 0x2e, 0x45, 0x6c, 0x61, 0x73, 0x74, 0x69,
-	0x63, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x56, 0x61, 0x75, 0x6c, 0x74, 0x22, 0x00, 0x12, 0x4d,
-	0x0a, 0x06, 0x48, 0x65, 0x61, 0x6c, 0x74, 0x68, 0x12, 0x1f, 0x2e, 0x64, 0x65, 0x6c, 0x70, 0x68,
-	0x69, 0x5f, 0x61, 0x72, 0x69, 0x73, 0x74, 0x69, 0x64, 0x65, 0x73, 0x2e, 0x48, 0x65, 0x61, 0x6c,
-	0x74, 0x68, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x20, 0x2e, 0x64, 0x65, 0x6c, 0x70,
-	0x68, 0x69, 0x5f, 0x61, 0x72, 0x69, 0x73, 0x74, 0x69, 0x64, 0x65, 0x73, 0x2e, 0x48, 0x65, 0x61,
-	0x6c, 0x74, 0x68, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x53, 0x0a,
-	0x08, 0x53, 0x68, 0x75, 0x74, 0x44, 0x6f, 0x77, 0x6e, 0x12, 0x21, 0x2e, 0x64, 0x65, 0x6c, 0x70,
-	0x68, 0x69, 0x5f, 0x61, 0x72, 0x69, 0x73, 0x74, 0x69, 0x64, 0x65, 0x73, 0x2e, 0x53, 0x68, 0x75,
-	0x74, 0x44, 0x6f, 0x77, 0x6e, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x22, 0x2e, 0x64,
-	0x65, 0x6c, 0x70, 0x68, 0x69, 0x5f, 0x61, 0x72, 0x69, 0x73, 0x74, 0x69, 0x64, 0x65, 0x73, 0x2e,
-	0x53, 0x68, 0x75, 0x74, 0x44, 0x6f, 0x77, 0x6e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
-	0x22, 0x00, 0x42, 0x32, 0x5a, 0x30, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d,
-	0x2f, 0x6f, 0x64, 0x79, 0x73, 0x73, 0x65, 0x69, 0x61, 0x2d, 0x67, 0x72, 0x65, 0x65, 0x6b, 0x2f,
-	0x64, 0x65, 0x6c, 0x70, 0x68, 0x69, 0x2f, 0x61, 0x72, 0x69, 0x73, 0x74, 0x69, 0x64, 0x65, 0x73,
-	0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x09, 0x52, 0x0b, 0x45, 0x6c, 0x61, 0x73, 0x74, 0x69, 0x63, 0x43, 0x45, 0x52, 0x54, 0x12, 0x26,
+	0x0a, 0x0e, 0x6c, 0x65, 0x61, 0x73, 0x65, 0x45, 0x78, 0x70, 0x69, 0x72, 0x65, 0x73, 0x41, 0x74,
+	0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0e, 0x6c, 0x65, 0x61, 0x73, 0x65, 0x45, 0x78, 0x70,
+	0x69, 0x72, 0x65, 0x73, 0x41, 0x74, 0x22, 0x28, 0x0a, 0x0e, 0x48, 0x65, 0x61, 0x6c, 0x74, 0x68,
+	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x68, 0x65, 0x61, 0x6c,
+	0x74, 0x68, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x68, 0x65, 0x61, 0x6c, 0x74, 0x68,
+	0x22, 0x12, 0x0a, 0x10, 0x53, 0x68, 0x75, 0x74, 0x44, 0x6f, 0x77, 0x6e, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x32, 0xe3, 0x02, 0x0a, 0x09, 0x41, 0x72, 0x69, 0x73, 0x74, 0x69, 0x64,
+	0x65, 0x73, 0x12, 0x53, 0x0a, 0x09, 0x47, 0x65, 0x74, 0x53, 0x65, 0x63, 0x72, 0x65, 0x74, 0x12,
+	0x1e, 0x2e, 0x64, 0x65, 0x6c, 0x70, 0x68, 0x69, 0x5f, 0x61, 0x72, 0x69, 0x73, 0x74, 0x69, 0x64,
+	0x65, 0x73, 0x2e, 0x56, 0x61, 0x75, 0x6c, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a,
+	0x24, 0x2e, 0x64, 0x65, 0x6c, 0x70, 0x68, 0x69, 0x5f, 0x61, 0x72, 0x69, 0x73, 0x74, 0x69, 0x64,
+	0x65, 0x73, 0x2e, 0x45, 0x6c, 0x61, 0x73, 0x74, 0x69, 0x63, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67,
+	0x56, 0x61, 0x75, 0x6c, 0x74, 0x22, 0x00, 0x12, 0x5d, 0x0a, 0x0e, 0x47, 0x65, 0x74, 0x4e, 0x61,
+	0x6d, 0x65, 0x64, 0x53, 0x65, 0x63, 0x72, 0x65, 0x74, 0x12, 0x23, 0x2e, 0x64, 0x65, 0x6c, 0x70,
+	0x68, 0x69, 0x5f, 0x61, 0x72, 0x69, 0x73, 0x74, 0x69, 0x64, 0x65, 0x73, 0x2e, 0x56, 0x61, 0x75,
+	0x6c, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x4e, 0x61, 0x6d, 0x65, 0x64, 0x1a, 0x24,
+	0x2e, 0x64, 0x65, 0x6c, 0x70, 0x68, 0x69, 0x5f, 0x61, 0x72, 0x69, 0x73, 0x74, 0x69, 0x64, 0x65,
+	0x73, 0x2e, 0x45, 0x6c, 0x61, 0x73, 0x74, 0x69, 0x63, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x56,
+	0x61, 0x75, 0x6c, 0x74, 0x22, 0x00, 0x12, 0x4d, 0x0a, 0x06, 0x48, 0x65, 0x61, 0x6c, 0x74, 0x68,
+	0x12, 0x1f, 0x2e, 0x64, 0x65, 0x6c, 0x70, 0x68, 0x69, 0x5f, 0x61, 0x72, 0x69, 0x73, 0x74, 0x69,
+	0x64, 0x65, 0x73, 0x2e, 0x48, 0x65, 0x61, 0x6c, 0x74, 0x68, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x1a, 0x20, 0x2e, 0x64, 0x65, 0x6c, 0x70, 0x68, 0x69, 0x5f, 0x61, 0x72, 0x69, 0x73, 0x74,
+	0x69, 0x64, 0x65, 0x73, 0x2e, 0x48, 0x65, 0x61, 0x6c, 0x74, 0x68, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x53, 0x0a, 0x08, 0x53, 0x68, 0x75, 0x74, 0x44, 0x6f, 0x77,
+	0x6e, 0x12, 0x21, 0x2e, 0x64, 0x65, 0x6c, 0x70, 0x68, 0x69, 0x5f, 0x61, 0x72, 0x69, 0x73, 0x74,
+	0x69, 0x64, 0x65, 0x73, 0x2e, 0x53, 0x68, 0x75, 0x74, 0x44, 0x6f, 0x77, 0x6e, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x1a, 0x22, 0x2e, 0x64, 0x65, 0x6c, 0x70, 0x68, 0x69, 0x5f, 0x61, 0x72,
+	0x69, 0x73, 0x74, 0x69, 0x64, 0x65, 0x73, 0x2e, 0x53, 0x68, 0x75, 0x74, 0x44, 0x6f, 0x77, 0x6e,
+	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x42, 0x32, 0x5a, 0x30, 0x67, 0x69,
+	0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x6f, 0x64, 0x79, 0x73, 0x73, 0x65, 0x69,
+	0x61, 0x2d, 0x67, 0x72, 0x65, 0x65, 0x6b, 0x2f, 0x64, 0x65, 0x6c, 0x70, 0x68, 0x69, 0x2f, 0x61,
+	0x72, 0x69, 0x73, 0x74, 0x69, 0x64, 0x65, 0x73, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x06,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -18,6 +18,14 @@ type ElasticResponse struct {
 	ElasticPassword string `json:"elasticPassword"`
 }
 
+// SolonError is the error envelope solon returns for every failed request
+type SolonError struct {
+	UniqueCode string `json:"uniqueCode"`
+	Code       string `json:"code"`
+	Field      string `json:"field,omitempty"`
+	Message    string `json:"message"`
+}
+
 const (
 	TokenContext         string = "tokenContext"
 	SecondTokenContext   string = "secondTokenContext"
@@ -77,7 +85,7 @@ func (l *OdysseiaFixture) aRequestIsMadeToRegisterTheRunningPodWithIncorrectRole
 	response, err := l.client.Solon().Register(body, "")
 	defer response.Body.Close()
 
-	var solonResponse models.ValidationError
+	var solonResponse SolonError
 	err = json.NewDecoder(response.Body).Decode(&solonResponse)
 	if err != nil {
 		return err
@@ -122,12 +130,12 @@ func (l *OdysseiaFixture) aSuccessfulRegisterShouldBeMade() error {
 }
 
 func (l *OdysseiaFixture) aValidationErrorIsReturnedThatThePodAnnotationsDoNotMatchTheRequestedRoleAndAccess() error {
-	registerError := l.ctx.Value(ErrorContext).(models.ValidationError)
-	if len(registerError.Messages) == 0 {
-		return fmt.Errorf("expected messages to be included but none found")
+	registerError := l.ctx.Value(ErrorContext).(SolonError)
+	if registerError.Code != "annotation-mismatch" {
+		return fmt.Errorf("expected error code annotation-mismatch but got: %s", registerError.Code)
 	}
 
-	if !strings.Contains(registerError.Messages[0].Message, "annotations") || !strings.Contains(registerError.Messages[0].Message, l.PodName) {
+	if !strings.Contains(registerError.Message, "annotations") || !strings.Contains(registerError.Message, l.PodName) {
 		return fmt.Errorf("expected annotations or pod annotations to match")
 	}
 
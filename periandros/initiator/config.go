@@ -5,7 +5,7 @@ import (
 	"github.com/odysseia-greek/agora/plato/config"
 	"github.com/odysseia-greek/agora/plato/logging"
 	"github.com/odysseia-greek/agora/plato/models"
-	"strings"
+	"os"
 	"time"
 )
 
@@ -21,6 +21,11 @@ func CreateNewConfig(duration time.Duration, timeOut time.Duration) (*Periandros
 		return nil, err
 	}
 
+	err = withServiceAccountToken(service, config.StringFromEnv(EnvTokenPath, DefaultTokenPath), os.Getenv(EnvCertRoot))
+	if err != nil {
+		return nil, err
+	}
+
 	tracing := config.BoolFromEnv(TRACING)
 	solonRequest := initCreation(tracing)
 
@@ -43,22 +48,14 @@ func initCreation(tracing bool) models.SolonCreationRequest {
 	}
 
 	logging.Info(fmt.Sprintf("working on pod: %s", podName))
-	splitPodName := strings.Split(podName, "-")
 
+	// solon assigns the username from the pod name, only the tracing pods share a user they ask for explicitly
 	var username string
-	if !tracing {
-		if len(splitPodName) > 1 {
-			username = splitPodName[0] + splitPodName[len(splitPodName)-1]
-		} else {
-			username = splitPodName[0]
-		}
-
-	} else {
+	if tracing {
 		username = config.DefaultTracingName
+		logging.Info(fmt.Sprintf("requesting shared username: %s", username))
 	}
 
-	logging.Info(fmt.Sprintf("username from pod is: %s", username))
-
 	creationRequest := models.SolonCreationRequest{
 		Role:     role,
 		Access:   envAccess,
@@ -2,6 +2,7 @@ package initiator
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	uuid2 "github.com/google/uuid"
 	"github.com/odysseia-greek/agora/plato/logging"
@@ -18,17 +19,94 @@ type PeriandrosHandler struct {
 	SolonCreationRequest models.SolonCreationRequest
 }
 
+// SolonError mirrors the error envelope solon returns for every failed request
+type SolonError struct {
+	UniqueCode string `json:"uniqueCode"`
+	Code       string `json:"code"`
+	Field      string `json:"field,omitempty"`
+	Message    string `json:"message"`
+}
+
+func (e *SolonError) Error() string {
+	return fmt.Sprintf("solon returned %s: %s", e.Code, e.Message)
+}
+
+// Retryable is true when the failure is on the side of solon or its dependencies and a new attempt could succeed
+func (e *SolonError) Retryable() bool {
+	switch e.Code {
+	case "service-unavailable", "internal-error", "password-generation-failed", "vault-policy-failed", "vault-token-failed", "vault-secret-failed", "elastic-user-failed", "credential-user-failed":
+		return true
+	default:
+		return false
+	}
+}
+
+// SolonHealth mirrors the part of the solon health report periandros acts on
+type SolonHealth struct {
+	Healthy bool   `json:"healthy"`
+	Status  string `json:"status"`
+}
+
+// Serving follows the rule solon documents for its overall status: healthy and degraded still take requests while
+// unhealthy does not. A solon without a status predates the report and only sets healthy
+func (h *SolonHealth) Serving() bool {
+	switch h.Status {
+	case "healthy", "degraded":
+		return true
+	case "":
+		return h.Healthy
+	default:
+		return false
+	}
+}
+
 func (p *PeriandrosHandler) CreateUser() (bool, error) {
 	healthy := p.CheckSolonHealth()
 	if !healthy {
 		return false, fmt.Errorf("solon not available cannot create user")
 	}
 
+	timeout := time.After(p.Timeout)
+
+	for {
+		created, err := p.register()
+		if err == nil {
+			return created, nil
+		}
+
+		var solonErr *SolonError
+		if !errors.As(err, &solonErr) || !solonErr.Retryable() {
+			return false, err
+		}
+
+		logging.Error(fmt.Sprintf("registering with solon failed with %s, retrying: %s", solonErr.Code, solonErr.Message))
+
+		select {
+		case <-timeout:
+			return false, err
+		case <-time.After(p.Duration):
+		}
+	}
+}
+
+func (p *PeriandrosHandler) register() (bool, error) {
 	uuid := uuid2.New().String()
 
 	response, err := p.HttpClients.Solon().Register(p.SolonCreationRequest, uuid)
 	if err != nil {
-		return false, err
+		if response == nil {
+			return false, err
+		}
+
+		defer response.Body.Close()
+
+		var solonErr SolonError
+		decodeErr := json.NewDecoder(response.Body).Decode(&solonErr)
+		if decodeErr != nil || solonErr.Code == "" {
+			return false, err
+		}
+
+		return false, &solonErr
 	}
 
 	defer response.Body.Close()
@@ -61,16 +139,22 @@ func (p *PeriandrosHandler) CheckSolonHealth() bool {
 				continue
 			}
 
-			var solonResponse models.Health
-			err = json.NewDecoder(response.Body).Decode(&solonResponse)
+			var solonHealth SolonHealth
+			err = json.NewDecoder(response.Body).Decode(&solonHealth)
+			response.Body.Close()
 			if err != nil {
 				continue
 			}
 
-			healthy = solonResponse.Healthy
+			healthy = solonHealth.Serving()
 			if !healthy {
+				logging.Info(fmt.Sprintf("solon is %s, waiting", solonHealth.Status))
 				continue
 			}
+
+			if solonHealth.Status == "degraded" {
+				logging.Info("solon is degraded but serving requests")
+			}
 			ticker.Stop()
 
 		case <-timeout:
@@ -1,6 +1,7 @@
 package initiator
 
 import (
+	"errors"
 	"github.com/odysseia-greek/agora/plato/models"
 	"github.com/odysseia-greek/agora/plato/service"
 	"github.com/stretchr/testify/assert"
@@ -125,6 +126,54 @@ func TestSolonHealthy(t *testing.T) {
 		healthy := testHandler.CheckSolonHealth()
 		assert.True(t, healthy)
 	})
+
+	t.Run("SolonDegradedIsServing", func(t *testing.T) {
+		codes := []int{
+			200,
+		}
+
+		responses := []string{
+			`{"healthy":true,"status":"degraded","dependencies":[{"name":"tracer","status":"unhealthy","critical":false}]}`,
+		}
+
+		testClient, err := service.NewFakeClient(config, codes, responses)
+		assert.Nil(t, err)
+
+		testHandler := PeriandrosHandler{
+			Duration:             duration,
+			Timeout:              timeOut,
+			Namespace:            ns,
+			HttpClients:          testClient,
+			SolonCreationRequest: requestBody,
+		}
+
+		healthy := testHandler.CheckSolonHealth()
+		assert.True(t, healthy)
+	})
+
+	t.Run("SolonStatusUnhealthy", func(t *testing.T) {
+		codes := []int{
+			200,
+		}
+
+		responses := []string{
+			`{"healthy":true,"status":"unhealthy"}`,
+		}
+
+		testClient, err := service.NewFakeClient(config, codes, responses)
+		assert.Nil(t, err)
+
+		testHandler := PeriandrosHandler{
+			Duration:             duration,
+			Timeout:              timeOut,
+			Namespace:            ns,
+			HttpClients:          testClient,
+			SolonCreationRequest: requestBody,
+		}
+
+		healthy := testHandler.CheckSolonHealth()
+		assert.False(t, healthy)
+	})
 }
 
 func TestCreatUser(t *testing.T) {
@@ -218,6 +267,72 @@ func TestCreatUser(t *testing.T) {
 		assert.False(t, created)
 	})
 
+	t.Run("AnnotationMismatchIsNotRetried", func(t *testing.T) {
+		codes := []int{
+			200,
+			403,
+			201,
+		}
+
+		hr, err := healthModel.Marshal()
+		assert.Nil(t, err)
+		r, err := postResponse.Marshal()
+		assert.Nil(t, err)
+
+		responses := []string{
+			string(hr),
+			`{"uniqueCode":"abc","code":"annotation-mismatch","field":"annotations","message":"illegal action detected"}`,
+			string(r),
+		}
+
+		testClient, err := service.NewFakeClient(config, codes, responses)
+		testHandler := PeriandrosHandler{
+			Duration:             duration,
+			Timeout:              timeOut,
+			Namespace:            ns,
+			HttpClients:          testClient,
+			SolonCreationRequest: requestBody,
+		}
+		created, err := testHandler.CreateUser()
+		assert.NotNil(t, err)
+		assert.False(t, created)
+
+		var solonErr *SolonError
+		assert.True(t, errors.As(err, &solonErr))
+		assert.Equal(t, "annotation-mismatch", solonErr.Code)
+	})
+
+	t.Run("VaultFailureIsRetried", func(t *testing.T) {
+		codes := []int{
+			200,
+			500,
+			201,
+		}
+
+		hr, err := healthModel.Marshal()
+		assert.Nil(t, err)
+		r, err := postResponse.Marshal()
+		assert.Nil(t, err)
+
+		responses := []string{
+			string(hr),
+			`{"uniqueCode":"abc","code":"vault-secret-failed","field":"createSecret","message":"vault is sealed"}`,
+			string(r),
+		}
+
+		testClient, err := service.NewFakeClient(config, codes, responses)
+		testHandler := PeriandrosHandler{
+			Duration:             duration,
+			Timeout:              timeOut,
+			Namespace:            ns,
+			HttpClients:          testClient,
+			SolonCreationRequest: requestBody,
+		}
+		created, err := testHandler.CreateUser()
+		assert.Nil(t, err)
+		assert.True(t, created)
+	})
+
 	t.Run("SolonNotHealthy", func(t *testing.T) {
 		codes := []int{
 			500,
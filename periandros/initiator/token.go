@@ -0,0 +1,125 @@
+package initiator
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/odysseia-greek/agora/plato/config"
+	"github.com/odysseia-greek/agora/plato/logging"
+	"github.com/odysseia-greek/agora/plato/service"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// EnvTokenPath is where the serviceaccount token solon reviews is mounted, the token kubernetes mounts in every
+	// pod is bound to that pod and is the default
+	EnvTokenPath     string = "SOLON_TOKEN_PATH"
+	DefaultTokenPath string = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	// EnvCertRoot is where plato finds the certificates it talks to the odysseia apis with
+	EnvCertRoot string = "CERT_ROOT"
+)
+
+// serviceAccountClient sends the serviceaccount token of the pod as a bearer token with every request to solon,
+// the token is read for every request because kubernetes rotates it
+type serviceAccountClient struct {
+	client    *http.Client
+	tokenPath string
+}
+
+// withServiceAccountToken swaps the http client of solon for one that sends the serviceaccount token, with the
+// certificates plato loads for solon from the cert root
+func withServiceAccountToken(clients service.OdysseiaClient, tokenPath, certRoot string) error {
+	solon, ok := clients.Solon().(*service.SolonImpl)
+	if !ok || solon == nil {
+		return fmt.Errorf("solon client %T cannot send a serviceaccount token", clients.Solon())
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	if solon.Scheme == "https" {
+		tlsConfig, err := solonTLSConfig(certRoot)
+		if err != nil {
+			return err
+		}
+
+		client.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+	}
+
+	solon.Client = &serviceAccountClient{client: client, tokenPath: tokenPath}
+	return nil
+}
+
+// solonTLSConfig loads the ca and client certificate of solon from the folder in the cert root named after it
+func solonTLSConfig(certRoot string) (*tls.Config, error) {
+	dirs, err := os.ReadDir(certRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the directory %s: %w", certRoot, err)
+	}
+
+	solonService := strings.ToLower(config.EnvSolonService)
+	for _, dir := range dirs {
+		if !dir.IsDir() || !strings.Contains(solonService, strings.ToLower(dir.Name())) {
+			continue
+		}
+
+		dirPath := filepath.Join(certRoot, dir.Name())
+		tlsConfig := &tls.Config{}
+
+		ca, err := os.ReadFile(filepath.Join(dirPath, "tls.pem"))
+		if err == nil {
+			tlsConfig.RootCAs = x509.NewCertPool()
+			tlsConfig.RootCAs.AppendCertsFromPEM(ca)
+		}
+
+		cert, err := tls.LoadX509KeyPair(filepath.Join(dirPath, "tls.crt"), filepath.Join(dirPath, "tls.key"))
+		if err == nil {
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+
+		return tlsConfig, nil
+	}
+
+	return nil, fmt.Errorf("no certificates for solon found in %s", certRoot)
+}
+
+func (c *serviceAccountClient) Get(u *url.URL, uuid string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.do(req, uuid)
+}
+
+func (c *serviceAccountClient) Post(u *url.URL, body []byte, uuid string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, u.String(), bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	return c.do(req, uuid)
+}
+
+// do sends the request with the token, without a mounted token the request goes out without one and solon decides
+func (c *serviceAccountClient) do(req *http.Request, uuid string) (*http.Response, error) {
+	req.Header.Set(service.HeaderKey, uuid)
+
+	token, err := os.ReadFile(c.tokenPath)
+	switch {
+	case err == nil:
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	case errors.Is(err, os.ErrNotExist):
+		logging.Debug(fmt.Sprintf("no serviceaccount token mounted at %s", c.tokenPath))
+	default:
+		return nil, fmt.Errorf("failed to read serviceaccount token: %w", err)
+	}
+
+	return c.client.Do(req)
+}
@@ -0,0 +1,82 @@
+package initiator
+
+import (
+	"github.com/odysseia-greek/agora/plato/models"
+	"github.com/odysseia-greek/agora/plato/service"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestServiceAccountToken(t *testing.T) {
+	newSolon := func(t *testing.T, tokenPath string) (service.OdysseiaClient, *[]string) {
+		var authorization []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authorization = append(authorization, r.Header.Get("Authorization"))
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"userCreated":true,"secretCreated":true}`))
+		}))
+		t.Cleanup(server.Close)
+
+		serverUrl, err := url.Parse(server.URL)
+		assert.Nil(t, err)
+
+		clients, err := service.NewClient(service.ClientConfig{Solon: service.OdysseiaApi{Url: serverUrl.Host, Scheme: serverUrl.Scheme}})
+		assert.Nil(t, err)
+		err = withServiceAccountToken(clients, tokenPath, "")
+		assert.Nil(t, err)
+
+		return clients, &authorization
+	}
+
+	t.Run("SentWithRegister", func(t *testing.T) {
+		tokenPath := filepath.Join(t.TempDir(), "token")
+		assert.Nil(t, os.WriteFile(tokenPath, []byte("projected-token\n"), 0600))
+		clients, authorization := newSolon(t, tokenPath)
+
+		handler := PeriandrosHandler{HttpClients: clients, SolonCreationRequest: models.SolonCreationRequest{PodName: "somepodname"}}
+		created, err := handler.register()
+		assert.Nil(t, err)
+		assert.True(t, created)
+		assert.Equal(t, []string{"Bearer projected-token"}, *authorization)
+	})
+
+	t.Run("ReadForEveryRequest", func(t *testing.T) {
+		tokenPath := filepath.Join(t.TempDir(), "token")
+		assert.Nil(t, os.WriteFile(tokenPath, []byte("first"), 0600))
+		clients, authorization := newSolon(t, tokenPath)
+
+		handler := PeriandrosHandler{HttpClients: clients}
+		_, err := handler.register()
+		assert.Nil(t, err)
+		assert.Nil(t, os.WriteFile(tokenPath, []byte("rotated"), 0600))
+		_, err = handler.register()
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"Bearer first", "Bearer rotated"}, *authorization)
+	})
+
+	t.Run("NoTokenMounted", func(t *testing.T) {
+		clients, authorization := newSolon(t, filepath.Join(t.TempDir(), "token"))
+
+		handler := PeriandrosHandler{HttpClients: clients}
+		_, err := handler.register()
+		assert.Nil(t, err)
+		assert.Equal(t, []string{""}, *authorization)
+	})
+
+	t.Run("CertificatesOfSolon", func(t *testing.T) {
+		certRoot := t.TempDir()
+		assert.Nil(t, os.Mkdir(filepath.Join(certRoot, "solon"), 0700))
+
+		tlsConfig, err := solonTLSConfig(certRoot)
+		assert.Nil(t, err)
+		assert.Empty(t, tlsConfig.Certificates)
+
+		_, err = solonTLSConfig(t.TempDir())
+		assert.ErrorContains(t, err, "no certificates for solon")
+	})
+}
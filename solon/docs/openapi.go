@@ -0,0 +1,408 @@
+package docs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	openAPIVersion string = "3.0.3"
+	BasePath       string = "/solon/v1"
+	Version        string = "0.2.4"
+
+	ContentTypeJSON string = "application/json"
+	ContentTypeText string = "text/plain"
+
+	TagStatus  string = "status"
+	TagService string = "service"
+	TagAdmin   string = "admin"
+
+	securityScheme string = "serviceAccountToken"
+	errorSchema    string = "SolonError"
+)
+
+var pathParameter = regexp.MustCompile(`\{([^}]+)\}`)
+
+// Operation describes a single route, the spec is generated from the operations the router is built from.
+// Request and Response hold a value of the body type, a field is required unless it is a pointer or omitempty
+type Operation struct {
+	Path        string
+	Method      string
+	OperationID string
+	Tag         string
+	Summary     string
+	// Query holds the query parameters the operation reads
+	Query   []Parameter
+	Request interface{}
+	// RequestRequired is false for endpoints that accept an empty body
+	RequestRequired bool
+	Response        interface{}
+	// ContentType of the response, json when empty
+	ContentType string
+	// Authenticated operations take the serviceaccount token of the pod and answer failures with a SolonError
+	Authenticated bool
+}
+
+// Document is an OpenAPI 3 document, only the parts solon uses are modelled
+type Document struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       Info                            `json:"info"`
+	Servers    []Server                        `json:"servers"`
+	Paths      map[string]map[string]*PathItem `json:"paths"`
+	Components Components                      `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Version     string `json:"version"`
+}
+
+type Server struct {
+	URL string `json:"url"`
+}
+
+type PathItem struct {
+	OperationID string                `json:"operationId"`
+	Tags        []string              `json:"tags,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme"`
+	Description string `json:"description,omitempty"`
+}
+
+// Schema is the subset of json schema the generator writes and Validate understands
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+func (d *Document) Marshal() ([]byte, error) {
+	return json.Marshal(d)
+}
+
+// Generate builds the spec of the operations, every struct used in a body becomes a schema in the components
+func Generate(operations []Operation) *Document {
+	doc := &Document{
+		OpenAPI: openAPIVersion,
+		Info: Info{
+			Title:       "Solon",
+			Description: "Solon registers pods with elasticsearch and vault and hands out one time vault tokens.",
+			Version:     Version,
+		},
+		Servers: []Server{{URL: BasePath}},
+		Paths:   map[string]map[string]*PathItem{},
+		Components: Components{
+			Schemas: map[string]*Schema{},
+			SecuritySchemes: map[string]SecurityScheme{
+				securityScheme: {Type: "http", Scheme: "bearer", Description: "serviceaccount token of the calling pod"},
+			},
+		},
+	}
+
+	for _, operation := range operations {
+		path := strings.TrimPrefix(operation.Path, BasePath)
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = map[string]*PathItem{}
+		}
+
+		doc.Paths[path][strings.ToLower(operation.Method)] = doc.pathItem(operation)
+	}
+
+	return doc
+}
+
+func (d *Document) pathItem(operation Operation) *PathItem {
+	item := &PathItem{
+		OperationID: operation.OperationID,
+		Summary:     operation.Summary,
+		Responses:   map[string]Response{},
+	}
+
+	if operation.Tag != "" {
+		item.Tags = []string{operation.Tag}
+	}
+
+	for _, match := range pathParameter.FindAllStringSubmatch(operation.Path, -1) {
+		item.Parameters = append(item.Parameters, Parameter{Name: match[1], In: "path", Required: true, Schema: &Schema{Type: "string"}})
+	}
+
+	for _, parameter := range operation.Query {
+		parameter.In = "query"
+		item.Parameters = append(item.Parameters, parameter)
+	}
+
+	if operation.Request != nil {
+		item.RequestBody = &RequestBody{
+			Required: operation.RequestRequired,
+			Content:  map[string]MediaType{ContentTypeJSON: {Schema: d.schemaOf(reflect.TypeOf(operation.Request))}},
+		}
+	}
+
+	response := Response{Description: http.StatusText(http.StatusOK)}
+	switch {
+	case operation.ContentType == ContentTypeText:
+		response.Content = map[string]MediaType{ContentTypeText: {Schema: &Schema{Type: "string"}}}
+	case operation.Response != nil:
+		response.Content = map[string]MediaType{ContentTypeJSON: {Schema: d.schemaOf(reflect.TypeOf(operation.Response))}}
+	}
+	item.Responses[fmt.Sprintf("%d", http.StatusOK)] = response
+
+	if operation.Authenticated {
+		item.Security = []map[string][]string{{securityScheme: {}}}
+		item.Responses["default"] = Response{
+			Description: "Error",
+			Content:     map[string]MediaType{ContentTypeJSON: {Schema: &Schema{Ref: schemaRef(errorSchema)}}},
+		}
+	}
+
+	return item
+}
+
+// AddSchema registers a type that is not a request or response body of any operation, such as the error envelope
+func (d *Document) AddSchema(value interface{}) {
+	d.schemaOf(reflect.TypeOf(value))
+}
+
+// Schema returns the component a reference points to, any other schema is returned as is
+func (d *Document) Schema(schema *Schema) *Schema {
+	if schema == nil || schema.Ref == "" {
+		return schema
+	}
+
+	return d.Components.Schemas[strings.TrimPrefix(schema.Ref, schemaRef(""))]
+}
+
+// RequestSchema is the schema of the request body of an operation, nil when it takes no body
+func (d *Document) RequestSchema(path, method string) (*Schema, bool) {
+	item, ok := d.Paths[strings.TrimPrefix(path, BasePath)][strings.ToLower(method)]
+	if !ok || item.RequestBody == nil {
+		return nil, false
+	}
+
+	return item.RequestBody.Content[ContentTypeJSON].Schema, item.RequestBody.Required
+}
+
+func schemaRef(name string) string {
+	return "#/components/schemas/" + name
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (d *Document) schemaOf(t reflect.Type) *Schema {
+	if t.Kind() == reflect.Pointer {
+		schema := d.schemaOf(t.Elem())
+		if schema.Ref != "" {
+			return schema
+		}
+		schema.Nullable = true
+		return schema
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Struct:
+		name := t.Name()
+		if _, ok := d.Components.Schemas[name]; !ok {
+			// registered before the fields are walked so a type that refers to itself ends
+			d.Components.Schemas[name] = &Schema{Type: "object"}
+			d.Components.Schemas[name] = d.structSchema(t)
+		}
+		return &Schema{Ref: schemaRef(name)}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: d.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schemaOf(t.Elem())}
+	default:
+		return &Schema{}
+	}
+}
+
+// structSchema follows encoding/json: embedded structs are flattened and fields tagged with - are left out
+func (d *Document) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, options, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			embedded := d.structSchema(field.Type)
+			for property, propertySchema := range embedded.Properties {
+				schema.Properties[property] = propertySchema
+			}
+			schema.Required = append(schema.Required, embedded.Required...)
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		schema.Properties[name] = d.schemaOf(field.Type)
+		if !strings.Contains(options, "omitempty") && field.Type.Kind() != reflect.Pointer {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	sort.Strings(schema.Required)
+	return schema
+}
+
+// Validate checks a decoded json value against a schema, numbers are expected as json.Number.
+// Properties the schema does not know are rejected so a misspelled field does not pass silently
+func (d *Document) Validate(schema *Schema, value interface{}) error {
+	return d.validate("body", schema, value)
+}
+
+func (d *Document) validate(at string, schema *Schema, value interface{}) error {
+	schema = d.Schema(schema)
+	if schema == nil {
+		return nil
+	}
+
+	if value == nil {
+		if schema.Nullable {
+			return nil
+		}
+		return fmt.Errorf("%s cannot be null", at)
+	}
+
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s should be an object", at)
+		}
+
+		for _, name := range schema.Required {
+			if _, ok := object[name]; !ok {
+				return fmt.Errorf("%s.%s is required", at, name)
+			}
+		}
+
+		for name, property := range object {
+			var propertySchema *Schema
+			switch {
+			case schema.Properties[name] != nil:
+				propertySchema = schema.Properties[name]
+			case schema.AdditionalProperties != nil:
+				propertySchema = schema.AdditionalProperties
+			default:
+				return fmt.Errorf("%s.%s is not a known field", at, name)
+			}
+
+			if err := d.validate(at+"."+name, propertySchema, property); err != nil {
+				return err
+			}
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s should be an array", at)
+		}
+
+		for i, item := range items {
+			if err := d.validate(fmt.Sprintf("%s[%d]", at, i), schema.Items, item); err != nil {
+				return err
+			}
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s should be a string", at)
+		}
+
+		if schema.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				return fmt.Errorf("%s should be a date-time", at)
+			}
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s should be a boolean", at)
+		}
+	case "integer":
+		number, ok := value.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s should be an integer", at)
+		}
+
+		if _, err := number.Int64(); err != nil {
+			return fmt.Errorf("%s should be an integer", at)
+		}
+	case "number":
+		if _, ok := value.(json.Number); !ok {
+			return fmt.Errorf("%s should be a number", at)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package lawgiver
+
+import (
+	"fmt"
+	delphi "github.com/odysseia-greek/delphi/solon/models"
+	"slices"
+	"strings"
+)
+
+// accessSeparator splits an index from the role a pod holds on it, as in dictionary:api;texts:seeder
+const accessSeparator string = ":"
+
+// accessPair is an index and the role a pod holds on it
+type accessPair struct {
+	Index string
+	Role  string
+}
+
+func (a accessPair) roleName() string {
+	return fmt.Sprintf("%s_%s", a.Index, a.Role)
+}
+
+func (a accessPair) String() string {
+	return a.Index + accessSeparator + a.Role
+}
+
+// parseAccess reads entries of the form index or index:role, an index without a role gets defaultRole
+// so annotations written before roles were set per index keep their meaning
+func parseAccess(entries []string, defaultRole string) ([]accessPair, error) {
+	var pairs []accessPair
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		index, role, hasRole := strings.Cut(entry, accessSeparator)
+		if !hasRole {
+			role = defaultRole
+		}
+
+		if index == "" || role == "" || strings.Contains(role, accessSeparator) {
+			return nil, fmt.Errorf("invalid access %q, expected index or index%srole", entry, accessSeparator)
+		}
+
+		pairs = append(pairs, accessPair{Index: index, Role: role})
+	}
+
+	return pairs, nil
+}
+
+// validateAnnotations returns the requested access when every requested pair is granted by the annotations of the pod,
+// the role annotation is the role for every index in the access annotation that does not name its own
+func (s *SolonHandler) validateAnnotations(annotations map[string]string, req *delphi.SolonCreationRequest) ([]accessPair, error) {
+	allowed, err := parseAccess(strings.Split(annotations[s.AccessAnnotation], ";"), annotations[s.RoleAnnotation])
+	if err != nil {
+		return nil, fmt.Errorf("annotation %s: %w", s.AccessAnnotation, err)
+	}
+
+	requested, err := parseAccess(req.Access, req.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(requested) == 0 {
+		return nil, fmt.Errorf("no access requested")
+	}
+
+	for _, pair := range requested {
+		if !slices.Contains(allowed, pair) {
+			return nil, fmt.Errorf("%s is not granted by the annotations", pair)
+		}
+	}
+
+	return requested, nil
+}
+
+// generateRoleNames returns the elastic role for every index and role pair, <index>_<role>
+func generateRoleNames(pairs []accessPair) []string {
+	var roleNames []string
+	for _, pair := range pairs {
+		roleNames = append(roleNames, pair.roleName())
+	}
+	return roleNames
+}
@@ -0,0 +1,76 @@
+package lawgiver
+
+import (
+	delphi "github.com/odysseia-greek/delphi/solon/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAccessAnnotations(t *testing.T) {
+	handler := &SolonHandler{
+		AccessAnnotation: "odysseia-greek/access",
+		RoleAnnotation:   "odysseia-greek/role",
+	}
+
+	t.Run("RolePerIndex", func(t *testing.T) {
+		annotations := map[string]string{"odysseia-greek/access": "dictionary:api;texts:seeder"}
+		request := delphi.SolonCreationRequest{Access: []string{"dictionary:api", "texts:seeder"}}
+
+		sut, err := handler.validateAnnotations(annotations, &request)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"dictionary_api", "texts_seeder"}, generateRoleNames(sut))
+	})
+
+	t.Run("BareIndexUsesTheRoleAnnotation", func(t *testing.T) {
+		annotations := map[string]string{"odysseia-greek/access": "dictionary;texts:seeder", "odysseia-greek/role": "api"}
+		request := delphi.SolonCreationRequest{Role: "api", Access: []string{"dictionary", "texts:seeder"}}
+
+		sut, err := handler.validateAnnotations(annotations, &request)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"dictionary_api", "texts_seeder"}, generateRoleNames(sut))
+	})
+
+	t.Run("EveryPairHasToBeGranted", func(t *testing.T) {
+		annotations := map[string]string{"odysseia-greek/access": "dictionary:api;texts:api"}
+		request := delphi.SolonCreationRequest{Access: []string{"dictionary:api", "texts:seeder"}}
+
+		_, err := handler.validateAnnotations(annotations, &request)
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "texts:seeder")
+	})
+
+	t.Run("OneGrantedIndexIsNotEnough", func(t *testing.T) {
+		annotations := map[string]string{"odysseia-greek/access": "dictionary", "odysseia-greek/role": "api"}
+		request := delphi.SolonCreationRequest{Role: "api", Access: []string{"dictionary", "texts"}}
+
+		_, err := handler.validateAnnotations(annotations, &request)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("RoleHasToMatch", func(t *testing.T) {
+		annotations := map[string]string{"odysseia-greek/access": "dictionary", "odysseia-greek/role": "api"}
+		request := delphi.SolonCreationRequest{Role: "seeder", Access: []string{"dictionary"}}
+
+		_, err := handler.validateAnnotations(annotations, &request)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("NothingRequested", func(t *testing.T) {
+		annotations := map[string]string{"odysseia-greek/access": "dictionary", "odysseia-greek/role": "api"}
+		request := delphi.SolonCreationRequest{Role: "api"}
+
+		_, err := handler.validateAnnotations(annotations, &request)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("MalformedAccess", func(t *testing.T) {
+		_, err := parseAccess([]string{"dictionary:api:seeder"}, "")
+		assert.NotNil(t, err)
+
+		_, err = parseAccess([]string{":api"}, "")
+		assert.NotNil(t, err)
+
+		_, err = parseAccess([]string{"dictionary"}, "")
+		assert.NotNil(t, err)
+	})
+}
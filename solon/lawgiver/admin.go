@@ -0,0 +1,66 @@
+package lawgiver
+
+import (
+	"fmt"
+	v1 "k8s.io/api/core/v1"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// EnvAdminServiceAccounts is a comma separated list of namespace:name serviceaccounts allowed to act on behalf of any pod
+const EnvAdminServiceAccounts string = "SOLON_ADMIN_SERVICEACCOUNTS"
+
+// parseAdminServiceAccounts turns namespace:name pairs into the usernames a token review returns for them
+func parseAdminServiceAccounts(value string) ([]string, error) {
+	var admins []string
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		ns, name, ok := strings.Cut(entry, ":")
+		if !ok || ns == "" || name == "" {
+			return nil, fmt.Errorf("invalid %s entry %s, expected namespace:name", EnvAdminServiceAccounts, entry)
+		}
+
+		admins = append(admins, serviceAccountPrefix+ns+":"+name)
+	}
+
+	return admins, nil
+}
+
+func (s *SolonHandler) isAdmin(username string) bool {
+	return slices.Contains(s.Admins, username)
+}
+
+// identifyPodOrAdmin returns the calling pod, or the username of the caller when its token belongs to an admin
+// serviceaccount. Admins are only recognised with serviceaccount authentication and a pod has to present its client
+// certificate the same way it does through identifyCallingPod, an error is always a *solonError
+func (s *SolonHandler) identifyPodOrAdmin(req *http.Request) (*v1.Pod, string, error) {
+	if s.AuthMode == AuthModeIP || len(s.Admins) == 0 {
+		pod, err := s.identifyCallingPod(req)
+		return pod, "", err
+	}
+
+	user, err := s.reviewToken(req)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if s.isAdmin(user.Username) {
+		return nil, user.Username, nil
+	}
+
+	pod, err := s.podOfUser(user)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := s.verifyClientCertificate(req, pod); err != nil {
+		return nil, "", err
+	}
+
+	return pod, "", nil
+}
@@ -0,0 +1,276 @@
+package lawgiver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/odysseia-greek/agora/aristoteles"
+	"github.com/odysseia-greek/agora/plato/logging"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	EnvAuditSinks   string = "SOLON_AUDIT_SINKS"
+	EnvAuditIndex   string = "SOLON_AUDIT_INDEX"
+	EnvAuditWebhook string = "SOLON_AUDIT_WEBHOOK"
+
+	defaultAuditSinks string = "stdout"
+	defaultAuditIndex string = "solon-audit"
+
+	AuditSinkStdout  string = "stdout"
+	AuditSinkElastic string = "elastic"
+	AuditSinkWebhook string = "webhook"
+)
+
+const (
+	AuditActionRegister           string = "register"
+	AuditActionTokenIssue         string = "token-issue"
+	AuditActionAnnotationMismatch string = "annotation-mismatch"
+	AuditActionImpersonation      string = "pod-name-impersonation"
+	AuditActionOrphanCleanup      string = "orphan-cleanup"
+	AuditActionLeaseRenew         string = "lease-renew"
+	AuditActionLeaseRevoke        string = "lease-revoke"
+	AuditActionRotate             string = "credential-rotate"
+	AuditActionRegistrationRead   string = "registration-read"
+	AuditActionReconcileRead      string = "reconcile-read"
+
+	AuditDecisionAllowed string = "allowed"
+	AuditDecisionDenied  string = "denied"
+	AuditDecisionFailed  string = "failed"
+)
+
+// AuditEvent is a single security relevant decision made by solon
+type AuditEvent struct {
+	Time      time.Time `json:"time"`
+	Action    string    `json:"action"`
+	Decision  string    `json:"decision"`
+	Pod       string    `json:"pod"`
+	Namespace string    `json:"namespace"`
+	RequestID string    `json:"requestId,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+func (a *AuditEvent) Marshal() ([]byte, error) {
+	return json.Marshal(a)
+}
+
+// AuditSink is a destination for audit events
+type AuditSink interface {
+	Name() string
+	Write(event AuditEvent) error
+}
+
+// auditQueueSize is how many events wait for the sinks before new ones are dropped
+const auditQueueSize int = 512
+
+// Auditor fans every event out to the configured sinks from its own goroutine, a slow or failing sink is logged
+// and never blocks a request
+type Auditor struct {
+	sinks  []AuditSink
+	events chan AuditEvent
+	done   chan struct{}
+	mu     sync.RWMutex
+	closed bool
+}
+
+func NewAuditor(sinks ...AuditSink) *Auditor {
+	auditor := &Auditor{
+		sinks:  sinks,
+		events: make(chan AuditEvent, auditQueueSize),
+		done:   make(chan struct{}),
+	}
+
+	go auditor.deliver()
+	return auditor
+}
+
+// Record queues the event for the sinks, an event that does not fit in the queue is logged and dropped.
+// A nil or closed Auditor discards events
+func (a *Auditor) Record(event AuditEvent) {
+	if a == nil {
+		return
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.closed {
+		return
+	}
+
+	select {
+	case a.events <- event:
+	default:
+		logging.Error(fmt.Sprintf("audit queue is full, dropped %s event of %s/%s: %s", event.Action, event.Namespace, event.Pod, event.Decision))
+	}
+}
+
+// Close stops taking events and waits until the queued ones are written to the sinks
+func (a *Auditor) Close() {
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.events)
+	}
+	a.mu.Unlock()
+
+	<-a.done
+}
+
+func (a *Auditor) deliver() {
+	defer close(a.done)
+
+	for event := range a.events {
+		for _, sink := range a.sinks {
+			err := sink.Write(event)
+			if err != nil {
+				logging.Error(fmt.Sprintf("failed to write audit event %s to sink %s: %s", event.Action, sink.Name(), err.Error()))
+			}
+		}
+	}
+}
+
+// elasticIndex returns the index audit events are stored in, false when no elastic sink is configured
+func (a *Auditor) elasticIndex() (string, bool) {
+	if a == nil {
+		return "", false
+	}
+
+	for _, sink := range a.sinks {
+		if elasticSink, ok := sink.(*ElasticSink); ok {
+			return elasticSink.index, true
+		}
+	}
+
+	return "", false
+}
+
+// StdoutSink writes every event as a single line of json
+type StdoutSink struct {
+	out io.Writer
+}
+
+func NewStdoutSink(out io.Writer) *StdoutSink {
+	return &StdoutSink{out: out}
+}
+
+func (s *StdoutSink) Name() string {
+	return AuditSinkStdout
+}
+
+func (s *StdoutSink) Write(event AuditEvent) error {
+	line, err := event.Marshal()
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(s.out, string(line))
+	return err
+}
+
+// ElasticSink stores every event as a document in an index
+type ElasticSink struct {
+	client aristoteles.Client
+	index  string
+}
+
+func NewElasticSink(client aristoteles.Client, index string) *ElasticSink {
+	return &ElasticSink{client: client, index: index}
+}
+
+func (e *ElasticSink) Name() string {
+	return AuditSinkElastic
+}
+
+func (e *ElasticSink) Write(event AuditEvent) error {
+	body, err := event.Marshal()
+	if err != nil {
+		return err
+	}
+
+	_, err = e.client.Document().Create(e.index, body)
+	return err
+}
+
+// WebhookSink posts every event to an http endpoint such as a chat integration
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookSink(url string) *WebhookSink {
+	return &WebhookSink{url: url, client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+func (w *WebhookSink) Name() string {
+	return AuditSinkWebhook
+}
+
+func (w *WebhookSink) Write(event AuditEvent) error {
+	body, err := event.Marshal()
+	if err != nil {
+		return err
+	}
+
+	response, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("webhook returned status %d", response.StatusCode)
+	}
+
+	return nil
+}
+
+// auditorFromEnv builds the auditor from a comma separated list of sinks
+func auditorFromEnv(sinkNames, index, webhook string, elastic aristoteles.Client) (*Auditor, error) {
+	var sinks []AuditSink
+	for _, name := range strings.Split(sinkNames, ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+			continue
+		case AuditSinkStdout:
+			sinks = append(sinks, NewStdoutSink(os.Stdout))
+		case AuditSinkElastic:
+			sinks = append(sinks, NewElasticSink(elastic, index))
+		case AuditSinkWebhook:
+			if webhook == "" {
+				return nil, fmt.Errorf("audit sink %s requires %s to be set", AuditSinkWebhook, EnvAuditWebhook)
+			}
+			sinks = append(sinks, NewWebhookSink(webhook))
+		default:
+			return nil, fmt.Errorf("unknown audit sink: %s", name)
+		}
+	}
+
+	return NewAuditor(sinks...), nil
+}
+
+// audit records an event for a pod, the namespace is empty when the caller could not be identified
+func (s *SolonHandler) audit(action, decision string, pod podRef, requestId, reason string) {
+	s.Audit.Record(AuditEvent{
+		Action:    action,
+		Decision:  decision,
+		Pod:       pod.Name,
+		Namespace: pod.Namespace,
+		RequestID: requestId,
+		Reason:    reason,
+	})
+}
@@ -0,0 +1,210 @@
+package lawgiver
+
+import (
+	"bytes"
+	"encoding/json"
+	elastic "github.com/odysseia-greek/agora/aristoteles"
+	delphi "github.com/odysseia-greek/delphi/solon/models"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type memorySink struct {
+	events []AuditEvent
+}
+
+func (m *memorySink) Name() string {
+	return "memory"
+}
+
+func (m *memorySink) Write(event AuditEvent) error {
+	m.events = append(m.events, event)
+	return nil
+}
+
+// blockingSink holds every write until it is released
+type blockingSink struct {
+	release chan struct{}
+	written int
+}
+
+func (b *blockingSink) Name() string {
+	return "blocking"
+}
+
+func (b *blockingSink) Write(event AuditEvent) error {
+	<-b.release
+	b.written++
+	return nil
+}
+
+func TestAuditSinks(t *testing.T) {
+	event := AuditEvent{
+		Action:    AuditActionAnnotationMismatch,
+		Decision:  AuditDecisionDenied,
+		Pod:       "sokrates-5d8f7c9b4-abcde",
+		Namespace: "test",
+		RequestID: "d9b0f5a4",
+		Reason:    "illegal action detected",
+	}
+
+	t.Run("Stdout", func(t *testing.T) {
+		var out bytes.Buffer
+		auditor := NewAuditor(NewStdoutSink(&out))
+		auditor.Record(event)
+		auditor.Close()
+
+		var sut AuditEvent
+		err := json.Unmarshal(out.Bytes(), &sut)
+		assert.Nil(t, err)
+		assert.Equal(t, event.Pod, sut.Pod)
+		assert.Equal(t, event.Decision, sut.Decision)
+		assert.False(t, sut.Time.IsZero())
+	})
+
+	t.Run("Webhook", func(t *testing.T) {
+		var received AuditEvent
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			json.Unmarshal(body, &received)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		err := NewWebhookSink(server.URL).Write(event)
+		assert.Nil(t, err)
+		assert.Equal(t, event.Action, received.Action)
+		assert.Equal(t, event.RequestID, received.RequestID)
+	})
+
+	t.Run("WebhookRejects", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer server.Close()
+
+		err := NewWebhookSink(server.URL).Write(event)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Elastic", func(t *testing.T) {
+		mockElasticClient, err := elastic.NewMockClient("createDocument", 200)
+		assert.Nil(t, err)
+
+		err = NewElasticSink(mockElasticClient, defaultAuditIndex).Write(event)
+		assert.Nil(t, err)
+	})
+
+	t.Run("SlowSinkDoesNotBlock", func(t *testing.T) {
+		release := make(chan struct{})
+		sink := &blockingSink{release: release}
+		auditor := NewAuditor(sink)
+
+		started := time.Now()
+		for i := 0; i < auditQueueSize+10; i++ {
+			auditor.Record(event)
+		}
+		assert.Less(t, time.Since(started), time.Second)
+
+		close(release)
+		auditor.Close()
+		assert.LessOrEqual(t, sink.written, auditQueueSize+1, "events that did not fit in the queue are dropped")
+
+		auditor.Record(event)
+		assert.LessOrEqual(t, sink.written, auditQueueSize+1, "a closed auditor discards events")
+	})
+
+	t.Run("NilAuditorDiscards", func(t *testing.T) {
+		var auditor *Auditor
+		auditor.Record(event)
+	})
+
+	t.Run("FromEnv", func(t *testing.T) {
+		auditor, err := auditorFromEnv("stdout, webhook", defaultAuditIndex, "http://localhost:8080/hook", nil)
+		assert.Nil(t, err)
+		assert.Len(t, auditor.sinks, 2)
+	})
+
+	t.Run("FromEnvWebhookWithoutUrl", func(t *testing.T) {
+		_, err := auditorFromEnv("webhook", defaultAuditIndex, "", nil)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("FromEnvUnknownSink", func(t *testing.T) {
+		_, err := auditorFromEnv("slack", defaultAuditIndex, "", nil)
+		assert.NotNil(t, err)
+	})
+}
+
+func TestAuditOnRegister(t *testing.T) {
+	ns := "test"
+	creationRequest := delphi.SolonCreationRequest{
+		Role:     "api",
+		Access:   []string{"dictionary"},
+		PodName:  "sokrates-5d8f7c9b4-abcde",
+		Username: "sokratesabcde",
+	}
+
+	t.Run("ImpersonationIsAudited", func(t *testing.T) {
+		sink := &memorySink{}
+		pods := newTestPodCache()
+		err := addPodForTest("alkibiades-7c9b4d8f5-fghij", ns, "dictionary", "api", pods)
+		assert.Nil(t, err)
+
+		testConfig := &SolonHandler{
+			Pods:             pods,
+			AuthMode:         AuthModeIP,
+			Namespace:        ns,
+			AccessAnnotation: "odysseia-greek/access",
+			RoleAnnotation:   "odysseia-greek/role",
+			Audit:            NewAuditor(sink),
+		}
+
+		jsonBody, err := creationRequest.Marshal()
+		assert.Nil(t, err)
+
+		router := InitRoutes(testConfig)
+		response := performPostRequest(router, "/solon/v1/register", bytes.NewReader(jsonBody))
+		assert.Equal(t, http.StatusForbidden, response.Code)
+
+		testConfig.Audit.Close()
+		assert.Len(t, sink.events, 1)
+		assert.Equal(t, AuditActionImpersonation, sink.events[0].Action)
+		assert.Equal(t, AuditDecisionDenied, sink.events[0].Decision)
+		assert.Equal(t, "alkibiades-7c9b4d8f5-fghij", sink.events[0].Pod)
+		assert.Equal(t, ns, sink.events[0].Namespace)
+		assert.NotEmpty(t, sink.events[0].RequestID)
+	})
+
+	t.Run("AnnotationMismatchIsAudited", func(t *testing.T) {
+		sink := &memorySink{}
+		pods := newTestPodCache()
+		err := addPodForTest(creationRequest.PodName, ns, "texts", "api", pods)
+		assert.Nil(t, err)
+
+		testConfig := &SolonHandler{
+			Pods:             pods,
+			AuthMode:         AuthModeIP,
+			Namespace:        ns,
+			AccessAnnotation: "odysseia-greek/access",
+			RoleAnnotation:   "odysseia-greek/role",
+			Audit:            NewAuditor(sink),
+		}
+
+		jsonBody, err := creationRequest.Marshal()
+		assert.Nil(t, err)
+
+		router := InitRoutes(testConfig)
+		response := performPostRequest(router, "/solon/v1/register", bytes.NewReader(jsonBody))
+		assert.Equal(t, http.StatusForbidden, response.Code)
+
+		testConfig.Audit.Close()
+		assert.Len(t, sink.events, 1)
+		assert.Equal(t, AuditActionAnnotationMismatch, sink.events[0].Action)
+		assert.Equal(t, creationRequest.PodName, sink.events[0].Pod)
+	})
+}
@@ -4,54 +4,241 @@ import (
 	"fmt"
 	"github.com/odysseia-greek/agora/plato/logging"
 	v1 "k8s.io/api/core/v1"
-	"strings"
+	"sync"
+	"time"
 )
 
+const (
+	// EnvCleanupGrace is how long solon waits after a pod is deleted before its registration is cleaned up
+	EnvCleanupGrace     string = "SOLON_CLEANUP_GRACE"
+	defaultCleanupGrace string = "30s"
+
+	// resourcesPerPod is the number of resources a registration leaves behind: a user, a vault secret and a vault policy,
+	// a pod with leased credentials can own more than one user
+	resourcesPerPod = 3
+)
+
+// CleanupScheduler holds back the cleanup of a deleted pod for the grace window, a pod that comes back under the same
+// name within the window keeps its registration. A nil CleanupScheduler cleans up as soon as a pod is deleted
+type CleanupScheduler struct {
+	Grace time.Duration
+
+	mu      sync.Mutex
+	pending map[string]*time.Timer
+}
+
+func NewCleanupScheduler(grace time.Duration) *CleanupScheduler {
+	if grace <= 0 {
+		return nil
+	}
+
+	return &CleanupScheduler{Grace: grace, pending: map[string]*time.Timer{}}
+}
+
+// schedule runs the cleanup once the grace window is over, a pod deleted again before then starts a new window
+func (c *CleanupScheduler) schedule(pod podRef, cleanup func()) {
+	if c == nil {
+		cleanup()
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := pod.String()
+	if timer, ok := c.pending[key]; ok {
+		timer.Stop()
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(c.Grace, func() {
+		c.mu.Lock()
+		if c.pending[key] == timer {
+			delete(c.pending, key)
+		}
+		c.mu.Unlock()
+
+		cleanup()
+	})
+	c.pending[key] = timer
+}
+
+// cancel drops the pending cleanup of the pod, it is true when there was one
+func (c *CleanupScheduler) cancel(pod podRef) bool {
+	if c == nil {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	timer, ok := c.pending[pod.String()]
+	if ok {
+		timer.Stop()
+		delete(c.pending, pod.String())
+	}
+
+	return ok
+}
+
+// isPending is true while the cleanup of the pod waits for the grace window to end
+func (c *CleanupScheduler) isPending(pod podRef) bool {
+	if c == nil {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.pending[pod.String()]
+	return ok
+}
+
+// Pending returns the number of pods waiting for their cleanup
+func (c *CleanupScheduler) Pending() int {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.pending)
+}
+
+// Stop drops every pending cleanup, what is left behind is found by the reconciler
+func (c *CleanupScheduler) Stop() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, timer := range c.pending {
+		timer.Stop()
+		delete(c.pending, key)
+	}
+}
+
+// cleanupDeletedPod removes the registration of a deleted pod unless a pod with the same name is back in the cache
+func (s *SolonHandler) cleanupDeletedPod(pod *v1.Pod) {
+	ref := refOf(pod.Namespace, pod.Name)
+	back, err := s.Pods.Has(pod.Namespace, pod.Name)
+	if err != nil {
+		logging.Error(fmt.Sprintf("cannot tell if %s is back, cleanup is left to the reconciler: %s", ref, err.Error()))
+		return
+	}
+
+	if back {
+		logging.System(fmt.Sprintf("%s is back within the grace window, its registration is kept", ref))
+		return
+	}
+
+	err = s.deleteOrphans(pod)
+	if err != nil {
+		logging.Error(err.Error())
+	}
+}
+
+// deleteOrphans removes the user, secret and policy of a pod, only a registration made by this pod is removed
 func (s *SolonHandler) deleteOrphans(pod *v1.Pod) error {
-	// Identify orphaned Elastic users
 	numberOfCleanedResource := 0
+	ref := refOf(pod.Namespace, pod.Name)
+
+	// the usernames are read back from the registration before the secret holding them is removed
+	data, err := s.readRegistrationData(ref.secretName())
+	if err != nil {
+		return fmt.Errorf("failed to read registration of %s, cleanup is left to the reconciler: %w", ref, err)
+	}
 
-	splitPodName := strings.Split(pod.Name, "-")
-	var username string
-	//this logic is from periandros because elastic does not accept hyphem in a username
-	if len(splitPodName) > 1 {
-		username = splitPodName[0] + splitPodName[len(splitPodName)-1]
+	if data == nil || data.Registration == nil {
+		logging.Debug(fmt.Sprintf("%s has no registration, there is nothing to clean up", ref))
+		return nil
+	}
+
+	if uid := data.Registration.PodUID; uid != "" && pod.UID != "" && uid != string(pod.UID) {
+		logging.System(fmt.Sprintf("registration of %s belongs to pod uid %s and not to the deleted pod %s, it is kept", ref, uid, pod.UID))
+		return nil
+	}
+
+	usernames := data.ownedUsernames(pod.Name)
+	expectedResources := resourcesPerPod - 1 + len(usernames)
+	if len(usernames) == 0 {
+		logging.Debug(fmt.Sprintf("no user owned by %s", ref))
+	} else if provider, err := s.providerOfRegistration(data); err != nil {
+		logging.Error(fmt.Sprintf("users of %s are left in place: %s", ref, err.Error()))
 	} else {
-		username = splitPodName[0]
+		for _, username := range usernames {
+			if s.removeUser(provider, username) == nil {
+				numberOfCleanedResource++
+			}
+		}
+	}
+
+	if s.removeVaultSecret(ref.secretName()) == nil {
+		numberOfCleanedResource++
+	}
+
+	if s.removeVaultPolicy(ref.policyName()) == nil {
+		numberOfCleanedResource++
 	}
 
-	_, err := s.Elastic.Access().DeleteUser(username)
+	logging.System(fmt.Sprintf("finished cleanup service and cleaned up %d resources", numberOfCleanedResource))
+
+	decision := AuditDecisionAllowed
+	if numberOfCleanedResource < expectedResources {
+		decision = AuditDecisionFailed
+	}
+	s.audit(AuditActionOrphanCleanup, decision, ref, "", fmt.Sprintf("cleaned up %d of %d resources", numberOfCleanedResource, expectedResources))
+
+	return nil
+}
+
+func (s *SolonHandler) removeUser(provider CredentialProvider, username string) error {
+	err := s.deleteUser(provider, username)
+	s.Metrics.OrphanCleanup(userResource(provider.Name()), err)
 	if err != nil {
 		logging.Error(fmt.Sprintf("failed to delete orphaned user: %s, %s", username, err.Error()))
-	} else {
-		logging.System(fmt.Sprintf("deleted orphan user in elastic: %s", username))
-		numberOfCleanedResource++
+		return err
 	}
 
-	err = s.Vault.DeleteSecret(pod.Name)
+	logging.System(fmt.Sprintf("deleted orphan user in %s: %s", provider.Name(), username))
+	return nil
+}
+
+func (s *SolonHandler) removeVaultSecret(name string) error {
+	err := s.Metrics.timeVault("delete_secret", func() error {
+		return s.Vault.DeleteSecret(name)
+	})
 	if err != nil {
-		logging.Error(fmt.Sprintf("failed to delete orphaned secret: %s, %s", pod.Name, err.Error()))
+		logging.Error(fmt.Sprintf("failed to delete orphaned secret: %s, %s", name, err.Error()))
 	}
 
-	err = s.Vault.RemoveSecret(pod.Name)
+	err = s.Metrics.timeVault("remove_secret", func() error {
+		return s.Vault.RemoveSecret(name)
+	})
+	s.Metrics.OrphanCleanup(OrphanResourceVaultSecret, err)
 	if err != nil {
-		logging.Error(fmt.Sprintf("failed to remove orphaned secret: %s, %s", pod.Name, err.Error()))
-	} else {
-		logging.System(fmt.Sprintf("deleted orphan secret: %s", pod.Name))
-		numberOfCleanedResource++
+		logging.Error(fmt.Sprintf("failed to remove orphaned secret: %s, %s", name, err.Error()))
+		return err
 	}
 
-	policy := fmt.Sprintf("policy-%s", pod.Name)
+	logging.System(fmt.Sprintf("deleted orphan secret: %s", name))
+	return nil
+}
 
-	deletedPolicy, err := s.Vault.DeletePolicy(policy)
-	if err != nil || deletedPolicy != nil {
+func (s *SolonHandler) removeVaultPolicy(policy string) error {
+	err := s.Metrics.timeVault("delete_policy", func() error {
+		_, err := s.Vault.DeletePolicy(policy)
+		return err
+	})
+	s.Metrics.OrphanCleanup(OrphanResourceVaultPolicy, err)
+	if err != nil {
 		logging.Error(fmt.Sprintf("failed to delete orphaned policy: %s, %s", policy, err.Error()))
-	} else {
-		logging.System(fmt.Sprintf("deleted orphan policy: %s", policy))
-		numberOfCleanedResource++
+		return err
 	}
 
-	logging.System(fmt.Sprintf("finished cleanup service and cleaned up %d resources", numberOfCleanedResource))
-
+	logging.System(fmt.Sprintf("deleted orphan policy: %s", policy))
 	return nil
 }
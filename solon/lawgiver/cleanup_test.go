@@ -0,0 +1,168 @@
+package lawgiver
+
+import (
+	elastic "github.com/odysseia-greek/agora/aristoteles"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/tools/cache"
+	"testing"
+	"time"
+)
+
+func TestDeleteOrphans(t *testing.T) {
+	ns := "test"
+	podName := "sokrates-5d8f7c9b4-abcde"
+	ref := refOf(ns, podName)
+
+	t.Run("RemovesTheRegisteredUser", func(t *testing.T) {
+		sink := &memorySink{}
+		vault := &fakeVault{
+			secrets: map[string]map[string]interface{}{
+				ref.secretName(): {
+					"elasticUsername": "socrates",
+					"registration":    map[string]interface{}{"podName": podName, "username": "socrates"},
+				},
+			},
+		}
+
+		mockElasticClient, err := elastic.NewMockClient([][]byte{[]byte(`{"found":true}`)}, 200)
+		assert.Nil(t, err)
+
+		handler := &SolonHandler{Vault: vault, Elastic: mockElasticClient, Namespace: ns, Audit: NewAuditor(sink)}
+		err = handler.deleteOrphans(runningPodForTest(podName, ns, "dictionary", "api"))
+		assert.Nil(t, err)
+
+		assert.ElementsMatch(t, []string{"test/sokrates-5d8f7c9b4-abcde", "policy.test.sokrates-5d8f7c9b4-abcde"}, vault.removed)
+		handler.Audit.Close()
+		assert.Len(t, sink.events, 1)
+		assert.Equal(t, AuditDecisionAllowed, sink.events[0].Decision)
+		assert.Equal(t, "cleaned up 3 of 3 resources", sink.events[0].Reason)
+	})
+
+	t.Run("KeepsASharedUser", func(t *testing.T) {
+		sink := &memorySink{}
+		vault := &fakeVault{
+			secrets: map[string]map[string]interface{}{
+				ref.secretName(): {
+					"elasticUsername": "agreus",
+					"registration":    map[string]interface{}{"podName": podName, "username": "agreus", "sharedUsername": true},
+				},
+			},
+		}
+
+		handler := &SolonHandler{Vault: vault, Namespace: ns, Audit: NewAuditor(sink)}
+		err := handler.deleteOrphans(runningPodForTest(podName, ns, "dictionary", "api"))
+		assert.Nil(t, err)
+
+		assert.ElementsMatch(t, []string{"test/sokrates-5d8f7c9b4-abcde", "policy.test.sokrates-5d8f7c9b4-abcde"}, vault.removed)
+		handler.Audit.Close()
+		assert.Equal(t, "cleaned up 2 of 2 resources", sink.events[0].Reason)
+	})
+	t.Run("KeepsASecretWithoutRegistration", func(t *testing.T) {
+		sink := &memorySink{}
+		vault := &fakeVault{
+			secrets: map[string]map[string]interface{}{
+				ref.secretName(): {"elasticUsername": "socrates"},
+			},
+		}
+
+		handler := &SolonHandler{Vault: vault, Namespace: ns, Audit: NewAuditor(sink)}
+		err := handler.deleteOrphans(runningPodForTest(podName, ns, "dictionary", "api"))
+		assert.Nil(t, err)
+
+		assert.Empty(t, vault.removed)
+		handler.Audit.Close()
+		assert.Empty(t, sink.events)
+	})
+
+	t.Run("KeepsTheRegistrationOfAnotherPod", func(t *testing.T) {
+		vault := &fakeVault{
+			secrets: map[string]map[string]interface{}{
+				ref.secretName(): {
+					"elasticUsername": "socrates",
+					"registration":    map[string]interface{}{"podName": podName, "podUid": "uid-of-the-new-pod", "username": "socrates"},
+				},
+			},
+		}
+
+		pod := runningPodForTest(podName, ns, "dictionary", "api")
+		pod.UID = "uid-of-the-deleted-pod"
+
+		handler := &SolonHandler{Vault: vault, Namespace: ns}
+		err := handler.deleteOrphans(pod)
+		assert.Nil(t, err)
+		assert.Empty(t, vault.removed)
+	})
+
+	t.Run("PodIsBackAfterTheGrace", func(t *testing.T) {
+		vault := &fakeVault{
+			secrets: map[string]map[string]interface{}{
+				ref.secretName(): {
+					"elasticUsername": "agreus",
+					"registration":    map[string]interface{}{"podName": podName, "username": "agreus", "sharedUsername": true},
+				},
+			},
+		}
+
+		pods := newTestPodCache()
+		pod := runningPodForTest(podName, ns, "dictionary", "api")
+		assert.Nil(t, pods.indexer.Add(pod))
+
+		handler := &SolonHandler{Vault: vault, Pods: pods, Namespace: ns}
+		handler.cleanupDeletedPod(pod)
+		assert.Empty(t, vault.removed)
+
+		assert.Nil(t, pods.indexer.Delete(pod))
+		handler.cleanupDeletedPod(pod)
+		assert.Len(t, vault.removed, 2)
+	})
+
+	t.Run("DeletedPodWaitsForTheGrace", func(t *testing.T) {
+		vault := &fakeVault{}
+		handler := &SolonHandler{
+			Vault:     vault,
+			Pods:      newTestPodCache(),
+			Namespace: ns,
+			Cleanup:   NewCleanupScheduler(time.Hour),
+		}
+		defer handler.Cleanup.Stop()
+
+		events := handler.handlePodEvents()
+		pod := runningPodForTest(podName, ns, "dictionary", "api")
+
+		events.OnDelete(cache.DeletedFinalStateUnknown{Key: ref.String(), Obj: pod})
+		assert.Equal(t, 1, handler.Cleanup.Pending(), "a tombstone is cleaned up like a pod")
+
+		events.OnDelete(pod)
+		assert.Equal(t, 1, handler.Cleanup.Pending(), "a second delete starts the window again")
+
+		events.OnAdd(pod, false)
+		assert.Equal(t, 0, handler.Cleanup.Pending(), "a pod added under the same name cancels the cleanup")
+
+		events.OnDelete(runningPodForTest(podName, "elsewhere", "dictionary", "api"))
+		events.OnDelete("not a pod")
+		assert.Equal(t, 0, handler.Cleanup.Pending())
+		assert.Empty(t, vault.removed)
+	})
+
+	t.Run("SchedulerRunsAfterTheGrace", func(t *testing.T) {
+		scheduler := NewCleanupScheduler(10 * time.Millisecond)
+		done := make(chan struct{})
+		scheduler.schedule(ref, func() { close(done) })
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("cleanup did not run after the grace window")
+		}
+		assert.Equal(t, 0, scheduler.Pending())
+	})
+
+	t.Run("WithoutGrace", func(t *testing.T) {
+		assert.Nil(t, NewCleanupScheduler(0))
+
+		var scheduler *CleanupScheduler
+		ran := false
+		scheduler.schedule(ref, func() { ran = true })
+		assert.True(t, ran, "a nil scheduler cleans up right away")
+	})
+}
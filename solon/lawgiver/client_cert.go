@@ -0,0 +1,48 @@
+package lawgiver
+
+import (
+	"fmt"
+	delphi "github.com/odysseia-greek/delphi/solon/models"
+	v1 "k8s.io/api/core/v1"
+	"net/http"
+)
+
+const (
+	// EnvRequireClientCert makes every pod present a client certificate signed by the perikles ca, it needs TLS
+	EnvRequireClientCert string = "SOLON_REQUIRE_CLIENT_CERT"
+
+	// DefaultHostAnnotation is the annotation perikles issues a certificate for, the certificate holds the host
+	// in the forms <host>, <host>.<namespace>, <host>.<namespace>.svc and <host>.<namespace>.svc.cluster.local
+	DefaultHostAnnotation string = "perikles/hostname"
+)
+
+// verifyClientCertificate checks that the certificate the request was made with belongs to the pod, the chain has been
+// verified against the ca during the handshake so only the SAN is left to compare with the host annotation of the pod
+func (s *SolonHandler) verifyClientCertificate(req *http.Request, pod *v1.Pod) error {
+	if !s.RequireClientCert {
+		return nil
+	}
+
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return newSolonError(delphi.ErrorCodeUnauthenticated, "certificate", fmt.Errorf("no verified client certificate was presented"))
+	}
+
+	annotation := s.HostAnnotation
+	if annotation == "" {
+		annotation = DefaultHostAnnotation
+	}
+
+	host := pod.Annotations[annotation]
+	if host == "" {
+		return newSolonError(delphi.ErrorCodeUnauthenticated, "certificate", fmt.Errorf("pod %s has no %s annotation to match a client certificate with", pod.Name, annotation))
+	}
+
+	// the namespaced name keeps a pod from using the certificate of a host with the same name in another namespace
+	cert := req.TLS.VerifiedChains[0][0]
+	name := fmt.Sprintf("%s.%s.svc", host, pod.Namespace)
+	if err := cert.VerifyHostname(name); err != nil {
+		return newSolonError(delphi.ErrorCodeUnauthenticated, "certificate", fmt.Errorf("client certificate of %s is not valid for pod %s: %w", cert.Subject.CommonName, pod.Name, err))
+	}
+
+	return nil
+}
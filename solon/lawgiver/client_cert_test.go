@@ -0,0 +1,238 @@
+package lawgiver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	delphi "github.com/odysseia-greek/delphi/solon/models"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientCertificates(t *testing.T) {
+	ns := "test"
+	podName := "sokrates-5d8f7c9b4-abcde"
+
+	perikles := newTestCA(t, "perikles")
+	impostor := newTestCA(t, "impostor")
+
+	newServer := func(t *testing.T, host string) *httptest.Server {
+		pods := newTestPodCache()
+		pod := runningPodForTest(podName, ns, "dictionary", "api")
+		pod.Status.PodIP = "127.0.0.1"
+		if host != "" {
+			pod.Annotations[DefaultHostAnnotation] = host
+		}
+		assert.Nil(t, pods.indexer.Add(pod))
+
+		handler := &SolonHandler{
+			Vault:             NewMemoryBackend(),
+			Pods:              pods,
+			AuthMode:          AuthModeIP,
+			Namespace:         ns,
+			AccessAnnotation:  "odysseia-greek/access",
+			RoleAnnotation:    "odysseia-greek/role",
+			RequireClientCert: true,
+			HostAnnotation:    DefaultHostAnnotation,
+		}
+
+		server := httptest.NewUnstartedServer(InitRoutes(handler))
+		server.TLS = &tls.Config{
+			ClientCAs:  perikles.pool,
+			ClientAuth: tls.VerifyClientCertIfGiven,
+		}
+		server.StartTLS()
+		t.Cleanup(server.Close)
+		return server
+	}
+
+	// the certificate is handed over even when the server does not name its ca as acceptable
+	get := func(t *testing.T, server *httptest.Server, path string, certs ...tls.Certificate) (*http.Response, error) {
+		client := server.Client()
+		client.Transport.(*http.Transport).TLSClientConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if len(certs) == 0 {
+				return &tls.Certificate{}, nil
+			}
+			return &certs[0], nil
+		}
+		return client.Get(server.URL + path)
+	}
+
+	assertUnauthenticated := func(t *testing.T, response *http.Response, message string) {
+		defer response.Body.Close()
+		var sut delphi.SolonError
+		err := json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+		assert.Equal(t, delphi.ErrorCodeUnauthenticated, sut.Code)
+		assert.Equal(t, "certificate", sut.Field)
+		assert.Contains(t, sut.Message, message)
+	}
+
+	t.Run("CertificateOfThePod", func(t *testing.T) {
+		server := newServer(t, "sokrates")
+		response, err := get(t, server, "/solon/v1/token", perikles.issue(t, "sokrates", ns))
+		assert.Nil(t, err)
+		defer response.Body.Close()
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+	})
+
+	t.Run("NoCertificate", func(t *testing.T) {
+		server := newServer(t, "sokrates")
+		response, err := get(t, server, "/solon/v1/token")
+		assert.Nil(t, err)
+		assertUnauthenticated(t, response, "no verified client certificate")
+
+		response, err = get(t, server, "/solon/v1/openapi.json")
+		assert.Nil(t, err)
+		defer response.Body.Close()
+		assert.Equal(t, http.StatusOK, response.StatusCode, "routes that do not identify a pod need no certificate")
+	})
+
+	t.Run("CertificateOfAnotherHost", func(t *testing.T) {
+		server := newServer(t, "sokrates")
+		response, err := get(t, server, "/solon/v1/token", perikles.issue(t, "platon", ns))
+		assert.Nil(t, err)
+		assertUnauthenticated(t, response, "not valid for pod")
+	})
+
+	t.Run("CertificateOfAnotherNamespace", func(t *testing.T) {
+		server := newServer(t, "sokrates")
+		response, err := get(t, server, "/solon/v1/token", perikles.issue(t, "sokrates", "staging"))
+		assert.Nil(t, err)
+		assertUnauthenticated(t, response, "not valid for pod")
+	})
+
+	t.Run("PodWithoutHostAnnotation", func(t *testing.T) {
+		server := newServer(t, "")
+		response, err := get(t, server, "/solon/v1/token", perikles.issue(t, "sokrates", ns))
+		assert.Nil(t, err)
+		assertUnauthenticated(t, response, DefaultHostAnnotation)
+	})
+
+	t.Run("PodOnARouteForAdmins", func(t *testing.T) {
+		admin := "system:serviceaccount:odysseia:drakon"
+		pods := newTestPodCache()
+		pod := runningPodForTest(podName, ns, "dictionary", "api")
+		pod.UID = "d9b0f5a4-8e8c-4b4c-a1a4-0c7d6f1f2a11"
+		pod.Spec.ServiceAccountName = "sokrates"
+		pod.Annotations[DefaultHostAnnotation] = "sokrates"
+		assert.Nil(t, pods.indexer.Add(pod))
+
+		handler := &SolonHandler{
+			Vault:             NewMemoryBackend(),
+			Pods:              pods,
+			AuthMode:          AuthModeServiceAccount,
+			TokenReviewer:     fakeTokenReviewer(true, "system:serviceaccount:test:sokrates", podName, string(pod.UID)),
+			Admins:            []string{admin},
+			Namespace:         ns,
+			RequireClientCert: true,
+			HostAnnotation:    DefaultHostAnnotation,
+		}
+
+		server := httptest.NewUnstartedServer(InitRoutes(handler))
+		server.TLS = &tls.Config{ClientCAs: perikles.pool, ClientAuth: tls.VerifyClientCertIfGiven}
+		server.StartTLS()
+		t.Cleanup(server.Close)
+
+		getWithToken := func(certs ...tls.Certificate) (*http.Response, error) {
+			req, err := http.NewRequest(http.MethodGet, server.URL+"/solon/v1/registrations", nil)
+			assert.Nil(t, err)
+			req.Header.Set("Authorization", "Bearer pod-token")
+			// every request gets its own handshake so it presents its own certificate
+			req.Close = true
+
+			client := server.Client()
+			client.Transport.(*http.Transport).TLSClientConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				if len(certs) == 0 {
+					return &tls.Certificate{}, nil
+				}
+				return &certs[0], nil
+			}
+			return client.Do(req)
+		}
+
+		response, err := getWithToken()
+		assert.Nil(t, err)
+		assertUnauthenticated(t, response, "no verified client certificate")
+
+		response, err = getWithToken(perikles.issue(t, "platon", ns))
+		assert.Nil(t, err)
+		assertUnauthenticated(t, response, "not valid for pod")
+
+		response, err = getWithToken(perikles.issue(t, "sokrates", ns))
+		assert.Nil(t, err)
+		defer response.Body.Close()
+		assert.Equal(t, http.StatusForbidden, response.StatusCode, "a verified pod is still no admin")
+	})
+
+	t.Run("CertificateOfAnotherCA", func(t *testing.T) {
+		server := newServer(t, "sokrates")
+		_, err := get(t, server, "/solon/v1/token", impostor.issue(t, "sokrates", ns))
+		assert.NotNil(t, err, "the handshake fails for a certificate that is not signed by the ca")
+	})
+}
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// issue signs a client certificate with the names perikles puts in the certificate of a host
+func (c *testCA) issue(t *testing.T, host, ns string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		DNSNames: []string{
+			host,
+			fmt.Sprintf("%s.%s", host, ns),
+			fmt.Sprintf("%s.%s.svc", host, ns),
+			fmt.Sprintf("%s.%s.svc.cluster.local", host, ns),
+		},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, c.cert, &key.PublicKey, c.key)
+	assert.Nil(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
@@ -4,21 +4,34 @@ import (
 	"context"
 	"fmt"
 	"github.com/odysseia-greek/agora/aristoteles"
-	"github.com/odysseia-greek/agora/diogenes"
 	"github.com/odysseia-greek/agora/plato/config"
 	"github.com/odysseia-greek/agora/plato/logging"
 	kubernetes "github.com/odysseia-greek/agora/thales"
 	aristophanes "github.com/odysseia-greek/attike/aristophanes/comedy"
-	"os"
+	"k8s.io/client-go/informers"
+	k8s "k8s.io/client-go/kubernetes"
+	"time"
 )
 
 func CreateNewConfig(ctx context.Context) (*SolonHandler, error) {
-	vault, err := diogenes.CreateVaultClient(true)
+	vault, err := secretBackendFromEnv(
+		config.StringFromEnv(EnvSecretBackend, defaultSecretBackend),
+		config.StringFromEnv(EnvSecretFile, ""),
+		config.StringFromEnv(EnvSecretFileKey, ""),
+	)
 	if err != nil {
 		return nil, err
 	}
 
+	if _, ok := vault.(namespacedSecretLister); !ok {
+		return nil, fmt.Errorf("secret backend %T cannot list secrets below a path, registrations per namespace would not be found", vault)
+	}
+
 	tls := config.BoolFromEnv(config.EnvTlSKey)
+	requireClientCert := config.BoolFromEnv(EnvRequireClientCert)
+	if requireClientCert && !tls {
+		return nil, fmt.Errorf("%s needs TLS to be enabled", EnvRequireClientCert)
+	}
 
 	kube, err := kubernetes.CreateKubeClient(false)
 	if err != nil {
@@ -44,36 +57,165 @@ func CreateNewConfig(ctx context.Context) (*SolonHandler, error) {
 		return nil, err
 	}
 
+	elasticCluster, err := newElasticClusterHealth(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	providers, err := credentialProvidersFromEnv(config.StringFromEnv(EnvCredentialProviders, defaultCredentialProviders), elastic, config.StringFromEnv)
+	if err != nil {
+		return nil, err
+	}
+
 	ns := config.StringFromEnv(config.EnvNamespace, config.DefaultNamespace)
 
-	tracer, err := aristophanes.NewClientTracer(aristophanes.DefaultAddress)
+	authMode := config.StringFromEnv(EnvAuthMode, AuthModeServiceAccount)
+	if authMode != AuthModeServiceAccount && authMode != AuthModeIP {
+		return nil, fmt.Errorf("unknown auth mode %s, expected %s or %s", authMode, AuthModeServiceAccount, AuthModeIP)
+	}
+
+	if authMode == AuthModeIP {
+		logging.System(fmt.Sprintf("pod verification is matching the remote address, unset %s to authenticate callers with their serviceaccount token", EnvAuthMode))
+	}
+
+	admins, err := parseAdminServiceAccounts(config.StringFromEnv(EnvAdminServiceAccounts, ""))
+	if err != nil {
+		return nil, err
+	}
+
+	clientset, err := k8s.NewForConfig(kube.RestConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	// a single namespace keeps the informers namespaced, serving more than one needs a cluster wide watch
+	namespaces := splitCommaList(config.StringFromEnv(EnvNamespaces, ns))
+	namespaceSelector := config.StringFromEnv(EnvNamespaceSelector, "")
+	var informerOptions []informers.SharedInformerOption
+	if namespaceSelector == "" && len(namespaces) == 1 {
+		informerOptions = append(informerOptions, informers.WithNamespace(namespaces[0]))
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 30*time.Second, informerOptions...)
+	scope, err := namespaceScopeFromEnv(namespaces, namespaceSelector, factory)
+	if err != nil {
+		return nil, err
+	}
+
+	logging.System(fmt.Sprintf("serving pods in %s", scope))
+
+	pods, err := newPodCache(factory.Core().V1().Pods().Informer())
+	if err != nil {
+		return nil, err
+	}
+
+	auditor, err := auditorFromEnv(
+		config.StringFromEnv(EnvAuditSinks, defaultAuditSinks),
+		config.StringFromEnv(EnvAuditIndex, defaultAuditIndex),
+		config.StringFromEnv(EnvAuditWebhook, ""),
+		elastic,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	reconcileInterval, err := time.ParseDuration(config.StringFromEnv(EnvReconcileInterval, defaultReconcileInterval))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", EnvReconcileInterval, err)
+	}
+
+	cleanupGrace, err := time.ParseDuration(config.StringFromEnv(EnvCleanupGrace, defaultCleanupGrace))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", EnvCleanupGrace, err)
+	}
+
+	credentialTTL, err := time.ParseDuration(config.StringFromEnv(EnvCredentialTTL, defaultCredentialTTL))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", EnvCredentialTTL, err)
+	}
+
+	shutdownDelay, err := time.ParseDuration(config.StringFromEnv(EnvShutdownDelay, defaultShutdownDelay))
+	if err != nil || shutdownDelay < 0 {
+		return nil, fmt.Errorf("invalid %s %q, expected a duration of zero or more", EnvShutdownDelay, config.StringFromEnv(EnvShutdownDelay, defaultShutdownDelay))
+	}
+
+	limiter, err := tokenLimiterFromEnv(
+		config.StringFromEnv(EnvTokenRatePerPod, defaultTokenRatePerPod),
+		config.StringFromEnv(EnvTokenBurstPerPod, defaultTokenBurstPerPod),
+		config.StringFromEnv(EnvTokenRateGlobal, defaultTokenRateGlobal),
+		config.StringFromEnv(EnvTokenBurstGlobal, defaultTokenBurstGlobal),
+		config.StringFromEnv(EnvMaxOutstandingTokens, defaultMaxOutstandingTokens),
+		config.StringFromEnv(EnvOutstandingTokenTTL, defaultOutstandingTokenTTL),
+	)
 	if err != nil {
-		logging.Error(err.Error())
+		return nil, err
 	}
 
-	healthy := tracer.WaitForHealthyState()
-	if !healthy {
-		logging.Debug("tracing service not ready - restarting seems the only option")
-		os.Exit(1)
+	if _, ok := vault.(tokenLookup); !ok && limiter.MaxOutstanding > 0 {
+		logging.Warn(fmt.Sprintf("secret backend %T cannot look up tokens, %s is not applied", vault, EnvMaxOutstandingTokens))
 	}
 
-	streamer, err := tracer.Chorus(ctx)
+	tokenLimits, err := tokenLimitsFromEnv(
+		config.StringFromEnv(EnvTokenMaxTTL, defaultTokenMaxTTL),
+		config.StringFromEnv(EnvTokenMaxUses, defaultTokenMaxUses),
+		config.StringFromEnv(EnvTokenWrapTTL, defaultTokenWrapTTL),
+	)
 	if err != nil {
-		logging.Error(err.Error())
+		return nil, err
 	}
 
+	// the trace stream lives as long as the handler, Close cancels it on shutdown
 	ctx, cancel := context.WithCancel(ctx)
+	tracer, err := newTracer(ctx, config.StringFromEnv(EnvTracingMode, defaultTracingMode), aristophanes.DefaultAddress)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	cleanup := NewCleanupScheduler(cleanupGrace)
+
+	metrics := NewMetrics()
+	metrics.Gauge(metricPodCacheSize, "Pods held in the informer cache.", func() float64 {
+		return float64(pods.Size())
+	})
+	metrics.Gauge(metricPendingCleanups, "Deleted pods waiting for the grace window before their cleanup.", func() float64 {
+		return float64(cleanup.Pending())
+	})
 
 	return &SolonHandler{
-		Vault:            vault,
-		Elastic:          elastic,
-		ElasticCert:      []byte(cert),
-		Kube:             kube,
-		Namespace:        ns,
-		AccessAnnotation: config.DefaultAccessAnnotation,
-		RoleAnnotation:   config.DefaultRoleAnnotation,
-		TLSEnabled:       tls,
-		Streamer:         streamer,
-		Cancel:           cancel,
+		Vault:              vault,
+		Elastic:            elastic,
+		ElasticCluster:     elasticCluster,
+		ElasticCert:        []byte(cert),
+		Kube:               kube,
+		KubeAPI:            clientset.Discovery(),
+		TokenReviewer:      clientset.AuthenticationV1().TokenReviews(),
+		Informers:          factory,
+		Pods:               pods,
+		AuthMode:           authMode,
+		TokenAudience:      config.StringFromEnv(EnvTokenAudience, ""),
+		Admins:             admins,
+		Namespace:          ns,
+		Namespaces:         scope,
+		AccessAnnotation:   config.DefaultAccessAnnotation,
+		RoleAnnotation:     config.DefaultRoleAnnotation,
+		ProviderAnnotation: DefaultProviderAnnotation,
+		Providers:          providers,
+		TLSEnabled:         tls,
+		RequireClientCert:  requireClientCert,
+		HostAnnotation:     DefaultHostAnnotation,
+		UsernameAnnotation: DefaultUsernameAnnotation,
+		SharedUsernames:    splitCommaList(config.StringFromEnv(EnvSharedUsernames, config.DefaultTracingName)),
+		Tracer:             tracer,
+		Cancel:             cancel,
+		Audit:              auditor,
+		Metrics:            metrics,
+		Reconciler:         NewReconciler(reconcileInterval, config.BoolFromEnv(EnvReconcileDryRun)),
+		Cleanup:            cleanup,
+		Policies:           NewPolicyTemplates(config.StringFromEnv(EnvPolicyConfigMap, defaultPolicyConfigMap)),
+		Leases:             NewLeaseManager(credentialTTL),
+		Limiter:            limiter,
+		TokenLimits:        tokenLimits,
+		ShutdownDelay:      shutdownDelay,
 	}, nil
 }
@@ -0,0 +1,167 @@
+package lawgiver
+
+import (
+	"fmt"
+	"github.com/odysseia-greek/agora/aristoteles"
+	delphi "github.com/odysseia-greek/delphi/solon/models"
+	"strings"
+)
+
+const (
+	ProviderElasticsearch string = "elasticsearch"
+	ProviderOpenSearch    string = "opensearch"
+	ProviderPostgres      string = "postgres"
+
+	// EnvCredentialProviders lists the providers solon can create users in, pods pick one with the provider annotation
+	EnvCredentialProviders     string = "SOLON_CREDENTIAL_PROVIDERS"
+	defaultCredentialProviders string = ProviderElasticsearch
+
+	// DefaultProviderAnnotation names the provider of the credentials of a pod, a pod without it gets an elasticsearch user
+	DefaultProviderAnnotation string = "odysseia-greek/credentials"
+)
+
+// Credential is a user a provider creates for a pod, the roles are the index_role names generated from the access annotation
+type Credential struct {
+	Username string
+	Password string
+	Roles    []string
+	// Owner is the username of the registration, the user of a lease carries a suffix on top of it
+	Owner string
+}
+
+// CredentialProvider creates the users pods log in with, every provider keeps the register, rotate and token flow the same
+type CredentialProvider interface {
+	Name() string
+	// CreateUser creates the user or replaces the password and roles of an existing one, it is true when the user is new
+	CreateUser(credential Credential) (bool, error)
+	DeleteUser(username string) error
+	ListUsers() ([]string, error)
+}
+
+// credentialProvidersFromEnv creates every enabled provider, env reads the settings of a provider with a default
+func credentialProvidersFromEnv(enabled string, elastic aristoteles.Client, env func(key, defaultValue string) string) (map[string]CredentialProvider, error) {
+	providers := map[string]CredentialProvider{}
+	for _, name := range strings.Split(enabled, ",") {
+		name = strings.TrimSpace(name)
+
+		var provider CredentialProvider
+		var err error
+		switch name {
+		case "":
+			continue
+		case ProviderElasticsearch:
+			provider = &elasticProvider{client: elastic}
+		case ProviderOpenSearch:
+			provider, err = newOpenSearchProvider(env(EnvOpenSearchURL, ""), env(EnvOpenSearchUsername, ""), env(EnvOpenSearchPassword, ""), env(EnvOpenSearchCert, ""))
+		case ProviderPostgres:
+			provider, err = newPostgresProvider(env(EnvPostgresDriver, defaultPostgresDriver), env(EnvPostgresDSN, ""))
+		default:
+			err = fmt.Errorf("unknown credential provider %s, expected %s, %s or %s", name, ProviderElasticsearch, ProviderOpenSearch, ProviderPostgres)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		providers[name] = provider
+	}
+
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("%s enables no credential provider", EnvCredentialProviders)
+	}
+
+	return providers, nil
+}
+
+// credentialProvider returns the provider by name, an empty name is elasticsearch since registrations from before
+// providers existed do not name one. Without any providers configured elasticsearch is reached through the elastic client
+func (s *SolonHandler) credentialProvider(name string) (CredentialProvider, error) {
+	if name == "" {
+		name = ProviderElasticsearch
+	}
+
+	if provider, ok := s.Providers[name]; ok {
+		return provider, nil
+	}
+
+	if s.Providers == nil && name == ProviderElasticsearch && s.Elastic != nil {
+		return &elasticProvider{client: s.Elastic}, nil
+	}
+
+	return nil, fmt.Errorf("credential provider %s is not enabled", name)
+}
+
+// providerOf returns the provider named by the annotation of the pod
+func (s *SolonHandler) providerOf(annotations map[string]string) (CredentialProvider, error) {
+	annotation := s.ProviderAnnotation
+	if annotation == "" {
+		annotation = DefaultProviderAnnotation
+	}
+
+	return s.credentialProvider(strings.TrimSpace(annotations[annotation]))
+}
+
+// providerOfRegistration returns the provider the users of a registration were created in
+func (s *SolonHandler) providerOfRegistration(data *registrationData) (CredentialProvider, error) {
+	if data == nil || data.Registration == nil {
+		return s.credentialProvider("")
+	}
+
+	return s.credentialProvider(data.Registration.Provider)
+}
+
+func (s *SolonHandler) createUser(provider CredentialProvider, credential Credential) (bool, error) {
+	var created bool
+	err := s.Metrics.timeProvider(provider.Name(), "create_user", func() error {
+		var err error
+		created, err = provider.CreateUser(credential)
+		return err
+	})
+
+	return created, err
+}
+
+func (s *SolonHandler) deleteUser(provider CredentialProvider, username string) error {
+	return s.Metrics.timeProvider(provider.Name(), "delete_user", func() error {
+		return provider.DeleteUser(username)
+	})
+}
+
+// userFailedCode keeps the error code clients already know for elasticsearch
+func userFailedCode(provider CredentialProvider) delphi.ErrorCode {
+	if provider.Name() == ProviderElasticsearch {
+		return delphi.ErrorCodeElasticUserFailed
+	}
+
+	return delphi.ErrorCodeCredentialUserFailed
+}
+
+// userResource is the resource name of a user in orphan reports and metrics, elasticsearch keeps the name it always had
+func userResource(provider string) string {
+	if provider == ProviderElasticsearch {
+		return OrphanResourceElasticUser
+	}
+
+	return provider + orphanResourceUserSuffix
+}
+
+// elasticProvider creates native realm users in elasticsearch
+type elasticProvider struct {
+	client aristoteles.Client
+}
+
+func (e *elasticProvider) Name() string {
+	return ProviderElasticsearch
+}
+
+func (e *elasticProvider) CreateUser(credential Credential) (bool, error) {
+	return e.client.Access().CreateUser(credential.Username, newUserRequest(credential.Owner, credential.Password, credential.Roles))
+}
+
+func (e *elasticProvider) DeleteUser(username string) error {
+	_, err := e.client.Access().DeleteUser(username)
+	return err
+}
+
+func (e *elasticProvider) ListUsers() ([]string, error) {
+	return e.client.Access().ListUsers()
+}
@@ -0,0 +1,154 @@
+package lawgiver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	EnvOpenSearchURL      string = "SOLON_OPENSEARCH_URL"
+	EnvOpenSearchUsername string = "SOLON_OPENSEARCH_USERNAME"
+	EnvOpenSearchPassword string = "SOLON_OPENSEARCH_PASSWORD"
+	// EnvOpenSearchCert is the pem encoded certificate of the cluster, the system roots are trusted without it
+	EnvOpenSearchCert string = "SOLON_OPENSEARCH_CERT"
+
+	openSearchUsersPath string = "/_plugins/_security/api/internalusers"
+	providerTimeout            = 10 * time.Second
+)
+
+// openSearchProvider creates internal users through the rest api of the security plugin, the roles are
+// security roles that have to exist in the cluster
+type openSearchProvider struct {
+	client   *http.Client
+	service  string
+	username string
+	password string
+}
+
+type openSearchUser struct {
+	Password      string            `json:"password,omitempty"`
+	SecurityRoles []string          `json:"opendistro_security_roles"`
+	Attributes    map[string]string `json:"attributes,omitempty"`
+}
+
+func newOpenSearchProvider(service, username, password, cert string) (*openSearchProvider, error) {
+	if service == "" {
+		return nil, fmt.Errorf("%s is required for the %s provider", EnvOpenSearchURL, ProviderOpenSearch)
+	}
+
+	client, err := httpClientTrusting(cert, ProviderOpenSearch)
+	if err != nil {
+		return nil, err
+	}
+
+	return &openSearchProvider{
+		client:   client,
+		service:  strings.TrimSuffix(service, "/"),
+		username: username,
+		password: password,
+	}, nil
+}
+
+func (o *openSearchProvider) Name() string {
+	return ProviderOpenSearch
+}
+
+// CreateUser puts the user, the security plugin answers 201 for a new user and 200 when it replaced one
+func (o *openSearchProvider) CreateUser(credential Credential) (bool, error) {
+	body, err := json.Marshal(openSearchUser{
+		Password:      credential.Password,
+		SecurityRoles: credential.Roles,
+		Attributes:    map[string]string{"owner": credential.Owner},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	status, _, err := o.do(http.MethodPut, openSearchUsersPath+"/"+url.PathEscape(credential.Username), body)
+	if err != nil {
+		return false, err
+	}
+
+	switch status {
+	case http.StatusCreated:
+		return true, nil
+	case http.StatusOK:
+		return false, nil
+	default:
+		return false, fmt.Errorf("creating user %s returned %d", credential.Username, status)
+	}
+}
+
+func (o *openSearchProvider) DeleteUser(username string) error {
+	status, _, err := o.do(http.MethodDelete, openSearchUsersPath+"/"+url.PathEscape(username), nil)
+	if err != nil {
+		return err
+	}
+
+	if status != http.StatusOK && status != http.StatusNotFound {
+		return fmt.Errorf("deleting user %s returned %d", username, status)
+	}
+
+	return nil
+}
+
+func (o *openSearchProvider) ListUsers() ([]string, error) {
+	status, body, err := o.do(http.MethodGet, openSearchUsersPath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("listing users returned %d", status)
+	}
+
+	var users map[string]json.RawMessage
+	err = json.Unmarshal(body, &users)
+	if err != nil {
+		return nil, err
+	}
+
+	usernames := make([]string, 0, len(users))
+	for username := range users {
+		usernames = append(usernames, username)
+	}
+
+	slices.Sort(usernames)
+	return usernames, nil
+}
+
+func (o *openSearchProvider) do(method, path string, body []byte) (int, []byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), providerTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, o.service+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	req.SetBasicAuth(o.username, o.password)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := o.client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer response.Body.Close()
+
+	responseBody, err := io.ReadAll(response.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return response.StatusCode, responseBody, nil
+}
@@ -0,0 +1,163 @@
+package lawgiver
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"slices"
+	"strings"
+)
+
+const (
+	// EnvPostgresDSN is the connection string of a role allowed to create roles, EnvPostgresDriver the database/sql
+	// driver it is opened with. The pgx driver is linked in, any other driver has to be added to the binary
+	EnvPostgresDSN        string = "SOLON_POSTGRES_DSN"
+	EnvPostgresDriver     string = "SOLON_POSTGRES_DRIVER"
+	defaultPostgresDriver string = "pgx"
+
+	// postgresRoleComment marks the login roles solon created, only those are listed
+	postgresRoleComment string = "managed by solon"
+)
+
+// postgresProvider creates a login role per user and grants it the group roles named after the access pairs,
+// the group roles and their privileges are set up by whoever owns the database
+type postgresProvider struct {
+	db *sql.DB
+}
+
+func newPostgresProvider(driver, dsn string) (*postgresProvider, error) {
+	if dsn == "" {
+		return nil, fmt.Errorf("%s is required for the %s provider", EnvPostgresDSN, ProviderPostgres)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open postgres with driver %s: %w", driver, err)
+	}
+
+	return &postgresProvider{db: db}, nil
+}
+
+func (p *postgresProvider) Name() string {
+	return ProviderPostgres
+}
+
+// CreateUser creates or updates the login role and makes its memberships match the roles in one transaction
+func (p *postgresProvider) CreateUser(credential Credential) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), providerTimeout)
+	defer cancel()
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1)", credential.Username).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+
+	// ddl takes no parameters, the role name and password are quoted instead
+	role := quoteIdentifier(credential.Username)
+	statement := "CREATE ROLE"
+	if exists {
+		statement = "ALTER ROLE"
+	}
+
+	statements := []string{
+		fmt.Sprintf("%s %s WITH LOGIN PASSWORD %s", statement, role, quoteLiteral(credential.Password)),
+		fmt.Sprintf("COMMENT ON ROLE %s IS %s", role, quoteLiteral(postgresRoleComment)),
+	}
+
+	memberOf, err := p.memberships(ctx, tx, credential.Username)
+	if err != nil {
+		return false, err
+	}
+
+	for _, group := range memberOf {
+		if !slices.Contains(credential.Roles, group) {
+			statements = append(statements, fmt.Sprintf("REVOKE %s FROM %s", quoteIdentifier(group), role))
+		}
+	}
+
+	for _, group := range credential.Roles {
+		if !slices.Contains(memberOf, group) {
+			statements = append(statements, fmt.Sprintf("GRANT %s TO %s", quoteIdentifier(group), role))
+		}
+	}
+
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return false, fmt.Errorf("%s failed: %w", strings.SplitN(statement, " ", 2)[0], err)
+		}
+	}
+
+	return !exists, tx.Commit()
+}
+
+func (p *postgresProvider) memberships(ctx context.Context, tx *sql.Tx, username string) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT g.rolname FROM pg_auth_members m
+		JOIN pg_roles g ON g.oid = m.roleid
+		JOIN pg_roles u ON u.oid = m.member
+		WHERE u.rolname = $1`, username)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanNames(rows)
+}
+
+func (p *postgresProvider) DeleteUser(username string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), providerTimeout)
+	defer cancel()
+
+	_, err := p.db.ExecContext(ctx, fmt.Sprintf("DROP ROLE IF EXISTS %s", quoteIdentifier(username)))
+	return err
+}
+
+// ListUsers returns the login roles carrying the comment solon puts on the roles it creates
+func (p *postgresProvider) ListUsers() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), providerTimeout)
+	defer cancel()
+
+	rows, err := p.db.QueryContext(ctx, `SELECT r.rolname FROM pg_roles r
+		JOIN pg_shdescription d ON d.objoid = r.oid AND d.classoid = 'pg_authid'::regclass
+		WHERE d.description = $1`, postgresRoleComment)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanNames(rows)
+}
+
+func scanNames(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// quoteLiteral escapes a string literal, a value with a backslash becomes an escape string so the backslash means itself
+func quoteLiteral(value string) string {
+	quoted := "'" + strings.ReplaceAll(value, "'", "''") + "'"
+	if strings.Contains(value, `\`) {
+		return "E" + strings.ReplaceAll(quoted, `\`, `\\`)
+	}
+
+	return quoted
+}
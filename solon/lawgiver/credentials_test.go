@@ -0,0 +1,394 @@
+package lawgiver
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/odysseia-greek/agora/plato/models"
+	delphi "github.com/odysseia-greek/delphi/solon/models"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCredentialProviders(t *testing.T) {
+	ns := "test"
+	podName := "sokrates-5d8f7c9b4-abcde"
+	ref := refOf(ns, podName)
+
+	t.Run("FromEnv", func(t *testing.T) {
+		env := func(values map[string]string) func(string, string) string {
+			return func(key, defaultValue string) string {
+				if value, ok := values[key]; ok {
+					return value
+				}
+				return defaultValue
+			}
+		}
+
+		providers, err := credentialProvidersFromEnv("elasticsearch, opensearch", nil, env(map[string]string{EnvOpenSearchURL: "https://opensearch:9200/"}))
+		assert.Nil(t, err)
+		assert.Len(t, providers, 2)
+		assert.Equal(t, "https://opensearch:9200", providers[ProviderOpenSearch].(*openSearchProvider).service)
+
+		_, err = credentialProvidersFromEnv(ProviderOpenSearch, nil, env(nil))
+		assert.ErrorContains(t, err, EnvOpenSearchURL)
+
+		_, err = credentialProvidersFromEnv(ProviderPostgres, nil, env(nil))
+		assert.ErrorContains(t, err, EnvPostgresDSN)
+
+		_, err = credentialProvidersFromEnv(ProviderPostgres, nil, env(map[string]string{EnvPostgresDSN: "postgres://solon@db/odysseia", EnvPostgresDriver: "notlinked"}))
+		assert.ErrorContains(t, err, "notlinked")
+
+		providers, err = credentialProvidersFromEnv(ProviderPostgres, nil, env(map[string]string{EnvPostgresDSN: "postgres://solon@db/odysseia"}))
+		assert.Nil(t, err, "the default driver is linked in")
+		assert.Contains(t, providers, ProviderPostgres)
+		assert.Contains(t, sql.Drivers(), defaultPostgresDriver)
+
+		_, err = credentialProvidersFromEnv("mongodb", nil, env(nil))
+		assert.NotNil(t, err)
+
+		_, err = credentialProvidersFromEnv(" ", nil, env(nil))
+		assert.NotNil(t, err)
+	})
+
+	t.Run("RegisterPicksTheAnnotatedProvider", func(t *testing.T) {
+		pods := newTestPodCache()
+		pod := runningPodForTest(podName, ns, "dictionary", "api")
+		pod.Annotations[DefaultProviderAnnotation] = ProviderPostgres
+		assert.Nil(t, pods.indexer.Add(pod))
+
+		postgres := &fakeProvider{name: ProviderPostgres}
+		backend := NewMemoryBackend()
+		handler := &SolonHandler{
+			Vault:            backend,
+			Pods:             pods,
+			AuthMode:         AuthModeIP,
+			Namespace:        ns,
+			AccessAnnotation: "odysseia-greek/access",
+			RoleAnnotation:   "odysseia-greek/role",
+			ElasticCert:      []byte("elastic-cert"),
+			Providers:        map[string]CredentialProvider{ProviderPostgres: postgres},
+		}
+
+		body, err := json.Marshal(delphi.SolonCreationRequest{Access: []string{"dictionary:api"}, PodName: podName})
+		assert.Nil(t, err)
+
+		router := InitRoutes(handler)
+		response := performPostRequest(router, "/solon/v1/register", bytes.NewReader(body))
+		assert.Equal(t, http.StatusCreated, response.Code, response.Body.String())
+
+		var sut models.SolonResponse
+		err = json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+		assert.True(t, sut.UserCreated)
+
+		assert.Equal(t, []string{"sokratesabcde"}, postgres.usernames())
+		assert.Equal(t, []string{"dictionary_api"}, postgres.users["sokratesabcde"].Roles)
+
+		data, err := handler.readRegistrationData(ref.secretName())
+		assert.Nil(t, err)
+		assert.Equal(t, ProviderPostgres, data.Registration.Provider)
+		assert.Empty(t, data.ElasticCERT)
+
+		err = handler.deleteOrphans(pod)
+		assert.Nil(t, err)
+		assert.Empty(t, postgres.usernames())
+	})
+
+	t.Run("ProviderNotEnabled", func(t *testing.T) {
+		pods := newTestPodCache()
+		pod := runningPodForTest(podName, ns, "dictionary", "api")
+		pod.Annotations[DefaultProviderAnnotation] = ProviderOpenSearch
+		assert.Nil(t, pods.indexer.Add(pod))
+
+		handler := &SolonHandler{
+			Vault:            NewMemoryBackend(),
+			Pods:             pods,
+			AuthMode:         AuthModeIP,
+			Namespace:        ns,
+			AccessAnnotation: "odysseia-greek/access",
+			RoleAnnotation:   "odysseia-greek/role",
+			Providers:        map[string]CredentialProvider{ProviderPostgres: &fakeProvider{name: ProviderPostgres}},
+		}
+
+		body, err := json.Marshal(delphi.SolonCreationRequest{Access: []string{"dictionary:api"}, PodName: podName})
+		assert.Nil(t, err)
+
+		router := InitRoutes(handler)
+		response := performPostRequest(router, "/solon/v1/register", bytes.NewReader(body))
+
+		var sut delphi.SolonError
+		err = json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+		assert.Contains(t, sut.Message, "opensearch is not enabled")
+	})
+
+	t.Run("ReconcileFindsUsersInTheirProvider", func(t *testing.T) {
+		postgres := &fakeProvider{name: ProviderPostgres}
+		_, err := postgres.CreateUser(Credential{Username: "herodotos"})
+		assert.Nil(t, err)
+
+		deadPod := "herodotos-7c9b4d8f5-fghij"
+		secretName := refOf(ns, deadPod).secretName()
+		vault := &fakeVault{secrets: map[string]map[string]interface{}{
+			secretName: {
+				"elasticUsername": "herodotos",
+				"registration":    map[string]interface{}{"podName": deadPod, "username": "herodotos", "provider": ProviderPostgres},
+			},
+		}}
+
+		handler := &SolonHandler{
+			Vault:     vault,
+			Pods:      newTestPodCache(),
+			Namespace: ns,
+			Providers: map[string]CredentialProvider{ProviderPostgres: postgres},
+		}
+
+		report := handler.reconcile(false)
+		assert.Empty(t, report.Errors)
+		assert.Contains(t, report.Orphans, delphi.Orphan{Resource: "postgres_user", Name: "herodotos", Pod: deadPod, Namespace: ns, Removed: true})
+		assert.Empty(t, postgres.usernames())
+	})
+
+	t.Run("OpenSearch", func(t *testing.T) {
+		var requests []string
+		var lastBody openSearchUser
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			username, password, _ := r.BasicAuth()
+			assert.Equal(t, "admin", username)
+			assert.Equal(t, "secret", password)
+			requests = append(requests, r.Method+" "+r.URL.EscapedPath())
+
+			switch {
+			case r.Method == http.MethodPut && strings.HasSuffix(r.URL.Path, "/sokrates"):
+				assert.Nil(t, json.NewDecoder(r.Body).Decode(&lastBody))
+				w.WriteHeader(http.StatusCreated)
+			case r.Method == http.MethodPut:
+				w.WriteHeader(http.StatusOK)
+			case r.Method == http.MethodDelete:
+				w.WriteHeader(http.StatusNotFound)
+			case r.Method == http.MethodGet:
+				io.WriteString(w, `{"sokrates":{"attributes":{"owner":"sokrates"}},"admin":{}}`)
+			}
+		}))
+		defer server.Close()
+
+		provider, err := newOpenSearchProvider(server.URL, "admin", "secret", "")
+		assert.Nil(t, err)
+
+		created, err := provider.CreateUser(Credential{Username: "sokrates", Password: "pw", Roles: []string{"dictionary_api"}, Owner: "sokrates"})
+		assert.Nil(t, err)
+		assert.True(t, created)
+		assert.Equal(t, []string{"dictionary_api"}, lastBody.SecurityRoles)
+		assert.Equal(t, "pw", lastBody.Password)
+
+		created, err = provider.CreateUser(Credential{Username: "sokrates-2", Password: "pw"})
+		assert.Nil(t, err)
+		assert.False(t, created)
+
+		assert.Nil(t, provider.DeleteUser("plato/../admin"), "a user that is gone is not an error")
+
+		users, err := provider.ListUsers()
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"admin", "sokrates"}, users)
+
+		assert.Contains(t, requests, "DELETE /_plugins/_security/api/internalusers/plato%2F..%2Fadmin")
+	})
+
+	t.Run("Postgres", func(t *testing.T) {
+		db := newFakePostgres(t)
+		db.roles["texts_api"] = nil
+		db.roles["dictionary_api"] = nil
+		provider := &postgresProvider{db: db.open(t)}
+
+		created, err := provider.CreateUser(Credential{Username: "sokrates", Password: `it's\secret`, Roles: []string{"dictionary_api"}})
+		assert.Nil(t, err)
+		assert.True(t, created)
+		assert.Equal(t, []string{
+			`CREATE ROLE "sokrates" WITH LOGIN PASSWORD E'it''s\\secret'`,
+			`COMMENT ON ROLE "sokrates" IS 'managed by solon'`,
+			`GRANT "dictionary_api" TO "sokrates"`,
+		}, db.statements)
+
+		db.statements = nil
+		db.roles["sokrates"] = []string{"texts_api", "dictionary_api"}
+		created, err = provider.CreateUser(Credential{Username: "sokrates", Password: "new", Roles: []string{"dictionary_api"}})
+		assert.Nil(t, err)
+		assert.False(t, created)
+		assert.Equal(t, []string{
+			`ALTER ROLE "sokrates" WITH LOGIN PASSWORD 'new'`,
+			`COMMENT ON ROLE "sokrates" IS 'managed by solon'`,
+			`REVOKE "texts_api" FROM "sokrates"`,
+		}, db.statements)
+
+		db.statements = nil
+		db.managed = []string{"sokrates"}
+		users, err := provider.ListUsers()
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"sokrates"}, users)
+
+		assert.Nil(t, provider.DeleteUser(`robert"); DROP TABLE texts; --`))
+		assert.Equal(t, []string{`DROP ROLE IF EXISTS "robert""); DROP TABLE texts; --"`}, db.statements)
+	})
+}
+
+// fakeProvider keeps the users it was asked to create
+type fakeProvider struct {
+	name  string
+	mu    sync.Mutex
+	users map[string]Credential
+}
+
+func (f *fakeProvider) Name() string {
+	return f.name
+}
+
+func (f *fakeProvider) CreateUser(credential Credential) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.users == nil {
+		f.users = map[string]Credential{}
+	}
+	_, exists := f.users[credential.Username]
+	f.users[credential.Username] = credential
+	return !exists, nil
+}
+
+func (f *fakeProvider) DeleteUser(username string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.users, username)
+	return nil
+}
+
+func (f *fakeProvider) ListUsers() ([]string, error) {
+	return f.usernames(), nil
+}
+
+func (f *fakeProvider) usernames() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	names := []string{}
+	for name := range f.users {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// fakePostgres is a database/sql driver that answers the catalog queries of the postgres provider
+// from memory and records every other statement
+type fakePostgres struct {
+	roles      map[string][]string
+	managed    []string
+	statements []string
+}
+
+var (
+	registerFakePostgres sync.Once
+	fakePostgresByDSN    sync.Map
+)
+
+func newFakePostgres(t *testing.T) *fakePostgres {
+	registerFakePostgres.Do(func() {
+		sql.Register("fakepostgres", fakePostgresDriver{})
+	})
+
+	db := &fakePostgres{roles: map[string][]string{}}
+	fakePostgresByDSN.Store(t.Name(), db)
+	return db
+}
+
+func (f *fakePostgres) open(t *testing.T) *sql.DB {
+	db, err := sql.Open("fakepostgres", t.Name())
+	assert.Nil(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+type fakePostgresDriver struct{}
+
+func (fakePostgresDriver) Open(dsn string) (driver.Conn, error) {
+	db, ok := fakePostgresByDSN.Load(dsn)
+	if !ok {
+		return nil, fmt.Errorf("no fake database %s", dsn)
+	}
+	return &fakePostgresConn{db: db.(*fakePostgres)}, nil
+}
+
+type fakePostgresConn struct {
+	db *fakePostgres
+}
+
+func (c *fakePostgresConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakePostgresStmt{db: c.db, query: query}, nil
+}
+
+func (c *fakePostgresConn) Close() error              { return nil }
+func (c *fakePostgresConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *fakePostgresConn) Commit() error             { return nil }
+func (c *fakePostgresConn) Rollback() error           { return nil }
+
+type fakePostgresStmt struct {
+	db    *fakePostgres
+	query string
+}
+
+func (s *fakePostgresStmt) Close() error  { return nil }
+func (s *fakePostgresStmt) NumInput() int { return -1 }
+
+func (s *fakePostgresStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.db.statements = append(s.db.statements, s.query)
+	return driver.RowsAffected(0), nil
+}
+
+func (s *fakePostgresStmt) Query(args []driver.Value) (driver.Rows, error) {
+	switch {
+	case strings.Contains(s.query, "EXISTS"):
+		_, exists := s.db.roles[args[0].(string)]
+		return &fakePostgresRows{values: []driver.Value{exists}}, nil
+	case strings.Contains(s.query, "pg_auth_members"):
+		return namesAsRows(s.db.roles[args[0].(string)]), nil
+	case strings.Contains(s.query, "pg_shdescription"):
+		return namesAsRows(s.db.managed), nil
+	default:
+		return nil, errors.New("unexpected query")
+	}
+}
+
+func namesAsRows(names []string) *fakePostgresRows {
+	rows := &fakePostgresRows{}
+	for _, name := range names {
+		rows.values = append(rows.values, name)
+	}
+	return rows
+}
+
+type fakePostgresRows struct {
+	values []driver.Value
+}
+
+func (r *fakePostgresRows) Columns() []string { return []string{"value"} }
+func (r *fakePostgresRows) Close() error      { return nil }
+
+func (r *fakePostgresRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	dest[0] = r.values[0]
+	r.values = r.values[1:]
+	return nil
+}
@@ -0,0 +1,120 @@
+package lawgiver
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/odysseia-greek/agora/plato/logging"
+	"github.com/odysseia-greek/agora/plato/middleware"
+	delphi "github.com/odysseia-greek/delphi/solon/models"
+	"net/http"
+)
+
+var (
+	errPodCacheNotSynced = errors.New("pod cache has not synced yet")
+	errPodNotServing     = errors.New("pod is not serving requests")
+)
+
+// statusCodes maps every error code to the http status it is returned with
+var statusCodes = map[delphi.ErrorCode]int{
+	delphi.ErrorCodeInvalidRequest:           http.StatusBadRequest,
+	delphi.ErrorCodeUnauthenticated:          http.StatusUnauthorized,
+	delphi.ErrorCodeAdminRequired:            http.StatusForbidden,
+	delphi.ErrorCodePodNotFound:              http.StatusNotFound,
+	delphi.ErrorCodePodNotServing:            http.StatusForbidden,
+	delphi.ErrorCodePodNameMismatch:          http.StatusForbidden,
+	delphi.ErrorCodeAnnotationMismatch:       http.StatusForbidden,
+	delphi.ErrorCodeRegistrationConflict:     http.StatusConflict,
+	delphi.ErrorCodeRegistrationNotFound:     http.StatusNotFound,
+	delphi.ErrorCodeRateLimited:              http.StatusTooManyRequests,
+	delphi.ErrorCodePasswordGenerationFailed: http.StatusInternalServerError,
+	delphi.ErrorCodeVaultPolicyFailed:        http.StatusInternalServerError,
+	delphi.ErrorCodeVaultTokenFailed:         http.StatusInternalServerError,
+	delphi.ErrorCodeVaultSecretFailed:        http.StatusInternalServerError,
+	delphi.ErrorCodeElasticUserFailed:        http.StatusInternalServerError,
+	delphi.ErrorCodeCredentialUserFailed:     http.StatusInternalServerError,
+	delphi.ErrorCodeServiceUnavailable:       http.StatusServiceUnavailable,
+	delphi.ErrorCodeInternal:                 http.StatusInternalServerError,
+}
+
+// solonError carries the error code and the field that failed so the handler can build the response envelope
+type solonError struct {
+	Code       delphi.ErrorCode
+	Field      string
+	Err        error
+	FailedStep string
+	RolledBack []string
+	// Status replaces the status of the code, such as for a failed read that is safe to retry
+	Status int
+}
+
+func (e *solonError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *solonError) Unwrap() error {
+	return e.Err
+}
+
+func (e *solonError) StatusCode() int {
+	if e.Status != 0 {
+		return e.Status
+	}
+
+	code, ok := statusCodes[e.Code]
+	if !ok {
+		return http.StatusInternalServerError
+	}
+
+	return code
+}
+
+func newSolonError(code delphi.ErrorCode, field string, err error) *solonError {
+	return &solonError{Code: code, Field: field, Err: err}
+}
+
+// newUnavailableError is an error that is returned as 503 whatever its code, for a dependency that failed before solon changed anything
+func newUnavailableError(code delphi.ErrorCode, field string, err error) *solonError {
+	return &solonError{Code: code, Field: field, Err: err, Status: http.StatusServiceUnavailable}
+}
+
+// podLookupError converts a failed lookup of the calling pod into the matching error code
+func podLookupError(err error) *solonError {
+	var solonErr *solonError
+	switch {
+	case errors.As(err, &solonErr):
+		return solonErr
+	case errors.Is(err, errPodCacheNotSynced):
+		return newSolonError(delphi.ErrorCodeServiceUnavailable, "pod", err)
+	case errors.Is(err, errPodNotServing):
+		return newSolonError(delphi.ErrorCodePodNotServing, "pod", err)
+	default:
+		return newSolonError(delphi.ErrorCodeUnauthenticated, "pod", err)
+	}
+}
+
+// respondWithError writes the error envelope with the status code that belongs to the error
+func (s *SolonHandler) respondWithError(w http.ResponseWriter, requestId string, err error) {
+	var solonErr *solonError
+	if !errors.As(err, &solonErr) {
+		solonErr = newSolonError(delphi.ErrorCodeInternal, "", err)
+	}
+
+	uniqueCode := requestId
+	if uniqueCode == "" {
+		uniqueCode = uuid.New().String()
+	}
+
+	logging.Error(fmt.Sprintf("request %s failed with %s: %s", uniqueCode, solonErr.Code, solonErr.Error()))
+
+	e := delphi.SolonError{
+		UniqueCode: uniqueCode,
+		Code:       solonErr.Code,
+		Field:      solonErr.Field,
+		Message:    solonErr.Error(),
+		FailedStep: solonErr.FailedStep,
+		RolledBack: solonErr.RolledBack,
+	}
+
+	middleware.ResponseWithCustomCode(w, solonErr.StatusCode(), e)
+}
@@ -4,134 +4,164 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"github.com/google/uuid"
 	"github.com/odysseia-greek/agora/aristoteles"
 	elasticmodels "github.com/odysseia-greek/agora/aristoteles/models"
-	"github.com/odysseia-greek/agora/diogenes"
 	plato "github.com/odysseia-greek/agora/plato/config"
 	"github.com/odysseia-greek/agora/plato/generator"
 	"github.com/odysseia-greek/agora/plato/logging"
 	"github.com/odysseia-greek/agora/plato/middleware"
 	"github.com/odysseia-greek/agora/plato/models"
 	kubernetes "github.com/odysseia-greek/agora/thales"
-	pb "github.com/odysseia-greek/attike/aristophanes/proto"
 	delphi "github.com/odysseia-greek/delphi/solon/models"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/informers"
+	authenticationv1 "k8s.io/client-go/kubernetes/typed/authentication/v1"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
 type SolonHandler struct {
-	Vault            diogenes.Client
+	// Vault holds the secrets, policies and tokens of the registered pods, it is vault unless EnvSecretBackend says otherwise
+	Vault            SecretBackend
 	Elastic          aristoteles.Client
+	ElasticCluster   ClusterHealth
 	ElasticCert      []byte
 	Kube             *kubernetes.KubeClient
+	KubeAPI          discovery.ServerVersionInterface
+	TokenReviewer    authenticationv1.TokenReviewInterface
+	Informers        informers.SharedInformerFactory
+	Pods             *PodCache
+	AuthMode         string
+	TokenAudience    string
+	Admins           []string
 	Namespace        string
+	Namespaces       *NamespaceScope
 	AccessAnnotation string
 	RoleAnnotation   string
-	TLSEnabled       bool
-	Streamer         pb.TraceService_ChorusClient
-	Cancel           context.CancelFunc
+	// ProviderAnnotation names the credential provider of a pod, DefaultProviderAnnotation when empty
+	ProviderAnnotation string
+	Providers          map[string]CredentialProvider
+	TLSEnabled         bool
+	RequireClientCert  bool
+	HostAnnotation     string
+	// UsernameAnnotation declares a shared username of a pod, DefaultUsernameAnnotation when empty
+	UsernameAnnotation string
+	SharedUsernames    []string
+	Tracer             Tracer
+	Cancel             context.CancelFunc
+	Audit              *Auditor
+	Metrics            *Metrics
+	Reconciler         *Reconciler
+	Cleanup            *CleanupScheduler
+	Policies           *PolicyTemplates
+	Leases             *LeaseManager
+	Limiter            *TokenLimiter
+	TokenLimits        *TokenLimits
+	// ShutdownDelay is how long solon keeps serving between turning unready and shutting down the server
+	ShutdownDelay time.Duration
+
+	shuttingDown  atomic.Bool
+	healthHistory healthHistory
+	spec          *openAPISpec
 }
 
-func (s *SolonHandler) Health(w http.ResponseWriter, req *http.Request) {
+func (s *SolonHandler) CreateOneTimeToken(w http.ResponseWriter, req *http.Request) {
 	requestId := req.Header.Get(plato.HeaderKey)
 	w.Header().Set(plato.HeaderKey, requestId)
 
-	vaultHealth, _ := s.Vault.Health()
-
-	elasticHealth := s.Elastic.Health().Info()
-	dbHealth := models.DatabaseHealth{
-		Healthy:       elasticHealth.Healthy,
-		ClusterName:   elasticHealth.ClusterName,
-		ServerName:    elasticHealth.ServerName,
-		ServerVersion: elasticHealth.ServerVersion,
-	}
-	healthy := models.Health{
-		Healthy:  vaultHealth,
-		Time:     time.Now().String(),
-		Database: dbHealth,
+	pod, err := s.identifyCallingPod(req)
+	if err != nil {
+		s.audit(AuditActionTokenIssue, AuditDecisionDenied, podRef{}, requestId, err.Error())
+		s.respondWithError(w, requestId, err)
+		return
 	}
-	middleware.ResponseWithJson(w, healthy)
-}
 
-func (s *SolonHandler) CreateOneTimeToken(w http.ResponseWriter, req *http.Request) {
-	pod, err := s.verifyRequestOriginIP(req.RemoteAddr)
+	ref := refOf(pod.Namespace, pod.Name)
+	policy := ref.policyName()
+	tpl := s.Policies.ForRole(pod.Annotations[s.RoleAnnotation])
+
+	opts, err := s.TokenLimits.options(req.URL.Query(), tpl)
 	if err != nil {
-		logging.Error(err.Error())
-		e := models.ValidationError{
-			ErrorModel: models.ErrorModel{UniqueCode: uuid.New().String()},
-			Messages: []models.ValidationMessages{
-				{
-					Field:   "verifying requestIP with a pod",
-					Message: err.Error(),
-				},
-			},
-		}
-		middleware.ResponseWithJson(w, e)
+		s.audit(AuditActionTokenIssue, AuditDecisionDenied, ref, requestId, err.Error())
+		s.respondWithError(w, requestId, err)
 		return
 	}
 
-	if pod == nil {
-		e := models.ValidationError{
-			ErrorModel: models.ErrorModel{UniqueCode: uuid.New().String()},
-			Messages: []models.ValidationMessages{
-				{
-					Field:   "listPods",
-					Message: "no pods could be found",
-				},
-			},
-		}
-		middleware.ResponseWithJson(w, e)
+	if err := s.checkTokenOptions(req.URL.Query(), opts); err != nil {
+		s.audit(AuditActionTokenIssue, AuditDecisionDenied, ref, requestId, err.Error())
+		s.respondWithError(w, requestId, err)
 		return
 	}
 
-	// Define the policy name and Vault path
-	policyName := fmt.Sprintf("policy-%s", pod.Name)
-	podVaultPath := fmt.Sprintf("configs/data/%s", pod.Name)
+	wrapper, canWrap := s.Vault.(tokenWrapper)
+	if opts.Wrap && !canWrap {
+		err := newSolonError(delphi.ErrorCodeInvalidRequest, tokenQueryWrap, fmt.Errorf("the secret backend cannot wrap tokens"))
+		s.audit(AuditActionTokenIssue, AuditDecisionDenied, ref, requestId, err.Error())
+		s.respondWithError(w, requestId, err)
+		return
+	}
 
-	// Define the policy rules
-	policyRules := fmt.Sprintf(`
-path "%s" {
-  capabilities = ["read", "list"]
-}
-`, podVaultPath)
+	if limitErr := s.Limiter.Allow(ref, time.Now(), s.tokenUsed()); limitErr != nil {
+		s.rejectToken(w, requestId, ref, limitErr)
+		return
+	}
 
-	err = s.Vault.WritePolicy(policyName, []byte(policyRules))
+	policyRules, err := tpl.Render(pod)
 	if err != nil {
-		logging.Error(err.Error())
-		e := models.ValidationError{
-			ErrorModel: models.ErrorModel{UniqueCode: uuid.New().String()},
-			Messages: []models.ValidationMessages{
-				{
-					Field:   "creating policy",
-					Message: err.Error(),
-				},
-			},
-		}
-		middleware.ResponseWithJson(w, e)
+		s.audit(AuditActionTokenIssue, AuditDecisionFailed, ref, requestId, err.Error())
+		s.respondWithError(w, requestId, newSolonError(delphi.ErrorCodeVaultPolicyFailed, "rendering policy", err))
 		return
 	}
 
-	token, err := s.Vault.CreateOneTimeToken([]string{policyName})
+	err = s.Metrics.timeVault("write_policy", func() error {
+		return s.Vault.WritePolicy(policy, policyRules)
+	})
 	if err != nil {
-		logging.Error(err.Error())
-		e := models.ValidationError{
-			ErrorModel: models.ErrorModel{UniqueCode: uuid.New().String()},
-			Messages: []models.ValidationMessages{
-				{
-					Field:   "getting token",
-					Message: err.Error(),
-				},
-			},
-		}
-		middleware.ResponseWithJson(w, e)
+		s.audit(AuditActionTokenIssue, AuditDecisionFailed, ref, requestId, err.Error())
+		s.respondWithError(w, requestId, newSolonError(delphi.ErrorCodeVaultPolicyFailed, "creating policy", err))
+		return
+	}
+
+	var token, accessor string
+	err = s.Metrics.timeVault("create_token", func() error {
+		token, accessor, err = s.createToken(policy, opts)
+		return err
+	})
+	if err != nil {
+		s.audit(AuditActionTokenIssue, AuditDecisionFailed, ref, requestId, err.Error())
+		s.respondWithError(w, requestId, newSolonError(delphi.ErrorCodeVaultTokenFailed, "getting token", err))
 		return
 	}
 
 	tokenModel := delphi.TokenResponse{
-		Token: token,
+		Token:   token,
+		Wrapped: opts.Wrap,
+		TTL:     opts.TTL,
+		NumUses: opts.NumUses,
+	}
+
+	if opts.Wrap {
+		err = s.Metrics.timeVault("wrap_token", func() error {
+			tokenModel.Token, err = wrapper.WrapToken(token, s.TokenLimits.wrapTTL())
+			return err
+		})
+		if err != nil {
+			s.audit(AuditActionTokenIssue, AuditDecisionFailed, ref, requestId, err.Error())
+			s.respondWithError(w, requestId, newSolonError(delphi.ErrorCodeVaultTokenFailed, "wrapping token", err))
+			return
+		}
+	}
+
+	// the limiter tracks the accessor of the token itself, not of the wrapping token, solon never keeps the token
+	s.Metrics.TokenIssued()
+	s.Limiter.Issued(ref, accessor, opts.ttl(), time.Now())
+	message := fmt.Sprintf("token issued with policy %s", policy)
+	if described := opts.String(); described != "" {
+		message = fmt.Sprintf("%s, %s", message, described)
 	}
+	s.audit(AuditActionTokenIssue, AuditDecisionAllowed, ref, requestId, message)
 
 	middleware.ResponseWithCustomCode(w, http.StatusOK, tokenModel)
 }
@@ -142,149 +172,178 @@ func (s *SolonHandler) RegisterService(w http.ResponseWriter, req *http.Request)
 
 	var creationRequest delphi.SolonCreationRequest
 	if err := json.NewDecoder(req.Body).Decode(&creationRequest); err != nil {
-		s.handleValidationError(w, "decoding", requestId, err)
+		s.respondWithError(w, requestId, newSolonError(delphi.ErrorCodeInvalidRequest, "decoding", err))
 		return
 	}
 
-	pod, err := s.verifyRequestOriginIP(req.RemoteAddr)
+	pod, err := s.identifyCallingPod(req)
 	if err != nil {
-		logging.Error(err.Error())
-		e := models.ValidationError{
-			ErrorModel: models.ErrorModel{UniqueCode: uuid.New().String()},
-			Messages: []models.ValidationMessages{
-				{
-					Field:   "verifying requestIP with a pod",
-					Message: err.Error(),
-				},
-			},
-		}
-		middleware.ResponseWithJson(w, e)
+		s.audit(AuditActionRegister, AuditDecisionDenied, podRef{Name: creationRequest.PodName}, requestId, err.Error())
+		s.respondWithError(w, requestId, err)
 		return
 	}
 
+	ref := refOf(pod.Namespace, pod.Name)
 	if pod.Name != creationRequest.PodName {
-		// this error should go to slack or somewhere to see illegal actions
-		e := models.ValidationError{
-			ErrorModel: models.ErrorModel{UniqueCode: uuid.New().String()},
-			Messages: []models.ValidationMessages{
-				{
-					Field:   "creationRequest.Podname",
-					Message: fmt.Sprintf("illegal action detected: %s requested but podname is %s", creationRequest.PodName, pod.Name),
-				},
-			},
-		}
-		middleware.ResponseWithJson(w, e)
+		err := fmt.Errorf("illegal action detected: %s requested but podname is %s", creationRequest.PodName, pod.Name)
+		s.audit(AuditActionImpersonation, AuditDecisionDenied, ref, requestId, err.Error())
+		s.respondWithError(w, requestId, newSolonError(delphi.ErrorCodePodNameMismatch, "creationRequest.Podname", err))
 		return
 	}
 
-	validAnnotation := s.areValidAnnotations(pod.Annotations, &creationRequest)
-	if !validAnnotation {
-		// this error should go to slack or somewhere to see illegal actions
-		e := models.ValidationError{
-			ErrorModel: models.ErrorModel{UniqueCode: uuid.New().String()},
-			Messages: []models.ValidationMessages{
-				{
-					Field:   "annotations",
-					Message: fmt.Sprintf("illegal action detected: %s requested invalid annotations", pod.Name),
-				},
-			},
-		}
-		middleware.ResponseWithJson(w, e)
+	access, err := s.validateAnnotations(pod.Annotations, &creationRequest)
+	if err != nil {
+		err := fmt.Errorf("illegal action detected: %s requested invalid annotations: %w", pod.Name, err)
+		s.audit(AuditActionAnnotationMismatch, AuditDecisionDenied, ref, requestId, err.Error())
+		s.respondWithError(w, requestId, newSolonError(delphi.ErrorCodeAnnotationMismatch, "annotations", err))
 		return
 	}
 
-	password, err := generator.RandomPassword(18)
+	roleNames := generateRoleNames(access)
+
+	provider, err := s.providerOf(pod.Annotations)
 	if err != nil {
-		s.handleValidationError(w, "passwordgenerator", requestId, err)
+		s.audit(AuditActionRegister, AuditDecisionDenied, ref, requestId, err.Error())
+		s.respondWithError(w, requestId, newSolonError(delphi.ErrorCodeInvalidRequest, "annotations", err))
 		return
 	}
 
-	roleNames := s.generateRoleNames(&creationRequest)
+	// solon assigns the username, a caller only picks one when several pods share a user such as the tracing user
+	username, sharedUsername, err := s.usernameFor(pod, creationRequest.Username)
+	if err != nil {
+		err := fmt.Errorf("illegal action detected: %w", err)
+		s.audit(AuditActionAnnotationMismatch, AuditDecisionDenied, ref, requestId, err.Error())
+		s.respondWithError(w, requestId, newSolonError(delphi.ErrorCodeAnnotationMismatch, "username", err))
+		return
+	}
 
-	putUser := elasticmodels.CreateUserRequest{
-		Password: password,
-		Roles:    roleNames,
-		FullName: creationRequest.Username,
-		Email:    fmt.Sprintf("%s@odysseia-greek.com", creationRequest.Username),
-		Metadata: &elasticmodels.Metadata{Version: 1},
+	idempotencyKey := req.Header.Get(HeaderIdempotencyKey)
+
+	// only an explicit rotate request is allowed to replace the credentials of a pod that already registered
+	if req.URL.Query().Get(rotateQueryParam) != "true" {
+		// without the earlier registration a retry would be taken for a new pod and replace its credentials
+		existing, err := s.readRegistration(ref.secretName())
+		if err != nil {
+			err = fmt.Errorf("failed to read the earlier registration of %s: %w", pod.Name, err)
+			s.audit(AuditActionRegister, AuditDecisionFailed, ref, requestId, err.Error())
+			s.respondWithError(w, requestId, newUnavailableError(delphi.ErrorCodeVaultSecretFailed, "secret", err))
+			return
+		}
+
+		if existing != nil && existing.isRepeatOf(string(pod.UID), idempotencyKey) {
+			if existing.conflictsWith(username, roleNames) || existing.providerName() != provider.Name() {
+				err := fmt.Errorf("%s is already registered as %s with different roles, username or provider, use rotate=true to replace it", pod.Name, existing.Username)
+				s.audit(AuditActionRegister, AuditDecisionDenied, ref, requestId, err.Error())
+				s.respondWithError(w, requestId, newSolonError(delphi.ErrorCodeRegistrationConflict, "creationRequest", err))
+				return
+			}
+
+			logging.Debug(fmt.Sprintf("returning existing registration for %s created at %s", pod.Name, existing.CreatedAt))
+			s.audit(AuditActionRegister, AuditDecisionAllowed, ref, requestId, "existing registration returned")
+			response := models.SolonResponse{SecretCreated: true, UserCreated: true}
+			middleware.ResponseWithCustomCode(w, http.StatusOK, response)
+			return
+		}
 	}
 
-	userCreated, err := s.Elastic.Access().CreateUser(creationRequest.Username, putUser)
+	registration := newSaga(pod.Name)
+
+	var password string
+	err = registration.run(stepGeneratePassword, delphi.ErrorCodePasswordGenerationFailed, func() error {
+		password, err = generator.RandomPassword(18)
+		return err
+	}, nil)
 	if err != nil {
-		s.handleValidationError(w, "createUser", requestId, err)
+		s.audit(AuditActionRegister, AuditDecisionFailed, ref, requestId, err.Error())
+		s.respondWithError(w, requestId, err)
 		return
 	}
 
-	logging.Debug(fmt.Sprintf("created new user: %s from pod: %s", creationRequest.Username, pod.Name))
-	createRequest := diogenes.CreateSecretRequest{
-		Data: diogenes.ElasticConfigVault{
-			Username:    creationRequest.Username,
-			Password:    password,
-			ElasticCERT: string(s.ElasticCert),
-		},
+	// with leases every credential gets its own short lived user so a renewed lease never breaks the one still in use
+	now := time.Now().UTC()
+	providerUser := username
+	var leases []Lease
+	var leaseExpiresAt *time.Time
+	if s.Leases != nil && !sharedUsername {
+		lease := s.Leases.newLease(username, now)
+		providerUser = lease.Username
+		leases = []Lease{lease}
+		leaseExpiresAt = &lease.ExpiresAt
 	}
 
-	payload, _ := createRequest.Marshal()
-
-	logging.Debug(fmt.Sprintf("created secret: %s", pod.Name))
-	secretCreated, err := s.Vault.CreateNewSecret(pod.Name, payload)
+	var userCreated bool
+	err = registration.run(stepCreateUser, userFailedCode(provider), func() error {
+		userCreated, err = s.createUser(provider, Credential{Username: providerUser, Password: password, Roles: roleNames, Owner: username})
+		return err
+	}, nil)
 	if err != nil {
-		s.handleValidationError(w, "createSecret", requestId, err)
+		s.audit(AuditActionRegister, AuditDecisionFailed, ref, requestId, err.Error())
+		s.respondWithError(w, requestId, err)
 		return
 	}
 
-	response := models.SolonResponse{SecretCreated: secretCreated, UserCreated: userCreated}
-	middleware.ResponseWithCustomCode(w, http.StatusCreated, response)
-}
+	// a user that already existed or is shared with other pods is still in use and must survive a rollback
+	if userCreated && !sharedUsername {
+		registration.compensate(stepCreateUser, func() error {
+			return s.deleteUser(provider, providerUser)
+		})
+	}
 
-func (s *SolonHandler) handleValidationError(w http.ResponseWriter, field, requestId string, err error) {
-	e := models.ValidationError{
-		ErrorModel: models.ErrorModel{UniqueCode: requestId},
-		Messages: []models.ValidationMessages{
-			{
-				Field:   field,
-				Message: err.Error(),
+	// the certificate is only useful to pods that talk to elasticsearch
+	var elasticCert string
+	if provider.Name() == ProviderElasticsearch {
+		elasticCert = string(s.ElasticCert)
+	}
+
+	logging.Debug(fmt.Sprintf("created new %s user: %s from pod: %s", provider.Name(), providerUser, pod.Name))
+	createRequest := registrationSecret{
+		Data: registrationData{
+			Username:       providerUser,
+			Password:       password,
+			ElasticCERT:    elasticCert,
+			LeaseExpiresAt: leaseExpiresAt,
+			Registration: &Registration{
+				PodName:        pod.Name,
+				PodUID:         string(pod.UID),
+				Username:       username,
+				SharedUsername: sharedUsername,
+				Provider:       provider.Name(),
+				Roles:          roleNames,
+				Leases:         leases,
+				IdempotencyKey: idempotencyKey,
+				CreatedAt:      now,
 			},
 		},
 	}
-	middleware.ResponseWithJson(w, e)
-}
 
-func (s *SolonHandler) areValidAnnotations(annotations map[string]string, req *delphi.SolonCreationRequest) bool {
-	var validAccess bool
-	var validRole bool
-
-	for key, value := range annotations {
-		if key == s.AccessAnnotation {
-			splittedValues := strings.Split(value, ";")
-			for _, a := range req.Access {
-				if sliceContains(splittedValues, a) {
-					validAccess = true
-					break
-				}
-			}
-		} else if key == s.RoleAnnotation && value == req.Role {
-			validRole = true
-		}
+	payload, _ := createRequest.Marshal()
+
+	var secretCreated bool
+	err = registration.run(stepCreateSecret, delphi.ErrorCodeVaultSecretFailed, func() error {
+		return s.Metrics.timeVault("create_secret", func() error {
+			secretCreated, err = s.Vault.CreateNewSecret(ref.secretName(), payload)
+			return err
+		})
+	}, nil)
+	if err != nil {
+		s.audit(AuditActionRegister, AuditDecisionFailed, ref, requestId, err.Error())
+		s.respondWithError(w, requestId, err)
+		return
 	}
 
-	return validAccess && validRole
-}
+	logging.Debug(fmt.Sprintf("created secret: %s", ref.secretName()))
+	s.audit(AuditActionRegister, AuditDecisionAllowed, ref, requestId, fmt.Sprintf("registered %s user %s with roles %s", provider.Name(), providerUser, strings.Join(roleNames, ",")))
 
-func (s *SolonHandler) generateRoleNames(req *delphi.SolonCreationRequest) []string {
-	var roleNames []string
-	for _, a := range req.Access {
-		roleName := fmt.Sprintf("%s_%s", a, req.Role)
-		roleNames = append(roleNames, roleName)
-	}
-	return roleNames
+	response := models.SolonResponse{SecretCreated: secretCreated, UserCreated: userCreated}
+	middleware.ResponseWithCustomCode(w, http.StatusCreated, response)
 }
 
-func sliceContains(slice []string, str string) bool {
-	for _, s := range slice {
-		if s == str {
-			return true
-		}
+func newUserRequest(username, password string, roles []string) elasticmodels.CreateUserRequest {
+	return elasticmodels.CreateUserRequest{
+		Password: password,
+		Roles:    roles,
+		FullName: username,
+		Email:    fmt.Sprintf("%s@odysseia-greek.com", username),
+		Metadata: &elasticmodels.Metadata{Version: 1},
 	}
-	return false
 }
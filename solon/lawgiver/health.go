@@ -0,0 +1,360 @@
+package lawgiver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	elasticmodels "github.com/odysseia-greek/agora/aristoteles/models"
+	plato "github.com/odysseia-greek/agora/plato/config"
+	"github.com/odysseia-greek/agora/plato/middleware"
+	delphi "github.com/odysseia-greek/delphi/solon/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	dependencyVault      string = "vault"
+	dependencyElastic    string = "elasticsearch"
+	dependencyKubernetes string = "kubernetes"
+	dependencyTracer     string = "tracer"
+
+	healthCheckTimeout = 5 * time.Second
+)
+
+// ClusterHealth returns the status of the elasticsearch cluster: green, yellow or red
+type ClusterHealth interface {
+	ClusterStatus(ctx context.Context) (string, error)
+}
+
+// dependencyCheck returns the status of a dependency, an error is kept as the last error of the dependency
+type dependencyCheck func(ctx context.Context) (delphi.HealthStatus, map[string]string, error)
+
+// healthHistory keeps the last error and the last success of every dependency between checks
+type healthHistory struct {
+	mu           sync.Mutex
+	dependencies map[string]*dependencyHistory
+}
+
+type dependencyHistory struct {
+	lastError   string
+	lastErrorAt *time.Time
+	lastSuccess *time.Time
+	// running is the check that has not returned yet, a check that ignores its context and hangs is not started again
+	running *runningCheck
+}
+
+// runningCheck hands the result of a check to every report waiting for it, done is closed once the check returned
+type runningCheck struct {
+	done   chan struct{}
+	result dependencyResult
+}
+
+// dependency returns the history of the dependency, the lock has to be held
+func (h *healthHistory) dependency(name string) *dependencyHistory {
+	if h.dependencies == nil {
+		h.dependencies = make(map[string]*dependencyHistory)
+	}
+
+	history, ok := h.dependencies[name]
+	if !ok {
+		history = &dependencyHistory{}
+		h.dependencies[name] = history
+	}
+
+	return history
+}
+
+// start runs the check unless the previous check of the dependency is still running, in which case that one is
+// waited for. A check that ignores the deadline then holds a single goroutine instead of one for every probe
+func (h *healthHistory) start(ctx context.Context, name string, check dependencyCheck) *runningCheck {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	history := h.dependency(name)
+	if history.running != nil {
+		return history.running
+	}
+
+	running := &runningCheck{done: make(chan struct{})}
+	history.running = running
+	go func() {
+		status, details, err := check(ctx)
+		running.result = dependencyResult{status: status, details: details, err: err}
+
+		h.mu.Lock()
+		history.running = nil
+		h.mu.Unlock()
+		close(running.done)
+	}()
+
+	return running
+}
+
+func (h *healthHistory) record(name string, err error, now time.Time) dependencyHistory {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	history := h.dependency(name)
+	if err != nil {
+		history.lastError = err.Error()
+		history.lastErrorAt = &now
+	} else {
+		history.lastSuccess = &now
+	}
+
+	return *history
+}
+
+// Health checks every dependency and reports their combined status as described by delphi.OverallHealth. It always
+// answers 200 so a failing dependency does not get solon restarted by its liveness probe, Ready is the check for traffic
+func (s *SolonHandler) Health(w http.ResponseWriter, req *http.Request) {
+	requestId := req.Header.Get(plato.HeaderKey)
+	w.Header().Set(plato.HeaderKey, requestId)
+
+	report := s.healthReport(req.Context())
+	middleware.ResponseWithCustomCode(w, http.StatusOK, report)
+}
+
+// healthReport checks the dependencies concurrently under a single deadline, /health is the liveness probe and
+// has to answer in time even when every dependency hangs
+func (s *SolonHandler) healthReport(ctx context.Context) delphi.HealthReport {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	type dependency struct {
+		name     string
+		critical bool
+		check    dependencyCheck
+	}
+
+	checks := []dependency{
+		{name: dependencyVault, critical: true, check: s.vaultHealth},
+		{name: dependencyElastic, critical: true, check: s.elasticHealth},
+	}
+
+	if s.KubeAPI != nil {
+		checks = append(checks, dependency{name: dependencyKubernetes, critical: true, check: s.kubernetesHealth})
+	}
+
+	checks = append(checks, dependency{name: dependencyTracer, critical: false, check: s.tracerHealth})
+
+	dependencies := make([]delphi.DependencyHealth, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dependencies[i] = s.checkDependency(ctx, c.name, c.critical, c.check)
+		}()
+	}
+	wg.Wait()
+
+	status := delphi.OverallHealth(dependencies)
+	return delphi.HealthReport{
+		Healthy:      status.Serving(),
+		Status:       status,
+		Time:         time.Now().UTC().Format(time.RFC3339),
+		Dependencies: dependencies,
+	}
+}
+
+// dependencyResult is what a check returned
+type dependencyResult struct {
+	status  delphi.HealthStatus
+	details map[string]string
+	err     error
+}
+
+func (s *SolonHandler) checkDependency(ctx context.Context, name string, critical bool, check dependencyCheck) delphi.DependencyHealth {
+	start := time.Now()
+
+	running := s.healthHistory.start(ctx, name, check)
+
+	var result dependencyResult
+	select {
+	case <-running.done:
+		result = running.result
+	case <-ctx.Done():
+		result = dependencyResult{err: fmt.Errorf("%s did not answer in time: %w", name, ctx.Err())}
+	}
+	latency := time.Since(start)
+
+	status := result.status
+	if status == "" {
+		status = delphi.HealthStatusHealthy
+		if result.err != nil {
+			status = delphi.HealthStatusUnhealthy
+		}
+	}
+
+	history := s.healthHistory.record(name, result.err, time.Now().UTC())
+	return delphi.DependencyHealth{
+		Name:        name,
+		Status:      status,
+		Critical:    critical,
+		LatencyMs:   latency.Milliseconds(),
+		LastError:   history.lastError,
+		LastErrorAt: history.lastErrorAt,
+		LastSuccess: history.lastSuccess,
+		Details:     result.details,
+	}
+}
+
+// vaultHealth fails on a sealed or uninitialised vault, a standby is healthy since it forwards requests to the leader
+func (s *SolonHandler) vaultHealth(ctx context.Context) (delphi.HealthStatus, map[string]string, error) {
+	reporter, ok := s.Vault.(vaultStatusReporter)
+	if !ok {
+		return "", nil, s.vaultReady()
+	}
+
+	response, err := reporter.HealthStatus(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	details := map[string]string{
+		"initialized": strconv.FormatBool(response.Initialized),
+		"sealed":      strconv.FormatBool(response.Sealed),
+		"standby":     strconv.FormatBool(response.Standby || response.PerformanceStandby),
+		"leader":      strconv.FormatBool(response.Initialized && !response.Sealed && !response.Standby && !response.PerformanceStandby),
+		"version":     response.Version,
+	}
+
+	switch {
+	case !response.Initialized:
+		return "", details, errors.New("vault is not initialized")
+	case response.Sealed:
+		return "", details, errors.New("vault is sealed")
+	}
+
+	return "", details, nil
+}
+
+// elasticHealth maps the cluster status on the health of the dependency, a yellow cluster still serves requests
+func (s *SolonHandler) elasticHealth(ctx context.Context) (delphi.HealthStatus, map[string]string, error) {
+	info := s.Elastic.Health().Info()
+	if !info.Healthy {
+		return "", nil, errors.New("elasticsearch is not healthy")
+	}
+
+	details := map[string]string{
+		"clusterName":   info.ClusterName,
+		"serverName":    info.ServerName,
+		"serverVersion": info.ServerVersion,
+	}
+
+	if s.ElasticCluster == nil {
+		return "", details, nil
+	}
+
+	clusterStatus, err := s.ElasticCluster.ClusterStatus(ctx)
+	if err != nil {
+		return "", details, err
+	}
+
+	details["clusterStatus"] = clusterStatus
+	switch clusterStatus {
+	case "green":
+		return delphi.HealthStatusHealthy, details, nil
+	case "yellow":
+		return delphi.HealthStatusDegraded, details, errors.New("elasticsearch cluster status is yellow")
+	default:
+		return delphi.HealthStatusUnhealthy, details, fmt.Errorf("elasticsearch cluster status is %s", clusterStatus)
+	}
+}
+
+func (s *SolonHandler) kubernetesHealth(ctx context.Context) (delphi.HealthStatus, map[string]string, error) {
+	version, err := s.KubeAPI.ServerVersion()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return "", map[string]string{"version": version.GitVersion}, nil
+}
+
+// tracerHealth is optional, solon keeps serving without traces
+func (s *SolonHandler) tracerHealth(ctx context.Context) (delphi.HealthStatus, map[string]string, error) {
+	tracer := s.tracer()
+	mode := "streaming"
+	if _, ok := tracer.(*NoopTracer); ok {
+		mode = TracingModeDisabled
+	}
+
+	err := tracer.Health(ctx)
+	if err != nil && mode == TracingModeDisabled {
+		mode = TracingModeDegraded
+	}
+
+	return "", map[string]string{"mode": mode}, err
+}
+
+// elasticClusterHealth reads _cluster/health, the elastic client only reports if a node answers
+type elasticClusterHealth struct {
+	client   *http.Client
+	service  string
+	username string
+	password string
+}
+
+func newElasticClusterHealth(cfg elasticmodels.Config) (*elasticClusterHealth, error) {
+	client, err := httpClientTrusting(cfg.ElasticCERT, "elasticsearch")
+	if err != nil {
+		return nil, err
+	}
+
+	return &elasticClusterHealth{
+		client:   client,
+		service:  strings.TrimSuffix(cfg.Service, "/"),
+		username: cfg.Username,
+		password: cfg.Password,
+	}, nil
+}
+
+// httpClientTrusting returns a client that trusts the pem encoded certificate of the service, or the system roots without one
+func httpClientTrusting(cert, service string) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cert != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(cert)) {
+			return nil, fmt.Errorf("failed to parse the %s certificate", service)
+		}
+
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+func (e *elasticClusterHealth) ClusterStatus(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.service+"/_cluster/health", nil)
+	if err != nil {
+		return "", err
+	}
+
+	req.SetBasicAuth(e.username, e.password)
+	response, err := e.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("cluster health returned %d", response.StatusCode)
+	}
+
+	var clusterHealth struct {
+		Status string `json:"status"`
+	}
+	err = json.NewDecoder(response.Body).Decode(&clusterHealth)
+	if err != nil {
+		return "", err
+	}
+
+	return clusterHealth.Status, nil
+}
@@ -0,0 +1,198 @@
+package lawgiver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/hashicorp/vault/api"
+	elastic "github.com/odysseia-greek/agora/aristoteles"
+	delphi "github.com/odysseia-greek/delphi/solon/models"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeClusterHealth struct {
+	status string
+	err    error
+}
+
+func (f *fakeClusterHealth) ClusterStatus(ctx context.Context) (string, error) {
+	return f.status, f.err
+}
+
+// hangingClusterHealth ignores its context and answers once it is released
+type hangingClusterHealth struct {
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (h *hangingClusterHealth) ClusterStatus(ctx context.Context) (string, error) {
+	h.calls.Add(1)
+	<-h.release
+	return "green", nil
+}
+
+// statusVault is a vault that returns the full sys/health response
+type statusVault struct {
+	fakeVault
+	response *api.HealthResponse
+}
+
+func (v *statusVault) HealthStatus(ctx context.Context) (*api.HealthResponse, error) {
+	return v.response, nil
+}
+
+func TestHealthReport(t *testing.T) {
+	newTestHandler := func(t *testing.T) *SolonHandler {
+		mockElasticClient, err := elastic.NewMockClient("info", 200)
+		assert.Nil(t, err)
+
+		return &SolonHandler{
+			Vault:          &statusVault{response: &api.HealthResponse{Initialized: true, Version: "1.17.2"}},
+			Elastic:        mockElasticClient,
+			ElasticCluster: &fakeClusterHealth{status: "green"},
+			KubeAPI:        &fakediscovery.FakeDiscovery{Fake: &k8stesting.Fake{}, FakedServerVersion: &version.Info{GitVersion: "v1.31.2"}},
+		}
+	}
+
+	dependency := func(report delphi.HealthReport, name string) delphi.DependencyHealth {
+		for _, dependency := range report.Dependencies {
+			if dependency.Name == name {
+				return dependency
+			}
+		}
+		return delphi.DependencyHealth{}
+	}
+
+	t.Run("Healthy", func(t *testing.T) {
+		router := InitRoutes(newTestHandler(t))
+		response := performGetRequest(router, "/solon/v1/health")
+		assert.Equal(t, http.StatusOK, response.Code)
+
+		var sut delphi.HealthReport
+		err := json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+		assert.True(t, sut.Healthy)
+		assert.Equal(t, delphi.HealthStatusHealthy, sut.Status)
+		assert.Len(t, sut.Dependencies, 4)
+
+		vault := dependency(sut, dependencyVault)
+		assert.Equal(t, "true", vault.Details["leader"])
+		assert.NotNil(t, vault.LastSuccess)
+		assert.Equal(t, "v1.31.2", dependency(sut, dependencyKubernetes).Details["version"])
+		assert.Equal(t, TracingModeDisabled, dependency(sut, dependencyTracer).Details["mode"])
+	})
+
+	t.Run("SealedVaultIsUnhealthy", func(t *testing.T) {
+		handler := newTestHandler(t)
+		handler.Vault = &statusVault{response: &api.HealthResponse{Initialized: true, Sealed: true}}
+
+		sut := handler.healthReport(context.Background())
+		assert.False(t, sut.Healthy)
+		assert.Equal(t, delphi.HealthStatusUnhealthy, sut.Status)
+		assert.Equal(t, "vault is sealed", dependency(sut, dependencyVault).LastError)
+	})
+
+	t.Run("StandbyVaultIsNoLeader", func(t *testing.T) {
+		handler := newTestHandler(t)
+		handler.Vault = &statusVault{response: &api.HealthResponse{Initialized: true, Standby: true}}
+
+		sut := handler.healthReport(context.Background())
+		assert.Equal(t, delphi.HealthStatusHealthy, sut.Status)
+		assert.Equal(t, "false", dependency(sut, dependencyVault).Details["leader"])
+	})
+
+	t.Run("YellowClusterIsDegraded", func(t *testing.T) {
+		handler := newTestHandler(t)
+		handler.ElasticCluster = &fakeClusterHealth{status: "yellow"}
+
+		sut := handler.healthReport(context.Background())
+		assert.True(t, sut.Healthy)
+		assert.Equal(t, delphi.HealthStatusDegraded, sut.Status)
+		assert.Equal(t, delphi.HealthStatusDegraded, dependency(sut, dependencyElastic).Status)
+	})
+
+	t.Run("DegradedTracerKeepsServing", func(t *testing.T) {
+		handler := newTestHandler(t)
+		handler.Tracer = NewNoopTracer(errors.New("tracing service not ready"))
+
+		sut := handler.healthReport(context.Background())
+		assert.True(t, sut.Healthy)
+		assert.Equal(t, delphi.HealthStatusDegraded, sut.Status)
+		assert.Equal(t, TracingModeDegraded, dependency(sut, dependencyTracer).Details["mode"])
+	})
+
+	t.Run("HangingDependencyMissesTheDeadline", func(t *testing.T) {
+		handler := newTestHandler(t)
+		hanging := &hangingClusterHealth{release: make(chan struct{})}
+		defer close(hanging.release)
+		handler.ElasticCluster = hanging
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		started := time.Now()
+		sut := handler.healthReport(ctx)
+		assert.Less(t, time.Since(started), time.Second)
+		assert.False(t, sut.Healthy)
+
+		elastic := dependency(sut, dependencyElastic)
+		assert.Equal(t, delphi.HealthStatusUnhealthy, elastic.Status)
+		assert.Contains(t, elastic.LastError, "did not answer in time")
+		assert.Equal(t, delphi.HealthStatusHealthy, dependency(sut, dependencyVault).Status)
+	})
+
+	t.Run("HangingCheckIsNotStartedAgain", func(t *testing.T) {
+		handler := newTestHandler(t)
+		hanging := &hangingClusterHealth{release: make(chan struct{})}
+		handler.ElasticCluster = hanging
+
+		for range 3 {
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			sut := handler.healthReport(ctx)
+			cancel()
+			assert.Equal(t, delphi.HealthStatusUnhealthy, dependency(sut, dependencyElastic).Status)
+		}
+		assert.Equal(t, int32(1), hanging.calls.Load())
+
+		close(hanging.release)
+		assert.Eventually(t, func() bool {
+			handler.healthHistory.mu.Lock()
+			defer handler.healthHistory.mu.Unlock()
+			return handler.healthHistory.dependencies[dependencyElastic].running == nil
+		}, time.Second, 10*time.Millisecond, "the check finishes once it returns")
+	})
+
+	t.Run("LastErrorIsKeptAfterRecovery", func(t *testing.T) {
+		handler := newTestHandler(t)
+		handler.Vault = &fakeVault{down: true}
+		sut := handler.healthReport(context.Background())
+		assert.Equal(t, delphi.HealthStatusUnhealthy, sut.Status)
+
+		handler.Vault = &fakeVault{}
+		sut = handler.healthReport(context.Background())
+		vault := dependency(sut, dependencyVault)
+		assert.Equal(t, delphi.HealthStatusHealthy, vault.Status)
+		assert.Equal(t, "connection refused", vault.LastError)
+		assert.NotNil(t, vault.LastErrorAt)
+		assert.NotNil(t, vault.LastSuccess)
+	})
+}
+
+func TestOverallHealth(t *testing.T) {
+	healthy := delphi.DependencyHealth{Status: delphi.HealthStatusHealthy, Critical: true}
+	optionalDown := delphi.DependencyHealth{Status: delphi.HealthStatusUnhealthy}
+	criticalDegraded := delphi.DependencyHealth{Status: delphi.HealthStatusDegraded, Critical: true}
+	criticalDown := delphi.DependencyHealth{Status: delphi.HealthStatusUnhealthy, Critical: true}
+
+	assert.Equal(t, delphi.HealthStatusHealthy, delphi.OverallHealth([]delphi.DependencyHealth{healthy}))
+	assert.Equal(t, delphi.HealthStatusDegraded, delphi.OverallHealth([]delphi.DependencyHealth{healthy, optionalDown}))
+	assert.Equal(t, delphi.HealthStatusDegraded, delphi.OverallHealth([]delphi.DependencyHealth{criticalDegraded}))
+	assert.Equal(t, delphi.HealthStatusUnhealthy, delphi.OverallHealth([]delphi.DependencyHealth{optionalDown, criticalDown}))
+}
@@ -0,0 +1,175 @@
+package lawgiver
+
+import (
+	"context"
+	"fmt"
+	delphi "github.com/odysseia-greek/delphi/solon/models"
+	authv1 "k8s.io/api/authentication/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// AuthModeServiceAccount authenticates callers with a projected ServiceAccount token checked through the TokenReview
+	// api, it is the default and periandros and aristides send the token of their pod
+	AuthModeServiceAccount string = "serviceaccount"
+	// AuthModeIP matches the remote address of a request with a pod ip, an opt-in fallback for clients without a token
+	AuthModeIP string = "ip"
+
+	EnvAuthMode      string = "SOLON_AUTH_MODE"
+	EnvTokenAudience string = "SOLON_TOKEN_AUDIENCE"
+
+	serviceAccountPrefix string = "system:serviceaccount:"
+	podNameExtraKey      string = "authentication.kubernetes.io/pod-name"
+	podUIDExtraKey       string = "authentication.kubernetes.io/pod-uid"
+)
+
+// identifyCallingPod resolves the pod that made the request based on the configured AuthMode and checks the client
+// certificate of the request belongs to it when those are required, an error is always a *solonError
+func (s *SolonHandler) identifyCallingPod(req *http.Request) (*v1.Pod, error) {
+	pod, err := s.podOfRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.verifyClientCertificate(req, pod); err != nil {
+		return nil, err
+	}
+
+	return pod, nil
+}
+
+func (s *SolonHandler) podOfRequest(req *http.Request) (*v1.Pod, error) {
+	if s.AuthMode != AuthModeIP {
+		return s.verifyServiceAccountToken(req)
+	}
+
+	pod, err := s.verifyRequestOriginIP(req.RemoteAddr)
+	if err != nil {
+		return nil, podLookupError(err)
+	}
+
+	if pod == nil {
+		return nil, newSolonError(delphi.ErrorCodePodNotFound, "pod", fmt.Errorf("no pod could be found for ip %s", req.RemoteAddr))
+	}
+
+	if !s.serves(pod.Namespace) {
+		return nil, newSolonError(delphi.ErrorCodeUnauthenticated, "pod", fmt.Errorf("pod %s runs in namespace %s which is not served", pod.Name, pod.Namespace))
+	}
+
+	return pod, nil
+}
+
+// verifyServiceAccountToken reviews the bearer token of the request and returns the pod the token is bound to
+func (s *SolonHandler) verifyServiceAccountToken(req *http.Request) (*v1.Pod, error) {
+	user, err := s.reviewToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.podOfUser(user)
+}
+
+// reviewToken returns the user the bearer token of the request was issued to
+func (s *SolonHandler) reviewToken(req *http.Request) (authv1.UserInfo, error) {
+	token := bearerToken(req)
+	if token == "" {
+		return authv1.UserInfo{}, newSolonError(delphi.ErrorCodeUnauthenticated, "Authorization", fmt.Errorf("no serviceaccount token found in the Authorization header"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	review := &authv1.TokenReview{
+		Spec: authv1.TokenReviewSpec{
+			Token: token,
+		},
+	}
+
+	if s.TokenAudience != "" {
+		review.Spec.Audiences = []string{s.TokenAudience}
+	}
+
+	result, err := s.TokenReviewer.Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return authv1.UserInfo{}, newSolonError(delphi.ErrorCodeServiceUnavailable, "Authorization", fmt.Errorf("failed to review token: %w", err))
+	}
+
+	if !result.Status.Authenticated {
+		return authv1.UserInfo{}, newSolonError(delphi.ErrorCodeUnauthenticated, "Authorization", fmt.Errorf("token could not be authenticated: %s", result.Status.Error))
+	}
+
+	return result.Status.User, nil
+}
+
+// podOfUser returns the pod a reviewed serviceaccount token is bound to
+func (s *SolonHandler) podOfUser(user authv1.UserInfo) (*v1.Pod, error) {
+	ns, serviceAccount, err := parseServiceAccountUsername(user.Username)
+	if err != nil {
+		return nil, newSolonError(delphi.ErrorCodeUnauthenticated, "Authorization", err)
+	}
+
+	if !s.serves(ns) {
+		return nil, newSolonError(delphi.ErrorCodeUnauthenticated, "Authorization", fmt.Errorf("token belongs to namespace %s which is not served", ns))
+	}
+
+	podName := firstExtra(user.Extra, podNameExtraKey)
+	podUID := firstExtra(user.Extra, podUIDExtraKey)
+	if podName == "" || podUID == "" {
+		return nil, newSolonError(delphi.ErrorCodeUnauthenticated, "Authorization", fmt.Errorf("token for serviceaccount %s is not bound to a pod", serviceAccount))
+	}
+
+	pod, err := s.Pods.ByName(ns, podName)
+	if err != nil {
+		return nil, podLookupError(fmt.Errorf("failed to get pod %s bound to token: %w", podName, err))
+	}
+
+	if pod == nil {
+		return nil, newSolonError(delphi.ErrorCodePodNotFound, "pod", fmt.Errorf("pod %s bound to token could not be found", podName))
+	}
+
+	if string(pod.UID) != podUID {
+		return nil, newSolonError(delphi.ErrorCodeUnauthenticated, "Authorization", fmt.Errorf("token is bound to pod uid %s but pod %s has uid %s", podUID, podName, pod.UID))
+	}
+
+	if pod.Spec.ServiceAccountName != serviceAccount {
+		return nil, newSolonError(delphi.ErrorCodeUnauthenticated, "Authorization", fmt.Errorf("token serviceaccount %s does not match serviceaccount of pod %s", serviceAccount, podName))
+	}
+
+	return pod, nil
+}
+
+func bearerToken(req *http.Request) string {
+	header := req.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return ""
+	}
+
+	return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+}
+
+// parseServiceAccountUsername splits system:serviceaccount:<namespace>:<name> into its namespace and name
+func parseServiceAccountUsername(username string) (string, string, error) {
+	if !strings.HasPrefix(username, serviceAccountPrefix) {
+		return "", "", fmt.Errorf("token user %s is not a serviceaccount", username)
+	}
+
+	parts := strings.Split(strings.TrimPrefix(username, serviceAccountPrefix), ":")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("malformed serviceaccount username: %s", username)
+	}
+
+	return parts[0], parts[1], nil
+}
+
+func firstExtra(extra map[string]authv1.ExtraValue, key string) string {
+	values, ok := extra[key]
+	if !ok || len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
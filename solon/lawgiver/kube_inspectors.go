@@ -1,52 +1,76 @@
 package lawgiver
 
 import (
+	"context"
+	"fmt"
 	"github.com/odysseia-greek/agora/plato/logging"
 	v1 "k8s.io/api/core/v1"
-	"k8s.io/client-go/informers"
-	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
-	"time"
 )
 
-func (s *SolonHandler) StartWatching() error {
-	clientset, err := kubernetes.NewForConfig(s.Kube.RestConfig())
+// StartWatching runs the informers until the context is done, Close shuts them down afterwards
+func (s *SolonHandler) StartWatching(ctx context.Context) error {
+	// Register event handlers
+	_, err := s.Informers.Core().V1().Pods().Informer().AddEventHandler(s.handlePodEvents())
 	if err != nil {
 		return err
 	}
-	factory := informers.NewSharedInformerFactory(clientset, 30*time.Second)
-
-	// Watch Pods and Deployments
-	podInformer := factory.Core().V1().Pods().Informer()
 
-	// Register event handlers
-	podInformer.AddEventHandler(s.handlePodEvents())
+	if s.Policies != nil {
+		_, err = s.Informers.Core().V1().ConfigMaps().Informer().AddEventHandler(s.handlePolicyEvents())
+		if err != nil {
+			return err
+		}
+	}
 
 	// Start informers
-	stopCh := make(chan struct{})
-	factory.Start(stopCh)
+	s.Informers.Start(ctx.Done())
 
-	<-stopCh // Keep running indefinitely
+	for informer, synced := range s.Informers.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return fmt.Errorf("failed to sync informer for %v", informer)
+		}
+	}
+
+	logging.System(fmt.Sprintf("pod cache synced with %d pods", s.Pods.Size()))
+
+	<-ctx.Done()
 	return nil
 }
 
+// handlePodEvents cleans up after deleted pods once the grace window is over, a pod added under the same name
+// before then cancels the cleanup
 func (s *SolonHandler) handlePodEvents() cache.ResourceEventHandlerFuncs {
 	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			pod, ok := obj.(*v1.Pod)
+			if !ok || !s.serves(pod.Namespace) {
+				return
+			}
+
+			ref := refOf(pod.Namespace, pod.Name)
+			if s.Cleanup.cancel(ref) {
+				logging.System(fmt.Sprintf("%s was added within the grace window, its cleanup is cancelled", ref))
+			}
+		},
 		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+
 			pod, ok := obj.(*v1.Pod)
 			if !ok {
-				logging.Error("failed to cast obj to Pod")
+				logging.Error(fmt.Sprintf("failed to cast %T to Pod", obj))
 				return
 			}
 
-			if pod.Namespace != s.Namespace {
+			if !s.serves(pod.Namespace) {
 				return
 			}
 
-			err := s.deleteOrphans(pod)
-			if err != nil {
-				logging.Error(err.Error())
-			}
+			s.Cleanup.schedule(refOf(pod.Namespace, pod.Name), func() {
+				s.cleanupDeletedPod(pod)
+			})
 		},
 	}
 }
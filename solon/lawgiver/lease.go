@@ -0,0 +1,229 @@
+package lawgiver
+
+import (
+	"context"
+	"fmt"
+	"github.com/odysseia-greek/agora/plato/generator"
+	"github.com/odysseia-greek/agora/plato/logging"
+	delphi "github.com/odysseia-greek/delphi/solon/models"
+	"time"
+)
+
+const (
+	// EnvCredentialTTL is how long leased credentials live, callers of aristides keep theirs fresh with
+	// diplomat.WatchSecret and a ttl of 0 hands out static passwords instead
+	EnvCredentialTTL string = "SOLON_CREDENTIAL_TTL"
+
+	defaultCredentialTTL string = "24h"
+	// stepRenewLease is the saga step that creates the user of a new lease
+	stepRenewLease string = "renewLease"
+)
+
+// Lease is a single elastic user handed to a pod, it is revoked once it expires
+type Lease struct {
+	Username  string    `json:"username"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Revoked   bool      `json:"revoked,omitempty"`
+}
+
+// LeaseManager hands out elastic credentials with a ttl. While a pod is alive a new lease is issued once the current
+// one has less than RenewBefore left, and every expired lease is revoked. A nil LeaseManager hands out static passwords
+type LeaseManager struct {
+	TTL         time.Duration
+	RenewBefore time.Duration
+	Interval    time.Duration
+}
+
+// NewLeaseManager renews leases in the last third of their ttl and checks six times per ttl, a ttl of zero disables leases
+func NewLeaseManager(ttl time.Duration) *LeaseManager {
+	if ttl <= 0 {
+		return nil
+	}
+
+	return &LeaseManager{
+		TTL:         ttl,
+		RenewBefore: ttl / 3,
+		Interval:    ttl / 6,
+	}
+}
+
+// newLease returns a lease with a user that is unique for the moment it was issued, in nanoseconds so a rotation
+// right after a registration or renewal does not end up with the user it is meant to replace
+func (l *LeaseManager) newLease(username string, now time.Time) Lease {
+	return Lease{
+		Username:  fmt.Sprintf("%s_%d", username, now.UnixNano()),
+		ExpiresAt: now.Add(l.TTL),
+	}
+}
+
+// StartRenewingLeases renews and revokes leases every interval until the context is done
+func (s *SolonHandler) StartRenewingLeases(ctx context.Context) {
+	if s.Leases == nil {
+		logging.System("credential leases disabled, elastic passwords live as long as their pod")
+		return
+	}
+
+	logging.System(fmt.Sprintf("credentials are leased for %s and renewed %s before expiry", s.Leases.TTL, s.Leases.RenewBefore))
+
+	ticker := time.NewTicker(s.Leases.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := s.renewLeases(time.Now().UTC())
+			if err != nil {
+				logging.Error(fmt.Sprintf("failed to renew leases: %s", err.Error()))
+			}
+		}
+	}
+}
+
+// renewLeases walks every registration with leases, pods that are gone are left to the cleanup
+func (s *SolonHandler) renewLeases(now time.Time) error {
+	refs, err := s.listRegistrations()
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		data, err := s.readRegistrationData(ref.secretName())
+		if err != nil {
+			logging.Error(fmt.Sprintf("failed to read secret %s: %s", ref.secretName(), err.Error()))
+			continue
+		}
+
+		if data == nil || data.Registration == nil || len(data.Registration.Leases) == 0 {
+			continue
+		}
+
+		live, err := s.isLivePod(ref)
+		if err != nil {
+			logging.Error(fmt.Sprintf("failed to look up pod %s: %s", ref, err.Error()))
+			continue
+		}
+
+		err = s.renewLease(ref, data, live, now)
+		if err != nil {
+			logging.Error(fmt.Sprintf("failed to renew lease of %s: %s", ref, err.Error()))
+		}
+	}
+
+	return nil
+}
+
+// renewLease issues a new lease when the current one is about to expire and revokes every lease that expired
+func (s *SolonHandler) renewLease(pod podRef, data *registrationData, live bool, now time.Time) error {
+	registration := data.Registration
+	current := registration.Leases[len(registration.Leases)-1]
+	changed := false
+
+	provider, err := s.providerOfRegistration(data)
+	if err != nil {
+		return err
+	}
+
+	if live && current.ExpiresAt.Sub(now) < s.Leases.RenewBefore {
+		lease, err := s.issueLease(pod, data, now)
+		if err != nil {
+			return err
+		}
+
+		s.audit(AuditActionLeaseRenew, AuditDecisionAllowed, pod, "", fmt.Sprintf("issued %s valid until %s", lease.Username, lease.ExpiresAt.Format(time.RFC3339)))
+	}
+
+	// revoked leases are dropped from the record, except the last one so a live pod keeps being renewed
+	var remaining []Lease
+	for i, lease := range registration.Leases {
+		last := i == len(registration.Leases)-1
+		if !lease.Revoked && !lease.ExpiresAt.After(now) {
+			err := s.deleteUser(provider, lease.Username)
+			if err != nil {
+				s.audit(AuditActionLeaseRevoke, AuditDecisionFailed, pod, "", fmt.Sprintf("failed to revoke %s: %s", lease.Username, err.Error()))
+				remaining = append(remaining, lease)
+				continue
+			}
+
+			s.audit(AuditActionLeaseRevoke, AuditDecisionAllowed, pod, "", fmt.Sprintf("revoked %s expired at %s", lease.Username, lease.ExpiresAt.Format(time.RFC3339)))
+			lease.Revoked = true
+			changed = true
+		}
+
+		if lease.Revoked && !last {
+			changed = true
+			continue
+		}
+
+		remaining = append(remaining, lease)
+	}
+
+	if !changed {
+		return nil
+	}
+
+	registration.Leases = remaining
+	return s.writeRegistrationData(pod.secretName(), data)
+}
+
+// issueLease creates the user of a new lease and stores its credentials as a new version of the secret of the pod,
+// the users of earlier leases keep working until they expire
+func (s *SolonHandler) issueLease(pod podRef, data *registrationData, now time.Time) (Lease, error) {
+	registration := data.Registration
+	lease := s.Leases.newLease(registration.Username, now)
+
+	provider, err := s.providerOfRegistration(data)
+	if err != nil {
+		return Lease{}, err
+	}
+
+	renewal := newSaga(pod.Name)
+
+	var password string
+	err = renewal.run(stepGeneratePassword, delphi.ErrorCodePasswordGenerationFailed, func() error {
+		var err error
+		password, err = generator.RandomPassword(18)
+		return err
+	}, nil)
+	if err != nil {
+		return Lease{}, err
+	}
+
+	err = renewal.run(stepRenewLease, userFailedCode(provider), func() error {
+		_, err := s.createUser(provider, Credential{Username: lease.Username, Password: password, Roles: registration.Roles, Owner: registration.Username})
+		return err
+	}, func() error {
+		return s.deleteUser(provider, lease.Username)
+	})
+	if err != nil {
+		return Lease{}, err
+	}
+
+	data.Username = lease.Username
+	data.Password = password
+	data.LeaseExpiresAt = &lease.ExpiresAt
+	registration.Leases = append(registration.Leases, lease)
+
+	err = renewal.run(stepCreateSecret, delphi.ErrorCodeVaultSecretFailed, func() error {
+		return s.writeRegistrationData(pod.secretName(), data)
+	}, nil)
+	if err != nil {
+		return Lease{}, err
+	}
+
+	return lease, nil
+}
+
+// writeRegistrationData stores a new version of the secret of a pod
+func (s *SolonHandler) writeRegistrationData(secretName string, data *registrationData) error {
+	payload, err := (&registrationSecret{Data: *data}).Marshal()
+	if err != nil {
+		return err
+	}
+
+	return s.Metrics.timeVault("create_secret", func() error {
+		_, err := s.Vault.CreateNewSecret(secretName, payload)
+		return err
+	})
+}
@@ -0,0 +1,151 @@
+package lawgiver
+
+import (
+	elastic "github.com/odysseia-greek/agora/aristoteles"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+	"time"
+)
+
+func TestLeases(t *testing.T) {
+	ns := "test"
+	podName := "sokrates-5d8f7c9b4-abcde"
+	secretName := refOf(ns, podName).secretName()
+	now := time.Date(2024, 11, 2, 12, 0, 0, 0, time.UTC)
+	leases := NewLeaseManager(3 * time.Hour)
+
+	secretWithLeases := func(leases ...Lease) map[string]interface{} {
+		var records []interface{}
+		for _, lease := range leases {
+			records = append(records, map[string]interface{}{
+				"username":  lease.Username,
+				"expiresAt": lease.ExpiresAt.Format(time.RFC3339),
+				"revoked":   lease.Revoked,
+			})
+		}
+
+		return map[string]interface{}{
+			"elasticUsername": leases[len(leases)-1].Username,
+			"elasticPassword": "oldpassword",
+			"registration": map[string]interface{}{
+				"podName":  podName,
+				"username": "sokratesabcde",
+				"roles":    []interface{}{"dictionary_api"},
+				"leases":   records,
+			},
+		}
+	}
+
+	newTestHandler := func(t *testing.T, vault *fakeVault, fixtures ...string) *SolonHandler {
+		pods := newTestPodCache()
+		err := addPodForTest(podName, ns, "dictionary", "api", pods)
+		assert.Nil(t, err)
+
+		var raw [][]byte
+		for _, fixture := range fixtures {
+			raw = append(raw, []byte(fixture))
+		}
+		mockElasticClient, err := elastic.NewMockClient(raw, 200)
+		assert.Nil(t, err)
+
+		return &SolonHandler{Vault: vault, Elastic: mockElasticClient, Pods: pods, Namespace: ns, Leases: leases}
+	}
+
+	t.Run("NewLeaseIsUniquePerIssue", func(t *testing.T) {
+		lease := leases.newLease("sokratesabcde", now)
+		assert.Equal(t, "sokratesabcde_1730548800000000000", lease.Username)
+		assert.Equal(t, now.Add(3*time.Hour), lease.ExpiresAt)
+
+		next := leases.newLease("sokratesabcde", now.Add(time.Millisecond))
+		assert.NotEqual(t, lease.Username, next.Username, "leases issued within the same second get their own user")
+	})
+
+	t.Run("ZeroTTLDisablesLeases", func(t *testing.T) {
+		assert.Nil(t, NewLeaseManager(0))
+	})
+
+	t.Run("FreshLeaseIsLeftAlone", func(t *testing.T) {
+		vault := &fakeVault{secrets: map[string]map[string]interface{}{
+			secretName: secretWithLeases(Lease{Username: "sokratesabcde_1", ExpiresAt: now.Add(2 * time.Hour)}),
+		}}
+		handler := newTestHandler(t, vault)
+
+		err := handler.renewLeases(now)
+		assert.Nil(t, err)
+
+		data, err := handler.readRegistrationData(secretName)
+		assert.Nil(t, err)
+		assert.Equal(t, "oldpassword", data.Password)
+		assert.Len(t, data.Registration.Leases, 1)
+	})
+
+	t.Run("RenewsBeforeExpiry", func(t *testing.T) {
+		vault := &fakeVault{secrets: map[string]map[string]interface{}{
+			secretName: secretWithLeases(Lease{Username: "sokratesabcde_1", ExpiresAt: now.Add(30 * time.Minute)}),
+		}}
+		handler := newTestHandler(t, vault, `{"created":true}`)
+
+		err := handler.renewLeases(now)
+		assert.Nil(t, err)
+
+		data, err := handler.readRegistrationData(secretName)
+		assert.Nil(t, err)
+		assert.Equal(t, "sokratesabcde_1730548800000000000", data.Username)
+		assert.NotEqual(t, "oldpassword", data.Password)
+		assert.Equal(t, now.Add(3*time.Hour), *data.LeaseExpiresAt)
+		assert.Len(t, data.Registration.Leases, 2)
+		assert.Equal(t, []string{"sokratesabcde_1", "sokratesabcde_1730548800000000000"}, data.ownedUsernames(podName))
+	})
+
+	t.Run("TerminatingPodDoesNotStopRenewal", func(t *testing.T) {
+		terminating := runningPodForTest("alkibiades-1a2b3c4d5-klmno", ns, "dictionary", "api")
+		terminating.DeletionTimestamp = &metav1.Time{Time: now}
+		vault := &fakeVault{secrets: map[string]map[string]interface{}{
+			secretName:                               secretWithLeases(Lease{Username: "sokratesabcde_1", ExpiresAt: now.Add(30 * time.Minute)}),
+			refOf(ns, terminating.Name).secretName(): secretWithLeases(Lease{Username: "alkibiadesklmno_1", ExpiresAt: now.Add(2 * time.Hour)}),
+		}}
+		handler := newTestHandler(t, vault, `{"created":true}`)
+		assert.Nil(t, handler.Pods.indexer.Add(terminating))
+
+		err := handler.renewLeases(now)
+		assert.Nil(t, err)
+
+		data, err := handler.readRegistrationData(secretName)
+		assert.Nil(t, err)
+		assert.Len(t, data.Registration.Leases, 2)
+	})
+
+	t.Run("RevokesExpiredLeases", func(t *testing.T) {
+		vault := &fakeVault{secrets: map[string]map[string]interface{}{
+			secretName: secretWithLeases(
+				Lease{Username: "sokratesabcde_1", ExpiresAt: now.Add(-time.Minute)},
+				Lease{Username: "sokratesabcde_2", ExpiresAt: now.Add(2 * time.Hour)},
+			),
+		}}
+		handler := newTestHandler(t, vault, `{"found":true}`)
+
+		err := handler.renewLeases(now)
+		assert.Nil(t, err)
+
+		data, err := handler.readRegistrationData(secretName)
+		assert.Nil(t, err)
+		assert.Equal(t, []Lease{{Username: "sokratesabcde_2", ExpiresAt: now.Add(2 * time.Hour)}}, data.Registration.Leases)
+	})
+
+	t.Run("GonePodIsRevokedNotRenewed", func(t *testing.T) {
+		vault := &fakeVault{secrets: map[string]map[string]interface{}{
+			"test/herodotos-7c9b4d8f5-fghij": secretWithLeases(Lease{Username: "herodotosfghij_1", ExpiresAt: now.Add(-time.Minute)}),
+		}}
+		handler := newTestHandler(t, vault, `{"found":true}`)
+
+		err := handler.renewLeases(now)
+		assert.Nil(t, err)
+
+		data, err := handler.readRegistrationData("test/herodotos-7c9b4d8f5-fghij")
+		assert.Nil(t, err)
+		assert.Len(t, data.Registration.Leases, 1)
+		assert.True(t, data.Registration.Leases[0].Revoked)
+		assert.Empty(t, data.ownedUsernames("herodotos-7c9b4d8f5-fghij"))
+	})
+}
@@ -0,0 +1,232 @@
+package lawgiver
+
+import (
+	"github.com/odysseia-greek/agora/plato/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"time"
+)
+
+const (
+	OutcomeSuccess     string = "success"
+	OutcomeClientError string = "client_error"
+	OutcomeServerError string = "server_error"
+
+	OrphanResourceElasticUser string = "elastic_user"
+	OrphanResourceVaultSecret string = "vault_secret"
+	OrphanResourceVaultPolicy string = "vault_policy"
+	// orphanResourceUserSuffix follows the provider name for users outside elasticsearch, such as postgres_user
+	orphanResourceUserSuffix string = "_user"
+)
+
+// latencyBuckets are the upper bounds in seconds used for every latency histogram
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics keeps the counters and histograms solon exposes to prometheus in a registry of its own.
+// A nil Metrics discards every observation so handlers can be tested without it
+type Metrics struct {
+	registry         *prometheus.Registry
+	handler          http.Handler
+	requests         *prometheus.CounterVec
+	requestDuration  *prometheus.HistogramVec
+	vaultDuration    *prometheus.HistogramVec
+	vaultErrors      *prometheus.CounterVec
+	elasticDuration  *prometheus.HistogramVec
+	elasticErrors    *prometheus.CounterVec
+	providerDuration *prometheus.HistogramVec
+	providerErrors   *prometheus.CounterVec
+	tokensIssued     prometheus.Counter
+	tokenRejects     *prometheus.CounterVec
+	orphanCleanups   *prometheus.CounterVec
+}
+
+const (
+	metricRequestsTotal    string = "solon_http_requests_total"
+	metricRequestDuration  string = "solon_http_request_duration_seconds"
+	metricVaultDuration    string = "solon_vault_request_duration_seconds"
+	metricVaultErrors      string = "solon_vault_errors_total"
+	metricElasticDuration  string = "solon_elastic_request_duration_seconds"
+	metricElasticErrors    string = "solon_elastic_errors_total"
+	metricProviderDuration string = "solon_credential_provider_request_duration_seconds"
+	metricProviderErrors   string = "solon_credential_provider_errors_total"
+	metricTokensIssued     string = "solon_tokens_issued_total"
+	metricTokenRejects     string = "solon_token_rejections_total"
+	metricOrphanCleanups   string = "solon_orphan_cleanups_total"
+	metricPodCacheSize     string = "solon_pod_cache_size"
+	metricPendingCleanups  string = "solon_pending_cleanups"
+	labelRoute             string = "route"
+	labelOutcome           string = "outcome"
+	labelOperation         string = "operation"
+	labelProvider          string = "provider"
+	labelResource          string = "resource"
+	labelReason            string = "reason"
+)
+
+// NewMetrics registers the solon metrics next to the go and process collectors promhttp.Handler serves by default
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry:         prometheus.NewRegistry(),
+		requests:         newCounterVec(metricRequestsTotal, "Requests handled per route and outcome.", labelRoute, labelOutcome),
+		requestDuration:  newHistogramVec(metricRequestDuration, "Latency of requests per route and outcome.", labelRoute, labelOutcome),
+		vaultDuration:    newHistogramVec(metricVaultDuration, "Latency of calls to vault per operation.", labelOperation),
+		vaultErrors:      newCounterVec(metricVaultErrors, "Failed calls to vault per operation.", labelOperation),
+		elasticDuration:  newHistogramVec(metricElasticDuration, "Latency of calls to elasticsearch per operation.", labelOperation),
+		elasticErrors:    newCounterVec(metricElasticErrors, "Failed calls to elasticsearch per operation.", labelOperation),
+		providerDuration: newHistogramVec(metricProviderDuration, "Latency of calls to credential providers other than elasticsearch per operation.", labelProvider, labelOperation),
+		providerErrors:   newCounterVec(metricProviderErrors, "Failed calls to credential providers other than elasticsearch per operation.", labelProvider, labelOperation),
+		tokensIssued:     prometheus.NewCounter(prometheus.CounterOpts{Name: metricTokensIssued, Help: "One time tokens issued to pods."}),
+		tokenRejects:     newCounterVec(metricTokenRejects, "Token requests refused by the rate limits per reason.", labelReason),
+		orphanCleanups:   newCounterVec(metricOrphanCleanups, "Orphaned resources cleaned up per resource type and outcome.", labelResource, labelOutcome),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests, m.requestDuration,
+		m.vaultDuration, m.vaultErrors,
+		m.elasticDuration, m.elasticErrors,
+		m.providerDuration, m.providerErrors,
+		m.tokensIssued, m.tokenRejects,
+		m.orphanCleanups,
+	)
+	m.handler = promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+
+	return m
+}
+
+func newCounterVec(name, help string, labels ...string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labels)
+}
+
+func newHistogramVec(name, help string, labels ...string) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: help, Buckets: latencyBuckets}, labels)
+}
+
+// Gauge registers a value that is read every time the metrics are scraped
+func (m *Metrics) Gauge(name, help string, value func() float64) {
+	if m == nil {
+		return
+	}
+
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help}, value))
+}
+
+// TokenIssued counts a one time token handed to a pod
+func (m *Metrics) TokenIssued() {
+	if m == nil {
+		return
+	}
+
+	m.tokensIssued.Inc()
+}
+
+// TokenRejected counts a token request refused by a rate limit or the maximum of outstanding tokens
+func (m *Metrics) TokenRejected(reason string) {
+	if m == nil {
+		return
+	}
+
+	m.tokenRejects.WithLabelValues(reason).Inc()
+}
+
+// OrphanCleanup counts a cleanup attempt of a single resource
+func (m *Metrics) OrphanCleanup(resource string, err error) {
+	if m == nil {
+		return
+	}
+
+	m.orphanCleanups.WithLabelValues(resource, outcomeOf(err)).Inc()
+}
+
+// timeVault runs a call to vault and records its latency and failure
+func (m *Metrics) timeVault(operation string, call func() error) error {
+	if m == nil {
+		return call()
+	}
+
+	return timeCall(m.vaultDuration, m.vaultErrors, call, operation)
+}
+
+// timeElastic runs a call to elasticsearch and records its latency and failure
+func (m *Metrics) timeElastic(operation string, call func() error) error {
+	if m == nil {
+		return call()
+	}
+
+	return timeCall(m.elasticDuration, m.elasticErrors, call, operation)
+}
+
+// timeProvider runs a call to a credential provider, elasticsearch keeps its own metrics
+func (m *Metrics) timeProvider(provider, operation string, call func() error) error {
+	if provider == ProviderElasticsearch {
+		return m.timeElastic(operation, call)
+	}
+
+	if m == nil {
+		return call()
+	}
+
+	return timeCall(m.providerDuration, m.providerErrors, call, provider, operation)
+}
+
+func timeCall(duration *prometheus.HistogramVec, errors *prometheus.CounterVec, call func() error, labelValues ...string) error {
+	start := time.Now()
+	err := call()
+	duration.WithLabelValues(labelValues...).Observe(time.Since(start).Seconds())
+	if err != nil {
+		errors.WithLabelValues(labelValues...).Inc()
+	}
+
+	return err
+}
+
+// Instrument records the count and latency of every request to a route by the outcome of its status code
+func (m *Metrics) Instrument(route string) middleware.Adapter {
+	return func(f http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if m == nil {
+				f(w, r)
+				return
+			}
+
+			start := time.Now()
+			recorder := &middleware.StatusRecorder{ResponseWriter: w, Status: http.StatusOK}
+			f(recorder, r)
+
+			outcome := outcomeOfStatus(recorder.Status)
+			m.requests.WithLabelValues(route, outcome).Inc()
+			m.requestDuration.WithLabelValues(route, outcome).Observe(time.Since(start).Seconds())
+		}
+	}
+}
+
+func outcomeOf(err error) string {
+	if err != nil {
+		return OutcomeServerError
+	}
+
+	return OutcomeSuccess
+}
+
+func outcomeOfStatus(status int) string {
+	switch {
+	case status >= http.StatusInternalServerError:
+		return OutcomeServerError
+	case status >= http.StatusBadRequest:
+		return OutcomeClientError
+	default:
+		return OutcomeSuccess
+	}
+}
+
+// ServeMetrics serves the collected metrics for prometheus to scrape
+func (s *SolonHandler) ServeMetrics(w http.ResponseWriter, req *http.Request) {
+	if s.Metrics == nil {
+		http.Error(w, "metrics are not enabled", http.StatusNotFound)
+		return
+	}
+
+	s.Metrics.handler.ServeHTTP(w, req)
+}
@@ -0,0 +1,96 @@
+package lawgiver
+
+import (
+	"bytes"
+	"errors"
+	delphi "github.com/odysseia-greek/delphi/solon/models"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	ns := "test"
+
+	t.Run("RequestsAreCountedPerOutcome", func(t *testing.T) {
+		pods := newTestPodCache()
+		metrics := NewMetrics()
+		metrics.Gauge(metricPodCacheSize, "Pods held in the informer cache.", func() float64 {
+			return float64(pods.Size())
+		})
+
+		testConfig := &SolonHandler{
+			Pods:             pods,
+			AuthMode:         AuthModeIP,
+			Namespace:        ns,
+			AccessAnnotation: "odysseia-greek/access",
+			RoleAnnotation:   "odysseia-greek/role",
+			Metrics:          metrics,
+		}
+
+		err := addPodForTest("someotherpod-123", ns, "dictionary", "api", pods)
+		assert.Nil(t, err)
+
+		creationRequest := delphi.SolonCreationRequest{
+			Role:     "api",
+			Access:   []string{"dictionary"},
+			PodName:  "sokrates-5d8f7c9b4-abcde",
+			Username: "sokratesabcde",
+		}
+		jsonBody, err := creationRequest.Marshal()
+		assert.Nil(t, err)
+
+		router := InitRoutes(testConfig)
+		response := performPostRequest(router, "/solon/v1/register", bytes.NewReader(jsonBody))
+		assert.Equal(t, http.StatusForbidden, response.Code)
+
+		response = performGetRequest(router, "/solon/v1/metrics")
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Contains(t, response.Header().Get("Content-Type"), "text/plain")
+
+		body := response.Body.String()
+		assert.Contains(t, body, `solon_http_requests_total{outcome="client_error",route="register"} 1`)
+		assert.Contains(t, body, `solon_http_request_duration_seconds_count{outcome="client_error",route="register"} 1`)
+		assert.Contains(t, body, `solon_http_request_duration_seconds_bucket{outcome="client_error",route="register",le="+Inf"} 1`)
+		assert.Contains(t, body, "solon_pod_cache_size 1")
+	})
+
+	t.Run("ExternalCalls", func(t *testing.T) {
+		metrics := NewMetrics()
+
+		err := metrics.timeVault("create_secret", func() error { return nil })
+		assert.Nil(t, err)
+		err = metrics.timeElastic("create_user", func() error { return errors.New("connection refused") })
+		assert.NotNil(t, err)
+		metrics.TokenIssued()
+		metrics.OrphanCleanup(OrphanResourceVaultPolicy, nil)
+
+		router := InitRoutes(&SolonHandler{Metrics: metrics})
+		response := performGetRequest(router, "/solon/v1/metrics")
+		assert.Equal(t, http.StatusOK, response.Code)
+
+		body := response.Body.String()
+		assert.Contains(t, body, "# TYPE solon_vault_request_duration_seconds histogram")
+		assert.Contains(t, body, `solon_vault_request_duration_seconds_count{operation="create_secret"} 1`)
+		assert.NotContains(t, body, `solon_vault_errors_total{operation="create_secret"}`)
+		assert.Contains(t, body, `solon_elastic_errors_total{operation="create_user"} 1`)
+		assert.Contains(t, body, "solon_tokens_issued_total 1")
+		assert.Contains(t, body, `solon_orphan_cleanups_total{outcome="success",resource="vault_policy"} 1`)
+	})
+
+	t.Run("NilMetrics", func(t *testing.T) {
+		var metrics *Metrics
+		metrics.TokenIssued()
+		metrics.OrphanCleanup(OrphanResourceVaultSecret, nil)
+		err := metrics.timeProvider(ProviderPostgres, "create_user", func() error { return nil })
+		assert.Nil(t, err)
+	})
+
+	t.Run("DisabledMetrics", func(t *testing.T) {
+		testConfig := &SolonHandler{}
+
+		router := InitRoutes(testConfig)
+		response := performGetRequest(router, "/solon/v1/metrics")
+		assert.Equal(t, http.StatusNotFound, response.Code)
+	})
+}
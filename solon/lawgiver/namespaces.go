@@ -0,0 +1,236 @@
+package lawgiver
+
+import (
+	"fmt"
+	"github.com/odysseia-greek/agora/plato/logging"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"slices"
+	"strings"
+)
+
+const (
+	// EnvNamespaces is a comma separated list of namespaces solon serves, it defaults to the namespace solon runs in
+	EnvNamespaces string = "SOLON_NAMESPACES"
+	// EnvNamespaceSelector serves every namespace matching the label selector and takes precedence over EnvNamespaces
+	EnvNamespaceSelector string = "SOLON_NAMESPACE_SELECTOR"
+)
+
+// NamespaceScope decides which namespaces solon serves, either a fixed list or every namespace matching a label selector
+type NamespaceScope struct {
+	names    []string
+	selector labels.Selector
+	lister   corelisters.NamespaceLister
+}
+
+// NewNamespaceList serves exactly the given namespaces
+func NewNamespaceList(names ...string) *NamespaceScope {
+	return &NamespaceScope{names: names}
+}
+
+// NewNamespaceSelector serves every namespace whose labels match the selector at the moment of the request
+func NewNamespaceSelector(selector labels.Selector, lister corelisters.NamespaceLister) *NamespaceScope {
+	return &NamespaceScope{selector: selector, lister: lister}
+}
+
+// namespaceScopeFromEnv builds the scope from the configured list or selector, a selector watches namespaces
+// through the informer factory so labels added later are picked up without a restart
+func namespaceScopeFromEnv(names []string, selector string, factory informers.SharedInformerFactory) (*NamespaceScope, error) {
+	if selector == "" {
+		if len(names) == 0 {
+			return nil, fmt.Errorf("%s does not contain a namespace", EnvNamespaces)
+		}
+		return NewNamespaceList(names...), nil
+	}
+
+	parsed, err := labels.Parse(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", EnvNamespaceSelector, err)
+	}
+
+	return NewNamespaceSelector(parsed, factory.Core().V1().Namespaces().Lister()), nil
+}
+
+// splitCommaList parses a comma separated list such as the served namespaces, dropping blanks and repeats
+func splitCommaList(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// Serves is true when pods in the namespace may register and request tokens
+func (n *NamespaceScope) Serves(ns string) bool {
+	if n.selector == nil {
+		return slices.Contains(n.names, ns)
+	}
+
+	namespace, err := n.lister.Get(ns)
+	if err != nil {
+		return false
+	}
+
+	return n.selector.Matches(labels.Set(namespace.Labels))
+}
+
+// List returns the namespaces served right now
+func (n *NamespaceScope) List() []string {
+	if n.selector == nil {
+		return n.names
+	}
+
+	namespaces, err := n.lister.List(n.selector)
+	if err != nil {
+		logging.Error(fmt.Sprintf("failed to list namespaces matching %s: %s", n.selector, err.Error()))
+		return nil
+	}
+
+	var names []string
+	for _, namespace := range namespaces {
+		names = append(names, namespace.Name)
+	}
+	slices.Sort(names)
+
+	return names
+}
+
+func (n *NamespaceScope) String() string {
+	if n.selector == nil {
+		return strings.Join(n.names, ",")
+	}
+
+	return fmt.Sprintf("namespaces matching %s", n.selector)
+}
+
+// serves falls back to the namespace solon runs in when no scope is configured
+func (s *SolonHandler) serves(ns string) bool {
+	if s.Namespaces == nil {
+		return ns == s.Namespace
+	}
+
+	return s.Namespaces.Serves(ns)
+}
+
+func (s *SolonHandler) servedNamespaces() []string {
+	if s.Namespaces == nil {
+		return []string{s.Namespace}
+	}
+
+	return s.Namespaces.List()
+}
+
+// podRef identifies the pod a set of vault and elastic resources belongs to. Secrets are stored per namespace as
+// configs/data/<namespace>/<pod>, legacy refs point to secrets written at the root before solon served more than one namespace
+type podRef struct {
+	Namespace string
+	Name      string
+	legacy    bool
+}
+
+func refOf(namespace, name string) podRef {
+	return podRef{Namespace: namespace, Name: name}
+}
+
+// secretName is the path of the secret below the configs mount
+func (p podRef) secretName() string {
+	if p.legacy {
+		return p.Name
+	}
+
+	return fmt.Sprintf("%s/%s", p.Namespace, p.Name)
+}
+
+// policyName is the vault policy that grants a pod access to its own secret. The parts are separated by a dot
+// which a namespace cannot contain, so policy.prod.eu-api and policy.prod-eu.api cannot be mistaken for each other
+func (p podRef) policyName() string {
+	if p.legacy {
+		return fmt.Sprintf("%s%s", policyPrefix, p.Name)
+	}
+
+	return fmt.Sprintf("%s%s.%s", scopedPolicyPrefix, p.Namespace, p.Name)
+}
+
+func (p podRef) String() string {
+	return fmt.Sprintf("%s/%s", p.Namespace, p.Name)
+}
+
+// listRegistrations returns every pod with a secret in a served namespace, secrets at the root of the mount
+// are legacy secrets of the namespace solon runs in
+func (s *SolonHandler) listRegistrations() ([]podRef, error) {
+	var secrets []string
+	err := s.Metrics.timeVault("list_secrets", func() error {
+		var err error
+		secrets, err = s.Vault.ListSecrets()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []podRef
+	for _, name := range secrets {
+		ns, isFolder := strings.CutSuffix(name, "/")
+		if !isFolder {
+			refs = append(refs, podRef{Namespace: s.Namespace, Name: name, legacy: true})
+			continue
+		}
+
+		if !s.serves(ns) {
+			continue
+		}
+
+		lister, ok := s.Vault.(namespacedSecretLister)
+		if !ok {
+			return nil, fmt.Errorf("secret backend %T cannot list the secrets in %s", s.Vault, ns)
+		}
+
+		var names []string
+		err := s.Metrics.timeVault("list_secrets", func() error {
+			var err error
+			names, err = lister.ListSecretsIn(ns)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list secrets in %s: %w", ns, err)
+		}
+
+		for _, podName := range names {
+			if !strings.HasSuffix(podName, "/") {
+				refs = append(refs, refOf(ns, podName))
+			}
+		}
+	}
+
+	return refs, nil
+}
+
+// refOfPolicy finds the pod a policy was written for, when a single namespace is served every policy with the
+// legacy prefix is a legacy policy written before policies were scoped per namespace
+func (s *SolonHandler) refOfPolicy(policy string) (podRef, bool) {
+	if scoped, ok := strings.CutPrefix(policy, scopedPolicyPrefix); ok {
+		ns, podName, found := strings.Cut(scoped, ".")
+		if !found || ns == "" || podName == "" || !s.serves(ns) {
+			return podRef{}, false
+		}
+
+		return refOf(ns, podName), true
+	}
+
+	name, ok := strings.CutPrefix(policy, policyPrefix)
+	if !ok || name == "" {
+		return podRef{}, false
+	}
+
+	// with more than one namespace served the policy may belong to another solon sharing vault and is left alone
+	if len(s.servedNamespaces()) != 1 {
+		return podRef{}, false
+	}
+
+	return podRef{Namespace: s.Namespace, Name: name, legacy: true}, true
+}
@@ -0,0 +1,119 @@
+package lawgiver
+
+import (
+	"encoding/json"
+	delphi "github.com/odysseia-greek/delphi/solon/models"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"net/http"
+	"testing"
+)
+
+func TestNamespaceScope(t *testing.T) {
+	t.Run("List", func(t *testing.T) {
+		scope := NewNamespaceList(splitCommaList(" staging, production,staging ,")...)
+		assert.Equal(t, []string{"staging", "production"}, scope.List())
+		assert.True(t, scope.Serves("production"))
+		assert.False(t, scope.Serves("kube-system"))
+	})
+
+	t.Run("Selector", func(t *testing.T) {
+		indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+		for name, labelSet := range map[string]map[string]string{
+			"staging":     {"odysseia-greek/solon": "enabled"},
+			"production":  {"odysseia-greek/solon": "enabled"},
+			"kube-system": {},
+		} {
+			err := indexer.Add(&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labelSet}})
+			assert.Nil(t, err)
+		}
+
+		selector, err := labels.Parse("odysseia-greek/solon=enabled")
+		assert.Nil(t, err)
+
+		scope := NewNamespaceSelector(selector, corelisters.NewNamespaceLister(indexer))
+		assert.Equal(t, []string{"production", "staging"}, scope.List())
+		assert.True(t, scope.Serves("staging"))
+		assert.False(t, scope.Serves("kube-system"))
+		assert.False(t, scope.Serves("unknown"))
+	})
+
+	t.Run("ScopedNames", func(t *testing.T) {
+		ref := refOf("staging", "sokrates-5d8f7c9b4-abcde")
+		assert.Equal(t, "staging/sokrates-5d8f7c9b4-abcde", ref.secretName())
+		assert.Equal(t, "policy.staging.sokrates-5d8f7c9b4-abcde", ref.policyName())
+	})
+
+	t.Run("PolicyNamesDoNotCollide", func(t *testing.T) {
+		handler := &SolonHandler{Namespace: "prod", Namespaces: NewNamespaceList("prod", "prod-eu")}
+
+		inProd := refOf("prod", "eu-api")
+		inProdEu := refOf("prod-eu", "api")
+		assert.NotEqual(t, inProd.policyName(), inProdEu.policyName())
+
+		for _, ref := range []podRef{inProd, inProdEu} {
+			sut, ok := handler.refOfPolicy(ref.policyName())
+			assert.True(t, ok)
+			assert.Equal(t, ref, sut)
+		}
+
+		_, ok := handler.refOfPolicy("policy.staging.sokrates-5d8f7c9b4-abcde")
+		assert.False(t, ok, "a namespace that is not served belongs to another solon")
+
+		_, ok = handler.refOfPolicy("policy-prod-eu-api")
+		assert.False(t, ok, "a legacy policy cannot be placed when more than one namespace is served")
+	})
+}
+
+func TestNamespaceIsServed(t *testing.T) {
+	t.Run("PodInOtherNamespaceIsRejected", func(t *testing.T) {
+		pods := newTestPodCache()
+		err := addPodForTest("sokrates-5d8f7c9b4-abcde", "kube-system", "dictionary", "api", pods)
+		assert.Nil(t, err)
+
+		testConfig := &SolonHandler{
+			Vault:            &fakeVault{},
+			Pods:             pods,
+			AuthMode:         AuthModeIP,
+			Namespace:        "test",
+			Namespaces:       NewNamespaceList("test", "staging"),
+			AccessAnnotation: "odysseia-greek/access",
+			RoleAnnotation:   "odysseia-greek/role",
+		}
+
+		router := InitRoutes(testConfig)
+		response := performGetRequest(router, "/solon/v1/token")
+		assert.Equal(t, http.StatusUnauthorized, response.Code)
+	})
+
+	t.Run("TokenForSecondNamespace", func(t *testing.T) {
+		pods := newTestPodCache()
+		err := addPodForTest("sokrates-5d8f7c9b4-abcde", "staging", "dictionary", "api", pods)
+		assert.Nil(t, err)
+
+		vault := &fakeVault{}
+		testConfig := &SolonHandler{
+			Vault:            vault,
+			Pods:             pods,
+			AuthMode:         AuthModeIP,
+			Namespace:        "test",
+			Namespaces:       NewNamespaceList("test", "staging"),
+			AccessAnnotation: "odysseia-greek/access",
+			RoleAnnotation:   "odysseia-greek/role",
+		}
+
+		router := InitRoutes(testConfig)
+		response := performGetRequest(router, "/solon/v1/token")
+		assert.Equal(t, http.StatusOK, response.Code)
+
+		var sut delphi.TokenResponse
+		err = json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+		assert.Equal(t, "s.onetime", sut.Token)
+		assert.Contains(t, vault.written["policy.staging.sokrates-5d8f7c9b4-abcde"], `path "configs/data/staging/sokrates-5d8f7c9b4-abcde"`)
+	})
+}
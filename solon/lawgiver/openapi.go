@@ -0,0 +1,97 @@
+package lawgiver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	plato "github.com/odysseia-greek/agora/plato/config"
+	"github.com/odysseia-greek/agora/plato/logging"
+	"github.com/odysseia-greek/agora/plato/middleware"
+	"github.com/odysseia-greek/delphi/solon/docs"
+	delphi "github.com/odysseia-greek/delphi/solon/models"
+	"io"
+	"net/http"
+)
+
+// maxBodySize is far more than any request solon accepts, a larger body is refused before it is decoded
+const maxBodySize int64 = 1 << 20
+
+// openAPISpec is generated once when the routes are set up, the document is marshalled up front so serving it is a write
+type openAPISpec struct {
+	doc  *docs.Document
+	body []byte
+}
+
+func newOpenAPISpec(operations []docs.Operation) *openAPISpec {
+	doc := docs.Generate(operations)
+	doc.AddSchema(delphi.SolonError{})
+
+	body, err := doc.Marshal()
+	if err != nil {
+		logging.Error(fmt.Sprintf("failed to marshal the openapi spec: %s", err.Error()))
+	}
+
+	return &openAPISpec{doc: doc, body: body}
+}
+
+// ServeOpenAPI returns the OpenAPI 3 document of every route solon serves
+func (s *SolonHandler) ServeOpenAPI(w http.ResponseWriter, req *http.Request) {
+	if s.spec == nil || s.spec.body == nil {
+		s.respondWithError(w, req.Header.Get(plato.HeaderKey), fmt.Errorf("the openapi spec is not available"))
+		return
+	}
+
+	w.Header().Set("Content-Type", docs.ContentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+	w.Write(s.spec.body)
+}
+
+// validateBody checks the request body against the schema of the operation before the handler decodes it,
+// the body is put back so the handler reads it as it was sent
+func (s *SolonHandler) validateBody(operation docs.Operation) middleware.Adapter {
+	return func(f http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, req *http.Request) {
+			if s.spec == nil {
+				f(w, req)
+				return
+			}
+
+			schema, required := s.spec.doc.RequestSchema(operation.Path, operation.Method)
+			if schema == nil {
+				f(w, req)
+				return
+			}
+
+			requestId := req.Header.Get(plato.HeaderKey)
+			w.Header().Set(plato.HeaderKey, requestId)
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxBodySize))
+			if err != nil {
+				s.respondWithError(w, requestId, newSolonError(delphi.ErrorCodeInvalidRequest, "body", err))
+				return
+			}
+
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			if len(bytes.TrimSpace(body)) == 0 && !required {
+				f(w, req)
+				return
+			}
+
+			decoder := json.NewDecoder(bytes.NewReader(body))
+			decoder.UseNumber()
+
+			var value interface{}
+			if err := decoder.Decode(&value); err != nil {
+				s.respondWithError(w, requestId, newSolonError(delphi.ErrorCodeInvalidRequest, "decoding", err))
+				return
+			}
+
+			if err := s.spec.doc.Validate(schema, value); err != nil {
+				s.respondWithError(w, requestId, newSolonError(delphi.ErrorCodeInvalidRequest, "body", err))
+				return
+			}
+
+			f(w, req)
+		}
+	}
+}
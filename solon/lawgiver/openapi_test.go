@@ -0,0 +1,102 @@
+package lawgiver
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/odysseia-greek/delphi/solon/docs"
+	delphi "github.com/odysseia-greek/delphi/solon/models"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPI(t *testing.T) {
+	ns := "test"
+
+	t.Run("SpecListsEveryRoute", func(t *testing.T) {
+		handler := &SolonHandler{Namespace: ns}
+		router := InitRoutes(handler)
+
+		response := performGetRequest(router, "/solon/v1/openapi.json")
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Equal(t, "application/json", response.Header().Get("Content-Type"))
+
+		var sut docs.Document
+		err := json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+
+		assert.Equal(t, "3.0.3", sut.OpenAPI)
+		assert.Equal(t, "/solon/v1", sut.Servers[0].URL)
+		for _, r := range handler.routes() {
+			path := strings.TrimPrefix(r.Path, docs.BasePath)
+			assert.Contains(t, sut.Paths[path], strings.ToLower(r.Method), path)
+		}
+
+		register := sut.Paths["/register"]["post"]
+		assert.Equal(t, "registerService", register.OperationID)
+		assert.True(t, register.RequestBody.Required)
+		assert.Equal(t, "#/components/schemas/SolonCreationRequest", register.RequestBody.Content["application/json"].Schema.Ref)
+		assert.Equal(t, "#/components/schemas/SolonError", register.Responses["default"].Content["application/json"].Schema.Ref)
+
+		creation := sut.Components.Schemas["SolonCreationRequest"]
+		assert.Equal(t, []string{"access", "podName"}, creation.Required)
+		assert.Equal(t, "array", creation.Properties["access"].Type)
+		assert.Equal(t, "string", creation.Properties["access"].Items.Type)
+
+		token := sut.Components.Schemas["TokenResponse"]
+		assert.Equal(t, []string{"token"}, token.Required)
+
+		detail := sut.Components.Schemas["RegistrationDetail"]
+		assert.Contains(t, detail.Properties, "podName", "embedded summary is flattened")
+		assert.Equal(t, "date-time", detail.Properties["createdAt"].Format)
+
+		registration := sut.Paths["/registrations/{namespace}/{podName}"]["get"]
+		assert.Len(t, registration.Parameters, 2)
+		assert.Equal(t, "namespace", registration.Parameters[0].Name)
+	})
+
+	t.Run("InvalidBodyIsRefused", func(t *testing.T) {
+		bodies := map[string]string{
+			"MissingPodName": `{"access":["dictionary"]}`,
+			"AccessNotAList": `{"access":"dictionary","podName":"sokrates-1"}`,
+			"UnknownField":   `{"access":["dictionary"],"podName":"sokrates-1","namespace":"other"}`,
+			"NotAnObject":    `["dictionary"]`,
+		}
+
+		for name, body := range bodies {
+			t.Run(name, func(t *testing.T) {
+				router := InitRoutes(&SolonHandler{Namespace: ns, Pods: newTestPodCache(), AuthMode: AuthModeIP})
+				response := performPostRequest(router, "/solon/v1/register", bytes.NewReader([]byte(body)))
+
+				var sut delphi.SolonError
+				err := json.NewDecoder(response.Body).Decode(&sut)
+				assert.Nil(t, err)
+				assert.Equal(t, http.StatusBadRequest, response.Code)
+				assert.Equal(t, delphi.ErrorCodeInvalidRequest, sut.Code)
+				assert.Equal(t, "body", sut.Field)
+			})
+		}
+	})
+
+	t.Run("ValidBodyReachesTheHandler", func(t *testing.T) {
+		router := InitRoutes(&SolonHandler{Namespace: ns, Pods: newTestPodCache(), AuthMode: AuthModeIP})
+		response := performPostRequest(router, "/solon/v1/register", bytes.NewReader([]byte(`{"access":["dictionary"],"podName":"sokrates-1"}`)))
+
+		var sut delphi.SolonError
+		err := json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusNotFound, response.Code)
+		assert.Equal(t, delphi.ErrorCodePodNotFound, sut.Code)
+	})
+
+	t.Run("EmptyBodyWhenOptional", func(t *testing.T) {
+		router := InitRoutes(&SolonHandler{Namespace: ns, Pods: newTestPodCache(), AuthMode: AuthModeIP})
+		response := performPostRequest(router, "/solon/v1/rotate", bytes.NewReader(nil))
+
+		var sut delphi.SolonError
+		err := json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+		assert.NotEqual(t, delphi.ErrorCodeInvalidRequest, sut.Code)
+	})
+}
@@ -0,0 +1,153 @@
+package lawgiver
+
+import (
+	"fmt"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const podIPIndex string = "podIP"
+
+// PodCache serves pod lookups from the shared informer so verifying a request never has to list pods from the api server
+type PodCache struct {
+	indexer   cache.Indexer
+	hasSynced cache.InformerSynced
+}
+
+// newPodCache adds the ip index to the pod informer and wraps its indexer
+func newPodCache(informer cache.SharedIndexInformer) (*PodCache, error) {
+	err := informer.AddIndexers(cache.Indexers{podIPIndex: indexPodByIP})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add pod ip index: %w", err)
+	}
+
+	return &PodCache{
+		indexer:   informer.GetIndexer(),
+		hasSynced: informer.HasSynced,
+	}, nil
+}
+
+func (p *PodCache) HasSynced() bool {
+	return p.hasSynced()
+}
+
+// Size returns the number of pods currently held in the cache
+func (p *PodCache) Size() int {
+	return len(p.indexer.ListKeys())
+}
+
+// ByIP returns the single serving pod that owns the ip
+func (p *PodCache) ByIP(ip string) (*v1.Pod, error) {
+	if !p.HasSynced() {
+		return nil, errPodCacheNotSynced
+	}
+
+	objects, err := p.indexer.ByIndex(podIPIndex, ip)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []*v1.Pod
+	var rejected error
+	for _, obj := range objects {
+		pod, ok := obj.(*v1.Pod)
+		if !ok {
+			continue
+		}
+
+		if err := isServing(pod); err != nil {
+			rejected = err
+			continue
+		}
+
+		candidates = append(candidates, pod)
+	}
+
+	switch len(candidates) {
+	case 0:
+		if rejected != nil {
+			return nil, rejected
+		}
+		return nil, nil
+	case 1:
+		return candidates[0], nil
+	default:
+		return nil, fmt.Errorf("ip %s is shared by %d serving pods and cannot identify a single caller", ip, len(candidates))
+	}
+}
+
+// ByName returns the serving pod with the given name
+func (p *PodCache) ByName(ns, name string) (*v1.Pod, error) {
+	if !p.HasSynced() {
+		return nil, errPodCacheNotSynced
+	}
+
+	obj, exists, err := p.indexer.GetByKey(fmt.Sprintf("%s/%s", ns, name))
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		return nil, fmt.Errorf("cached object %s/%s is not a pod", ns, name)
+	}
+
+	if err := isServing(pod); err != nil {
+		return nil, err
+	}
+
+	return pod, nil
+}
+
+// Has reports if a pod with the given name is in the cache, whatever its phase
+func (p *PodCache) Has(ns, name string) (bool, error) {
+	if !p.HasSynced() {
+		return false, errPodCacheNotSynced
+	}
+
+	_, exists, err := p.indexer.GetByKey(fmt.Sprintf("%s/%s", ns, name))
+	return exists, err
+}
+
+// isServing refuses pods that are being torn down or have finished, a pending pod with an ip is still starting up and
+// registers from its init container
+func isServing(pod *v1.Pod) error {
+	if pod.DeletionTimestamp != nil {
+		return fmt.Errorf("%w: pod %s is terminating", errPodNotServing, pod.Name)
+	}
+
+	switch pod.Status.Phase {
+	case v1.PodSucceeded, v1.PodFailed:
+		return fmt.Errorf("%w: pod %s is in phase %s and has finished", errPodNotServing, pod.Name, pod.Status.Phase)
+	case v1.PodPending:
+		if pod.Status.PodIP == "" && len(pod.Status.PodIPs) == 0 {
+			return fmt.Errorf("%w: pod %s is pending without an ip", errPodNotServing, pod.Name)
+		}
+	}
+
+	return nil
+}
+
+func indexPodByIP(obj interface{}) ([]string, error) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		return nil, nil
+	}
+
+	var ips []string
+	for _, podIP := range pod.Status.PodIPs {
+		if podIP.IP != "" {
+			ips = append(ips, podIP.IP)
+		}
+	}
+
+	if len(ips) == 0 && pod.Status.PodIP != "" {
+		ips = append(ips, pod.Status.PodIP)
+	}
+
+	return ips, nil
+}
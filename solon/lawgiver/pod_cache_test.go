@@ -0,0 +1,153 @@
+package lawgiver
+
+import (
+	kubernetes "github.com/odysseia-greek/agora/thales"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+	"time"
+)
+
+func TestPodCache(t *testing.T) {
+	ns := "test"
+
+	t.Run("ByIPReturnsRunningPod", func(t *testing.T) {
+		pods := newTestPodCache()
+		err := addPodForTest("sokrates-5d8f7c9b4-abcde", ns, "dictionary", "api", pods)
+		assert.Nil(t, err)
+
+		pod, err := pods.ByIP(testPodIP)
+		assert.Nil(t, err)
+		assert.NotNil(t, pod)
+		assert.Equal(t, "sokrates-5d8f7c9b4-abcde", pod.Name)
+		assert.Equal(t, 1, pods.Size())
+	})
+
+	t.Run("ByIPUnknownIP", func(t *testing.T) {
+		pods := newTestPodCache()
+		err := addPodForTest("sokrates-5d8f7c9b4-abcde", ns, "dictionary", "api", pods)
+		assert.Nil(t, err)
+
+		pod, err := pods.ByIP("10.42.0.99")
+		assert.Nil(t, err)
+		assert.Nil(t, pod)
+	})
+
+	t.Run("ByIPSkipsCompletedPodWithReusedIP", func(t *testing.T) {
+		pods := newTestPodCache()
+		completed := kubernetes.TestPodObject("demokritos-job-xyz", ns, "dictionary", "seeder")
+		completed.Status.PodIP = testPodIP
+		err := pods.indexer.Add(completed)
+		assert.Nil(t, err)
+		err = addPodForTest("sokrates-5d8f7c9b4-abcde", ns, "dictionary", "api", pods)
+		assert.Nil(t, err)
+
+		pod, err := pods.ByIP(testPodIP)
+		assert.Nil(t, err)
+		assert.Equal(t, "sokrates-5d8f7c9b4-abcde", pod.Name)
+	})
+
+	t.Run("ByIPRejectsTerminatingPod", func(t *testing.T) {
+		pods := newTestPodCache()
+		pod := runningPodForTest("sokrates-5d8f7c9b4-abcde", ns, "dictionary", "api")
+		pod.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+		err := pods.indexer.Add(pod)
+		assert.Nil(t, err)
+
+		sut, err := pods.ByIP(testPodIP)
+		assert.NotNil(t, err)
+		assert.Nil(t, sut)
+		assert.Contains(t, err.Error(), "terminating")
+	})
+
+	t.Run("ByIPRejectsSharedIP", func(t *testing.T) {
+		pods := newTestPodCache()
+		err := addPodForTest("sokrates-5d8f7c9b4-abcde", ns, "dictionary", "api", pods)
+		assert.Nil(t, err)
+		err = addPodForTest("herodotos-7c9b4d8f5-fghij", ns, "text", "api", pods)
+		assert.Nil(t, err)
+
+		sut, err := pods.ByIP(testPodIP)
+		assert.NotNil(t, err)
+		assert.Nil(t, sut)
+	})
+
+	t.Run("ByNameAcceptsPendingPodWithIP", func(t *testing.T) {
+		pods := newTestPodCache()
+		pod := runningPodForTest("sokrates-5d8f7c9b4-abcde", ns, "dictionary", "api")
+		pod.Status.Phase = v1.PodPending
+		err := pods.indexer.Add(pod)
+		assert.Nil(t, err)
+
+		sut, err := pods.ByName(ns, pod.Name)
+		assert.Nil(t, err)
+		assert.Equal(t, pod.Name, sut.Name)
+
+		sut, err = pods.ByIP(testPodIP)
+		assert.Nil(t, err)
+		assert.Equal(t, pod.Name, sut.Name)
+	})
+
+	t.Run("ByNameRejectsPendingPodWithoutIP", func(t *testing.T) {
+		pods := newTestPodCache()
+		pod := runningPodForTest("sokrates-5d8f7c9b4-abcde", ns, "dictionary", "api")
+		pod.Status.Phase = v1.PodPending
+		pod.Status.PodIP = ""
+		err := pods.indexer.Add(pod)
+		assert.Nil(t, err)
+
+		sut, err := pods.ByName(ns, pod.Name)
+		assert.ErrorIs(t, err, errPodNotServing)
+		assert.Nil(t, sut)
+	})
+
+	t.Run("ByNameRejectsFailedPod", func(t *testing.T) {
+		pods := newTestPodCache()
+		pod := runningPodForTest("sokrates-5d8f7c9b4-abcde", ns, "dictionary", "api")
+		pod.Status.Phase = v1.PodFailed
+		err := pods.indexer.Add(pod)
+		assert.Nil(t, err)
+
+		sut, err := pods.ByName(ns, pod.Name)
+		assert.ErrorIs(t, err, errPodNotServing)
+		assert.Nil(t, sut)
+	})
+
+	t.Run("NotSynced", func(t *testing.T) {
+		pods := newTestPodCache()
+		pods.hasSynced = func() bool { return false }
+
+		sut, err := pods.ByIP(testPodIP)
+		assert.NotNil(t, err)
+		assert.Nil(t, sut)
+	})
+
+	t.Run("OriginIPv6", func(t *testing.T) {
+		pods := newTestPodCache()
+		pod := runningPodForTest("sokrates-5d8f7c9b4-abcde", ns, "dictionary", "api")
+		pod.Status.PodIP = "fd00:10:42::17"
+		err := pods.indexer.Add(pod)
+		assert.Nil(t, err)
+
+		handler := &SolonHandler{Pods: pods}
+		for _, remoteAddr := range []string{"[fd00:10:42::17]:43512", "fd00:10:42::17"} {
+			sut, err := handler.verifyRequestOriginIP(remoteAddr)
+			assert.Nil(t, err)
+			assert.NotNil(t, sut, remoteAddr)
+		}
+	})
+
+	t.Run("OriginIPv4", func(t *testing.T) {
+		pods := newTestPodCache()
+		err := addPodForTest("sokrates-5d8f7c9b4-abcde", ns, "dictionary", "api", pods)
+		assert.Nil(t, err)
+
+		handler := &SolonHandler{Pods: pods}
+		for _, remoteAddr := range []string{testPodIP + ":43512", testPodIP} {
+			sut, err := handler.verifyRequestOriginIP(remoteAddr)
+			assert.Nil(t, err)
+			assert.NotNil(t, sut, remoteAddr)
+		}
+	})
+}
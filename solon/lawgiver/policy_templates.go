@@ -0,0 +1,267 @@
+package lawgiver
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/odysseia-greek/agora/plato/logging"
+	delphi "github.com/odysseia-greek/delphi/solon/models"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"net/url"
+	"sigs.k8s.io/yaml"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const (
+	EnvPolicyConfigMap string = "SOLON_POLICY_CONFIGMAP"
+
+	defaultPolicyConfigMap string = "solon-policies"
+	// defaultPolicyRole is the key in the configmap used for every role without a template of its own
+	defaultPolicyRole string = "default"
+)
+
+// defaultPolicy grants a pod read access to its own secret, it is used when no template matches
+const defaultPolicy = `
+path "configs/data/{{ .Namespace }}/{{ .PodName }}" {
+  capabilities = ["read", "list"]
+}
+`
+
+// PolicyTemplate is the vault policy and token settings for pods with a role annotation
+type PolicyTemplate struct {
+	Policy  string `json:"policy"`
+	TTL     string `json:"ttl,omitempty"`
+	NumUses int    `json:"numUses,omitempty"`
+
+	tmpl *template.Template
+}
+
+// policyValues are the pod fields a template can use
+type policyValues struct {
+	PodName     string
+	Namespace   string
+	Annotations map[string]string
+}
+
+func parsePolicyTemplate(name string, tpl *PolicyTemplate) error {
+	tmpl, err := newPolicyTemplate(name, tpl.Policy)
+	if err != nil {
+		return err
+	}
+
+	if tpl.NumUses < 0 {
+		return fmt.Errorf("template %s: numUses cannot be negative", name)
+	}
+
+	if tpl.TTL != "" {
+		if _, err := time.ParseDuration(tpl.TTL); err != nil {
+			return fmt.Errorf("template %s: invalid ttl: %w", name, err)
+		}
+	}
+
+	tpl.tmpl = tmpl
+	return nil
+}
+
+func newPolicyTemplate(name, policy string) (*template.Template, error) {
+	if policy == "" {
+		return nil, fmt.Errorf("template %s: policy is empty", name)
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(policy)
+	if err != nil {
+		return nil, fmt.Errorf("template %s: %w", name, err)
+	}
+
+	return tmpl, nil
+}
+
+// Render fills in the template for a pod
+func (p *PolicyTemplate) Render(pod *v1.Pod) ([]byte, error) {
+	values := policyValues{
+		PodName:     pod.Name,
+		Namespace:   pod.Namespace,
+		Annotations: pod.Annotations,
+	}
+
+	var rendered bytes.Buffer
+	err := p.tmpl.Execute(&rendered, values)
+	if err != nil {
+		return nil, err
+	}
+
+	return rendered.Bytes(), nil
+}
+
+// PolicyTemplates holds the templates per role as loaded from the configmap, a nil PolicyTemplates
+// and a role without a template both fall back to the default policy
+type PolicyTemplates struct {
+	ConfigMap string
+
+	mu        sync.RWMutex
+	templates map[string]*PolicyTemplate
+	fallback  *PolicyTemplate
+}
+
+func NewPolicyTemplates(configMap string) *PolicyTemplates {
+	return &PolicyTemplates{
+		ConfigMap: configMap,
+		templates: map[string]*PolicyTemplate{},
+		fallback:  builtinPolicyTemplate(),
+	}
+}
+
+func builtinPolicyTemplate() *PolicyTemplate {
+	tmpl, _ := newPolicyTemplate(defaultPolicyRole, defaultPolicy)
+	return &PolicyTemplate{Policy: defaultPolicy, tmpl: tmpl}
+}
+
+// ForRole returns the template a pod with the role gets
+func (p *PolicyTemplates) ForRole(role string) *PolicyTemplate {
+	if p == nil {
+		return builtinPolicyTemplate()
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if tpl, ok := p.templates[role]; ok {
+		return tpl
+	}
+
+	if tpl, ok := p.templates[defaultPolicyRole]; ok {
+		return tpl
+	}
+
+	return p.fallback
+}
+
+// Load replaces every template with the ones in the configmap, every key is a role and every value a yaml
+// document with a policy, ttl and numUses. When one template is invalid the templates in use are kept
+func (p *PolicyTemplates) Load(configMap *v1.ConfigMap) error {
+	templates := map[string]*PolicyTemplate{}
+	for role, value := range configMap.Data {
+		var tpl PolicyTemplate
+		err := yaml.Unmarshal([]byte(value), &tpl)
+		if err != nil {
+			return fmt.Errorf("template %s: %w", role, err)
+		}
+
+		err = parsePolicyTemplate(role, &tpl)
+		if err != nil {
+			return err
+		}
+
+		templates[role] = &tpl
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.templates = templates
+
+	return nil
+}
+
+// Reset drops every loaded template so all roles get the default policy
+func (p *PolicyTemplates) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.templates = map[string]*PolicyTemplate{}
+}
+
+func (s *SolonHandler) handlePolicyEvents() cache.ResourceEventHandlerFuncs {
+	load := func(obj interface{}) {
+		configMap, ok := obj.(*v1.ConfigMap)
+		if !ok || !s.isPolicyConfigMap(configMap) {
+			return
+		}
+
+		err := s.Policies.Load(configMap)
+		if err != nil {
+			logging.Error(fmt.Sprintf("failed to load policy templates from %s, keeping the templates in use: %s", configMap.Name, err.Error()))
+			return
+		}
+
+		logging.System(fmt.Sprintf("loaded %d policy templates from %s", len(configMap.Data), configMap.Name))
+	}
+
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: load,
+		UpdateFunc: func(_, newObj interface{}) {
+			load(newObj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+
+			configMap, ok := obj.(*v1.ConfigMap)
+			if !ok || !s.isPolicyConfigMap(configMap) {
+				return
+			}
+
+			s.Policies.Reset()
+			logging.System(fmt.Sprintf("policy templates in %s removed, falling back to the default policy", configMap.Name))
+		},
+	}
+}
+
+// isPolicyConfigMap only accepts the configmap in the namespace solon runs in, the informer can watch every namespace
+func (s *SolonHandler) isPolicyConfigMap(configMap *v1.ConfigMap) bool {
+	return configMap.Name == s.Policies.ConfigMap && configMap.Namespace == s.Namespace
+}
+
+// ttl is the lifetime of tokens from this template, zero when vault decides
+func (t *PolicyTemplate) ttl() time.Duration {
+	ttl, err := time.ParseDuration(t.TTL)
+	if err != nil {
+		return 0
+	}
+
+	return ttl
+}
+
+// createToken hands out a token for the policy with the ttl and use count of the options, a backend that cannot
+// set them is an error rather than a token that lives longer or can be used more often than the template allows.
+// The accessor is empty when the backend cannot look tokens up
+func (s *SolonHandler) createToken(policy string, opts tokenOptions) (string, string, error) {
+	lookup, canLookup := s.Vault.(tokenLookup)
+	if opts.TTL == "" && opts.NumUses == 0 {
+		if canLookup {
+			return lookup.CreateTokenWithAccessor([]string{policy}, "", vaultTokenUses)
+		}
+
+		token, err := s.Vault.CreateOneTimeToken([]string{policy})
+		return token, "", err
+	}
+
+	if canLookup {
+		return lookup.CreateTokenWithAccessor([]string{policy}, opts.TTL, opts.NumUses)
+	}
+
+	creator, ok := s.Vault.(tokenOptionsCreator)
+	if !ok {
+		return "", "", fmt.Errorf("the secret backend cannot create a token for %s with %s", policy, opts)
+	}
+
+	token, err := creator.CreateTokenWithOptions([]string{policy}, opts.TTL, opts.NumUses)
+	return token, "", err
+}
+
+// checkTokenOptions refuses options the backend cannot honour before anything is written, an option the pod asked
+// for is a bad request while one that comes from the policy template is a problem of solon itself
+func (s *SolonHandler) checkTokenOptions(query url.Values, opts tokenOptions) error {
+	if _, ok := s.Vault.(tokenOptionsCreator); ok || (opts.TTL == "" && opts.NumUses == 0) {
+		return nil
+	}
+
+	for _, field := range []string{tokenQueryTTL, tokenQueryNumUses} {
+		if query.Get(field) != "" {
+			return newSolonError(delphi.ErrorCodeInvalidRequest, field, fmt.Errorf("the secret backend cannot create a token with %s", opts))
+		}
+	}
+
+	return newSolonError(delphi.ErrorCodeVaultTokenFailed, "policy template", fmt.Errorf("the secret backend cannot create a token with %s from the policy template", opts))
+}
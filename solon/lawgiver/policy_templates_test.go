@@ -0,0 +1,172 @@
+package lawgiver
+
+import (
+	"encoding/json"
+	delphi "github.com/odysseia-greek/delphi/solon/models"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"testing"
+)
+
+func TestPolicyTemplates(t *testing.T) {
+	ns := "test"
+	pod := runningPodForTest("sokrates-5d8f7c9b4-abcde", ns, "dictionary", "hybrid")
+
+	hybridTemplate := `
+policy: |
+  path "configs/data/{{ .PodName }}" {
+    capabilities = ["read", "list"]
+  }
+  path "configs/data/shared/{{ index .Annotations "odysseia-greek/access" }}" {
+    capabilities = ["read"]
+  }
+ttl: 5m
+numUses: 3
+`
+
+	configMap := func(data map[string]string) *v1.ConfigMap {
+		return &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: defaultPolicyConfigMap, Namespace: ns}, Data: data}
+	}
+
+	t.Run("DefaultPolicy", func(t *testing.T) {
+		templates := NewPolicyTemplates(defaultPolicyConfigMap)
+
+		rendered, err := templates.ForRole("api").Render(pod)
+		assert.Nil(t, err)
+		assert.Contains(t, string(rendered), `path "configs/data/test/sokrates-5d8f7c9b4-abcde"`)
+	})
+
+	t.Run("RoleTemplate", func(t *testing.T) {
+		templates := NewPolicyTemplates(defaultPolicyConfigMap)
+		err := templates.Load(configMap(map[string]string{"hybrid": hybridTemplate}))
+		assert.Nil(t, err)
+
+		tpl := templates.ForRole("hybrid")
+		assert.Equal(t, "5m", tpl.TTL)
+		assert.Equal(t, 3, tpl.NumUses)
+
+		rendered, err := tpl.Render(pod)
+		assert.Nil(t, err)
+		assert.Contains(t, string(rendered), `path "configs/data/shared/dictionary"`)
+
+		assert.Equal(t, "", templates.ForRole("api").TTL)
+	})
+
+	t.Run("DefaultKeyCoversOtherRoles", func(t *testing.T) {
+		templates := NewPolicyTemplates(defaultPolicyConfigMap)
+		err := templates.Load(configMap(map[string]string{defaultPolicyRole: "policy: 'path \"configs/data/{{ .Namespace }}\" {}'"}))
+		assert.Nil(t, err)
+
+		rendered, err := templates.ForRole("seeder").Render(pod)
+		assert.Nil(t, err)
+		assert.Contains(t, string(rendered), `path "configs/data/test"`)
+	})
+
+	t.Run("InvalidTemplateKeepsCurrent", func(t *testing.T) {
+		templates := NewPolicyTemplates(defaultPolicyConfigMap)
+		err := templates.Load(configMap(map[string]string{"hybrid": hybridTemplate}))
+		assert.Nil(t, err)
+
+		err = templates.Load(configMap(map[string]string{"hybrid": "policy: '{{ .PodName '"}))
+		assert.NotNil(t, err)
+		err = templates.Load(configMap(map[string]string{"hybrid": "policy: 'path {}'\nttl: forever"}))
+		assert.NotNil(t, err)
+
+		assert.Equal(t, "5m", templates.ForRole("hybrid").TTL)
+	})
+
+	t.Run("ConfigMapEvents", func(t *testing.T) {
+		handler := &SolonHandler{Namespace: ns, Policies: NewPolicyTemplates(defaultPolicyConfigMap)}
+		events := handler.handlePolicyEvents()
+
+		events.OnAdd(configMap(map[string]string{"hybrid": hybridTemplate}), false)
+		assert.Equal(t, 3, handler.Policies.ForRole("hybrid").NumUses)
+
+		other := configMap(map[string]string{"hybrid": "policy: 'path {}'\nnumUses: 9"})
+		other.Name = "someother-configmap"
+		events.OnUpdate(nil, other)
+		assert.Equal(t, 3, handler.Policies.ForRole("hybrid").NumUses)
+
+		otherNamespace := configMap(map[string]string{"hybrid": "policy: 'path {}'\nnumUses: 9"})
+		otherNamespace.Namespace = "staging"
+		events.OnUpdate(nil, otherNamespace)
+		assert.Equal(t, 3, handler.Policies.ForRole("hybrid").NumUses)
+
+		events.OnDelete(configMap(nil))
+		assert.Equal(t, 0, handler.Policies.ForRole("hybrid").NumUses)
+	})
+
+	t.Run("TokenUsesRoleTemplate", func(t *testing.T) {
+		pods := newTestPodCache()
+		err := pods.indexer.Add(pod)
+		assert.Nil(t, err)
+
+		vault := &fakeVault{}
+		templates := NewPolicyTemplates(defaultPolicyConfigMap)
+		err = templates.Load(configMap(map[string]string{"hybrid": hybridTemplate}))
+		assert.Nil(t, err)
+
+		testConfig := &SolonHandler{
+			Vault:            vault,
+			Pods:             pods,
+			AuthMode:         AuthModeIP,
+			Namespace:        ns,
+			AccessAnnotation: "odysseia-greek/access",
+			RoleAnnotation:   "odysseia-greek/role",
+			Policies:         templates,
+		}
+
+		router := InitRoutes(testConfig)
+		response := performGetRequest(router, "/solon/v1/token")
+		assert.Equal(t, http.StatusOK, response.Code)
+
+		var sut delphi.TokenResponse
+		err = json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+		assert.Equal(t, "s.options", sut.Token)
+		assert.Equal(t, []string{"options:policy.test.sokrates-5d8f7c9b4-abcde:5m:3"}, vault.tokens)
+		assert.Contains(t, vault.written["policy.test.sokrates-5d8f7c9b4-abcde"], "configs/data/shared/dictionary")
+	})
+
+	t.Run("BackendWithoutTokenOptions", func(t *testing.T) {
+		pods := newTestPodCache()
+		err := pods.indexer.Add(pod)
+		assert.Nil(t, err)
+
+		vault := &fakeVault{}
+		templates := NewPolicyTemplates(defaultPolicyConfigMap)
+		err = templates.Load(configMap(map[string]string{"hybrid": hybridTemplate}))
+		assert.Nil(t, err)
+
+		testConfig := &SolonHandler{
+			// only the methods of the interface are left, which do not include token options
+			Vault:            struct{ SecretBackend }{vault},
+			Pods:             pods,
+			AuthMode:         AuthModeIP,
+			Namespace:        ns,
+			AccessAnnotation: "odysseia-greek/access",
+			RoleAnnotation:   "odysseia-greek/role",
+			Policies:         templates,
+		}
+
+		router := InitRoutes(testConfig)
+		response := performGetRequest(router, "/solon/v1/token")
+
+		var sut delphi.SolonError
+		err = json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusInternalServerError, response.Code)
+		assert.Equal(t, delphi.ErrorCodeVaultTokenFailed, sut.Code)
+		assert.Contains(t, sut.Message, "ttl 5m, 3 uses")
+		assert.Empty(t, vault.tokens, "no token is issued without the limits of the template")
+		assert.Empty(t, vault.written)
+
+		response = performGetRequest(router, "/solon/v1/token?ttl=1m")
+		err = json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+		assert.Equal(t, tokenQueryTTL, sut.Field)
+	})
+}
@@ -0,0 +1,318 @@
+package lawgiver
+
+import (
+	"fmt"
+	"github.com/odysseia-greek/agora/plato/logging"
+	delphi "github.com/odysseia-greek/delphi/solon/models"
+	"golang.org/x/time/rate"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	EnvTokenRatePerPod      string = "SOLON_TOKEN_RATE_PER_POD"
+	EnvTokenBurstPerPod     string = "SOLON_TOKEN_BURST_PER_POD"
+	EnvTokenRateGlobal      string = "SOLON_TOKEN_RATE_GLOBAL"
+	EnvTokenBurstGlobal     string = "SOLON_TOKEN_BURST_GLOBAL"
+	EnvMaxOutstandingTokens string = "SOLON_MAX_OUTSTANDING_TOKENS"
+	EnvOutstandingTokenTTL  string = "SOLON_OUTSTANDING_TOKEN_TTL"
+
+	// rates are tokens per minute, a rate of 0 turns that limit off
+	defaultTokenRatePerPod      string = "6"
+	defaultTokenBurstPerPod     string = "3"
+	defaultTokenRateGlobal      string = "300"
+	defaultTokenBurstGlobal     string = "50"
+	defaultMaxOutstandingTokens string = "5"
+	defaultOutstandingTokenTTL  string = "10m"
+
+	RejectReasonPodRate     string = "pod_rate"
+	RejectReasonGlobalRate  string = "global_rate"
+	RejectReasonOutstanding string = "outstanding"
+
+	headerRetryAfter string = "Retry-After"
+
+	// idlePodLimit is how long the limit of a pod is kept after its last request, a new limiter starts with a full burst
+	idlePodLimit = time.Hour
+)
+
+// TokenLimiter protects vault from pods asking for tokens in a loop: every pod has its own rate and burst, all pods
+// together share a global rate and a pod cannot hold more than MaxOutstanding tokens it has not used yet.
+// A nil TokenLimiter allows every request
+type TokenLimiter struct {
+	podRate        rate.Limit
+	podBurst       int
+	global         *rate.Limiter
+	MaxOutstanding int
+	// OutstandingTTL is how long a token counts as outstanding when its template has no ttl
+	OutstandingTTL time.Duration
+
+	mu   sync.Mutex
+	pods map[string]*podLimit
+}
+
+type podLimit struct {
+	limiter     *rate.Limiter
+	outstanding []outstandingToken
+	lastSeen    time.Time
+}
+
+// outstandingToken is known by its accessor, the token itself is never kept
+type outstandingToken struct {
+	accessor  string
+	expiresAt time.Time
+}
+
+// tokenLimitError is returned when a request is refused, RetryAfter is zero when waiting does not help
+type tokenLimitError struct {
+	Reason     string
+	RetryAfter time.Duration
+	err        error
+}
+
+func (e *tokenLimitError) Error() string {
+	return e.err.Error()
+}
+
+// NewTokenLimiter takes rates in tokens per minute, a rate or maximum of 0 turns that limit off
+func NewTokenLimiter(podRate, podBurst, globalRate, globalBurst, maxOutstanding int, outstandingTTL time.Duration) *TokenLimiter {
+	limiter := &TokenLimiter{
+		podRate:        perMinute(podRate),
+		podBurst:       podBurst,
+		MaxOutstanding: maxOutstanding,
+		OutstandingTTL: outstandingTTL,
+		pods:           map[string]*podLimit{},
+	}
+
+	if globalRate > 0 {
+		limiter.global = rate.NewLimiter(perMinute(globalRate), globalBurst)
+	}
+
+	return limiter
+}
+
+// tokenLimiterFromEnv parses the limits, every rate needs a burst of at least one
+func tokenLimiterFromEnv(podRate, podBurst, globalRate, globalBurst, maxOutstanding, outstandingTTL string) (*TokenLimiter, error) {
+	values := map[string]string{
+		EnvTokenRatePerPod:      podRate,
+		EnvTokenBurstPerPod:     podBurst,
+		EnvTokenRateGlobal:      globalRate,
+		EnvTokenBurstGlobal:     globalBurst,
+		EnvMaxOutstandingTokens: maxOutstanding,
+	}
+
+	parsed := map[string]int{}
+	for name, value := range values {
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid %s %s, expected a number of 0 or more", name, value)
+		}
+		parsed[name] = n
+	}
+
+	if parsed[EnvTokenRatePerPod] > 0 && parsed[EnvTokenBurstPerPod] == 0 {
+		return nil, fmt.Errorf("%s has to be at least 1 when %s is set", EnvTokenBurstPerPod, EnvTokenRatePerPod)
+	}
+
+	if parsed[EnvTokenRateGlobal] > 0 && parsed[EnvTokenBurstGlobal] == 0 {
+		return nil, fmt.Errorf("%s has to be at least 1 when %s is set", EnvTokenBurstGlobal, EnvTokenRateGlobal)
+	}
+
+	ttl, err := time.ParseDuration(outstandingTTL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", EnvOutstandingTokenTTL, err)
+	}
+
+	return NewTokenLimiter(
+		parsed[EnvTokenRatePerPod],
+		parsed[EnvTokenBurstPerPod],
+		parsed[EnvTokenRateGlobal],
+		parsed[EnvTokenBurstGlobal],
+		parsed[EnvMaxOutstandingTokens],
+		ttl,
+	), nil
+}
+
+func perMinute(n int) rate.Limit {
+	if n <= 0 {
+		return rate.Inf
+	}
+
+	return rate.Limit(float64(n) / 60)
+}
+
+// Allow decides if the pod may have another token. used reports whether the token with the accessor has been used, it is
+// nil when the backend cannot tell and the maximum of outstanding tokens is not applied, a pod would otherwise be
+// locked out until its tokens expire. Vault is only asked once the pod is at its maximum and never while the lock is held
+func (l *TokenLimiter) Allow(pod podRef, now time.Time, used func(accessor string) bool) *tokenLimitError {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	l.forgetIdlePods(now)
+	limit := l.podLimit(pod, now)
+	limit.dropExpired(now)
+
+	var unverified []string
+	if used != nil && l.MaxOutstanding > 0 && len(limit.outstanding) >= l.MaxOutstanding {
+		for _, token := range limit.outstanding {
+			unverified = append(unverified, token.accessor)
+		}
+	}
+	l.mu.Unlock()
+
+	var spent []string
+	for _, accessor := range unverified {
+		if used(accessor) {
+			spent = append(spent, accessor)
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limit.drop(spent)
+
+	if used != nil && l.MaxOutstanding > 0 && len(limit.outstanding) >= l.MaxOutstanding {
+		retryAfter := limit.outstanding[0].expiresAt.Sub(now)
+		return &tokenLimitError{
+			Reason:     RejectReasonOutstanding,
+			RetryAfter: retryAfter,
+			err:        fmt.Errorf("%s holds %d unused tokens, the maximum is %d", pod, len(limit.outstanding), l.MaxOutstanding),
+		}
+	}
+
+	reservation, retryAfter := reserve(limit.limiter, now)
+	if reservation == nil {
+		return &tokenLimitError{Reason: RejectReasonPodRate, RetryAfter: retryAfter, err: fmt.Errorf("%s is asking for tokens too often", pod)}
+	}
+
+	if l.global != nil {
+		global, retryAfter := reserve(l.global, now)
+		if global == nil {
+			reservation.CancelAt(now)
+			return &tokenLimitError{Reason: RejectReasonGlobalRate, RetryAfter: retryAfter, err: fmt.Errorf("solon is issuing too many tokens, %s has to wait", pod)}
+		}
+	}
+
+	return nil
+}
+
+// reserve takes a token from the limiter when one is available right now, otherwise it returns how long to wait
+func reserve(limiter *rate.Limiter, now time.Time) (*rate.Reservation, time.Duration) {
+	reservation := limiter.ReserveN(now, 1)
+	if !reservation.OK() {
+		return nil, 0
+	}
+
+	delay := reservation.DelayFrom(now)
+	if delay > 0 {
+		reservation.CancelAt(now)
+		return nil, delay
+	}
+
+	return reservation, 0
+}
+
+// Issued records the accessor of a token handed to the pod, it stays outstanding until it is used or its ttl runs out
+func (l *TokenLimiter) Issued(pod podRef, accessor string, ttl time.Duration, now time.Time) {
+	if l == nil || l.MaxOutstanding <= 0 {
+		return
+	}
+
+	if ttl <= 0 {
+		ttl = l.OutstandingTTL
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limit := l.podLimit(pod, now)
+	limit.outstanding = append(limit.outstanding, outstandingToken{accessor: accessor, expiresAt: now.Add(ttl)})
+}
+
+func (l *TokenLimiter) podLimit(pod podRef, now time.Time) *podLimit {
+	key := pod.String()
+	limit, ok := l.pods[key]
+	if !ok {
+		limit = &podLimit{limiter: rate.NewLimiter(l.podRate, l.podBurst)}
+		l.pods[key] = limit
+	}
+
+	limit.lastSeen = now
+	return limit
+}
+
+// forgetIdlePods drops pods that have not asked for a token in a while and hold no outstanding tokens
+func (l *TokenLimiter) forgetIdlePods(now time.Time) {
+	for key, limit := range l.pods {
+		limit.dropExpired(now)
+		if now.Sub(limit.lastSeen) > idlePodLimit && len(limit.outstanding) == 0 {
+			delete(l.pods, key)
+		}
+	}
+}
+
+// dropExpired removes tokens whose ttl ran out, the oldest token stays first
+func (p *podLimit) dropExpired(now time.Time) {
+	kept := p.outstanding[:0]
+	for _, token := range p.outstanding {
+		if now.Before(token.expiresAt) {
+			kept = append(kept, token)
+		}
+	}
+
+	p.outstanding = kept
+}
+
+// drop removes tokens that have been used
+func (p *podLimit) drop(spent []string) {
+	if len(spent) == 0 {
+		return
+	}
+
+	p.outstanding = slices.DeleteFunc(p.outstanding, func(token outstandingToken) bool {
+		return slices.Contains(spent, token.accessor)
+	})
+}
+
+// rejectToken answers a token request refused by the limiter, Retry-After tells the pod when to come back
+func (s *SolonHandler) rejectToken(w http.ResponseWriter, requestId string, pod podRef, limitErr *tokenLimitError) {
+	s.Metrics.TokenRejected(limitErr.Reason)
+	s.audit(AuditActionTokenIssue, AuditDecisionDenied, pod, requestId, limitErr.Error())
+
+	if limitErr.RetryAfter > 0 {
+		w.Header().Set(headerRetryAfter, strconv.Itoa(int(math.Ceil(limitErr.RetryAfter.Seconds()))))
+	}
+
+	s.respondWithError(w, requestId, newSolonError(delphi.ErrorCodeRateLimited, "token", limitErr))
+}
+
+// tokenUsed asks vault if a token has been used, without a lookup every token is treated as unused. A failed lookup
+// keeps the token outstanding, vault being down must not lift the cap
+func (s *SolonHandler) tokenUsed() func(accessor string) bool {
+	lookup, ok := s.Vault.(tokenLookup)
+	if !ok {
+		return nil
+	}
+
+	return func(accessor string) bool {
+		var valid bool
+		err := s.Metrics.timeVault("lookup_token", func() error {
+			var err error
+			valid, err = lookup.LookupAccessor(accessor)
+			return err
+		})
+		if err != nil {
+			logging.Error(fmt.Sprintf("failed to look up an outstanding token, it stays outstanding: %s", err.Error()))
+			return false
+		}
+
+		return !valid
+	}
+}
@@ -0,0 +1,219 @@
+package lawgiver
+
+import (
+	"encoding/json"
+	"errors"
+	delphi "github.com/odysseia-greek/delphi/solon/models"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTokenLimiter(t *testing.T) {
+	sokrates := refOf("odysseia", "sokrates-5d8f7c9b4-abcde")
+	herodotos := refOf("odysseia", "herodotos-7c9b4d8f5-fghij")
+	now := time.Unix(1730548800, 0)
+	unused := func(accessor string) bool { return false }
+
+	t.Run("PodIsLimitedAfterItsBurst", func(t *testing.T) {
+		sut := NewTokenLimiter(6, 2, 0, 0, 0, time.Minute)
+
+		assert.Nil(t, sut.Allow(sokrates, now, nil))
+		assert.Nil(t, sut.Allow(sokrates, now, nil))
+
+		limitErr := sut.Allow(sokrates, now, nil)
+		assert.NotNil(t, limitErr)
+		assert.Equal(t, RejectReasonPodRate, limitErr.Reason)
+		assert.Equal(t, 10*time.Second, limitErr.RetryAfter)
+
+		assert.Nil(t, sut.Allow(herodotos, now, nil))
+		assert.Nil(t, sut.Allow(sokrates, now.Add(10*time.Second), nil))
+	})
+
+	t.Run("GlobalLimitIsSharedByAllPods", func(t *testing.T) {
+		sut := NewTokenLimiter(60, 5, 60, 1, 0, time.Minute)
+
+		assert.Nil(t, sut.Allow(sokrates, now, nil))
+
+		limitErr := sut.Allow(herodotos, now, nil)
+		assert.NotNil(t, limitErr)
+		assert.Equal(t, RejectReasonGlobalRate, limitErr.Reason)
+	})
+
+	t.Run("GlobalRejectionDoesNotSpendThePodBurst", func(t *testing.T) {
+		sut := NewTokenLimiter(6, 1, 60, 1, 0, time.Minute)
+
+		assert.Nil(t, sut.Allow(herodotos, now, nil))
+		assert.NotNil(t, sut.Allow(sokrates, now, nil))
+		assert.Nil(t, sut.Allow(sokrates, now.Add(time.Second), nil))
+	})
+
+	t.Run("OutstandingTokensAreCapped", func(t *testing.T) {
+		sut := NewTokenLimiter(0, 0, 0, 0, 2, time.Minute)
+
+		sut.Issued(sokrates, "s.first", 0, now)
+		sut.Issued(sokrates, "s.second", 30*time.Second, now)
+
+		limitErr := sut.Allow(sokrates, now, unused)
+		assert.NotNil(t, limitErr)
+		assert.Equal(t, RejectReasonOutstanding, limitErr.Reason)
+
+		assert.Nil(t, sut.Allow(sokrates, now.Add(30*time.Second), unused))
+	})
+
+	t.Run("OutstandingTokensAreNotCappedWithoutALookup", func(t *testing.T) {
+		sut := NewTokenLimiter(0, 0, 0, 0, 1, time.Minute)
+		sut.Issued(sokrates, "s.first", 0, now)
+
+		assert.Nil(t, sut.Allow(sokrates, now, nil))
+	})
+
+	t.Run("UsedTokensAreNoLongerOutstanding", func(t *testing.T) {
+		sut := NewTokenLimiter(0, 0, 0, 0, 1, time.Minute)
+		sut.Issued(sokrates, "s.first", 0, now)
+
+		assert.NotNil(t, sut.Allow(sokrates, now, unused))
+		assert.Nil(t, sut.Allow(sokrates, now, func(accessor string) bool { return accessor == "s.first" }))
+	})
+
+	t.Run("NilLimiterAllowsEverything", func(t *testing.T) {
+		var sut *TokenLimiter
+		assert.Nil(t, sut.Allow(sokrates, now, nil))
+		sut.Issued(sokrates, "s.first", 0, now)
+	})
+
+	t.Run("FromEnv", func(t *testing.T) {
+		sut, err := tokenLimiterFromEnv(defaultTokenRatePerPod, defaultTokenBurstPerPod, defaultTokenRateGlobal, defaultTokenBurstGlobal, defaultMaxOutstandingTokens, defaultOutstandingTokenTTL)
+		assert.Nil(t, err)
+		assert.Equal(t, 5, sut.MaxOutstanding)
+		assert.Equal(t, 10*time.Minute, sut.OutstandingTTL)
+
+		_, err = tokenLimiterFromEnv("6", "0", "0", "0", "0", "1m")
+		assert.NotNil(t, err)
+
+		_, err = tokenLimiterFromEnv("six", "1", "0", "0", "0", "1m")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("RejectedTokenRequestIsCounted", func(t *testing.T) {
+		ns := "test"
+		pods := newTestPodCache()
+		err := addPodForTest("sokrates-5d8f7c9b4-abcde", ns, "dictionary", "api", pods)
+		assert.Nil(t, err)
+
+		sink := &memorySink{}
+		handler := &SolonHandler{
+			Pods:             pods,
+			AuthMode:         AuthModeIP,
+			Namespace:        ns,
+			AccessAnnotation: "odysseia-greek/access",
+			RoleAnnotation:   "odysseia-greek/role",
+			Metrics:          NewMetrics(),
+			Audit:            NewAuditor(sink),
+			Limiter:          NewTokenLimiter(6, 1, 0, 0, 0, time.Minute),
+		}
+		handler.Limiter.Allow(refOf(ns, "sokrates-5d8f7c9b4-abcde"), time.Now(), nil)
+
+		router := InitRoutes(handler)
+		response := performGetRequest(router, "/solon/v1/token")
+		assert.Equal(t, http.StatusTooManyRequests, response.Code)
+		assert.NotEmpty(t, response.Header().Get(headerRetryAfter))
+
+		var sut delphi.SolonError
+		err = json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+		assert.Equal(t, delphi.ErrorCodeRateLimited, sut.Code)
+		handler.Audit.Close()
+		assert.Equal(t, AuditDecisionDenied, sink.events[0].Decision)
+
+		response = performGetRequest(router, "/solon/v1/metrics")
+		assert.Contains(t, response.Body.String(), `solon_token_rejections_total{reason="pod_rate"} 1`)
+	})
+
+	t.Run("BackendWithoutLookupDoesNotLockOutAPod", func(t *testing.T) {
+		ns := "test"
+		newRouter := func(backend SecretBackend) http.Handler {
+			pods := newTestPodCache()
+			assert.Nil(t, addPodForTest("sokrates-5d8f7c9b4-abcde", ns, "dictionary", "api", pods))
+
+			return InitRoutes(&SolonHandler{
+				Vault:     backend,
+				Pods:      pods,
+				AuthMode:  AuthModeIP,
+				Namespace: ns,
+				Limiter:   NewTokenLimiter(0, 0, 0, 0, 1, time.Minute),
+			})
+		}
+
+		router := newRouter(NewMemoryBackend())
+		assert.Equal(t, http.StatusOK, performGetRequest(router, "/solon/v1/token").Code)
+		assert.Equal(t, http.StatusTooManyRequests, performGetRequest(router, "/solon/v1/token").Code, "the unused token is outstanding")
+
+		router = newRouter(struct{ SecretBackend }{NewMemoryBackend()})
+		assert.Equal(t, http.StatusOK, performGetRequest(router, "/solon/v1/token").Code)
+		assert.Equal(t, http.StatusOK, performGetRequest(router, "/solon/v1/token").Code, "a backend that cannot look up tokens does not cap them")
+	})
+
+	t.Run("OnlyTheAccessorIsKept", func(t *testing.T) {
+		ns := "test"
+		pods := newTestPodCache()
+		assert.Nil(t, addPodForTest("sokrates-5d8f7c9b4-abcde", ns, "dictionary", "api", pods))
+
+		backend := NewMemoryBackend()
+		handler := &SolonHandler{
+			Vault:     backend,
+			Pods:      pods,
+			AuthMode:  AuthModeIP,
+			Namespace: ns,
+			Limiter:   NewTokenLimiter(0, 0, 0, 0, 1, time.Minute),
+		}
+
+		response := performGetRequest(InitRoutes(handler), "/solon/v1/token")
+		assert.Equal(t, http.StatusOK, response.Code)
+
+		var sut delphi.TokenResponse
+		assert.Nil(t, json.NewDecoder(response.Body).Decode(&sut))
+
+		outstanding := handler.Limiter.pods[refOf(ns, "sokrates-5d8f7c9b4-abcde").String()].outstanding
+		assert.Len(t, outstanding, 1)
+		assert.NotEqual(t, sut.Token, outstanding[0].accessor)
+
+		valid, err := backend.LookupAccessor(outstanding[0].accessor)
+		assert.Nil(t, err)
+		assert.True(t, valid)
+	})
+
+	t.Run("FailedLookupKeepsTheTokenOutstanding", func(t *testing.T) {
+		ns := "test"
+		pods := newTestPodCache()
+		assert.Nil(t, addPodForTest("sokrates-5d8f7c9b4-abcde", ns, "dictionary", "api", pods))
+
+		backend := &unreachableLookup{MemoryBackend: NewMemoryBackend()}
+		router := InitRoutes(&SolonHandler{
+			Vault:     backend,
+			Pods:      pods,
+			AuthMode:  AuthModeIP,
+			Namespace: ns,
+			Limiter:   NewTokenLimiter(0, 0, 0, 0, 1, time.Minute),
+		})
+
+		assert.Equal(t, http.StatusOK, performGetRequest(router, "/solon/v1/token").Code)
+		backend.down = true
+		assert.Equal(t, http.StatusTooManyRequests, performGetRequest(router, "/solon/v1/token").Code)
+	})
+}
+
+// unreachableLookup is a memory backend whose token lookups fail once it is down
+type unreachableLookup struct {
+	*MemoryBackend
+	down bool
+}
+
+func (u *unreachableLookup) LookupAccessor(accessor string) (bool, error) {
+	if u.down {
+		return false, errors.New("vault is sealed")
+	}
+
+	return u.MemoryBackend.LookupAccessor(accessor)
+}
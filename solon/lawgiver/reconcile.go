@@ -0,0 +1,306 @@
+package lawgiver
+
+import (
+	"context"
+	"fmt"
+	plato "github.com/odysseia-greek/agora/plato/config"
+	"github.com/odysseia-greek/agora/plato/logging"
+	"github.com/odysseia-greek/agora/plato/middleware"
+	delphi "github.com/odysseia-greek/delphi/solon/models"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	EnvReconcileInterval string = "SOLON_RECONCILE_INTERVAL"
+	EnvReconcileDryRun   string = "SOLON_RECONCILE_DRY_RUN"
+
+	defaultReconcileInterval string = "10m"
+	dryRunQueryParam         string = "dryRun"
+	// policyPrefix is the prefix of legacy policies, scopedPolicyPrefix of the policies of a pod in a namespace
+	policyPrefix       string = "policy-"
+	scopedPolicyPrefix string = "policy."
+)
+
+// Reconciler periodically sweeps vault and elasticsearch for resources whose pod no longer exists,
+// it catches every delete event that was missed while solon was not running
+type Reconciler struct {
+	Interval time.Duration
+	DryRun   bool
+
+	mu   sync.Mutex
+	last *delphi.ReconcileReport
+}
+
+func NewReconciler(interval time.Duration, dryRun bool) *Reconciler {
+	return &Reconciler{Interval: interval, DryRun: dryRun}
+}
+
+func (r *Reconciler) store(report *delphi.ReconcileReport) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.last = report
+}
+
+func (r *Reconciler) lastReport() *delphi.ReconcileReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.last
+}
+
+// StartReconciling sweeps for orphans every interval until the context is done
+func (s *SolonHandler) StartReconciling(ctx context.Context) {
+	if s.Reconciler == nil || s.Reconciler.Interval <= 0 {
+		logging.System("reconciler disabled, orphans are only removed on pod delete events")
+		return
+	}
+
+	logging.System(fmt.Sprintf("reconciling orphans every %s with dry run set to %v", s.Reconciler.Interval, s.Reconciler.DryRun))
+
+	ticker := time.NewTicker(s.Reconciler.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report := s.reconcile(s.Reconciler.DryRun)
+			s.Reconciler.store(report)
+			logging.System(fmt.Sprintf("reconcile finished with %d orphans and %d errors", len(report.Orphans), len(report.Errors)))
+		}
+	}
+}
+
+// reconcile compares the secrets, policies and users in vault and elasticsearch with the live pods
+// and removes the leftovers unless dryRun is set
+func (s *SolonHandler) reconcile(dryRun bool) *delphi.ReconcileReport {
+	report := &delphi.ReconcileReport{
+		StartedAt: time.Now().UTC(),
+		DryRun:    dryRun,
+		Orphans:   []delphi.Orphan{},
+	}
+
+	orphans, errs := s.findOrphans()
+	for _, err := range errs {
+		report.Errors = append(report.Errors, err.Error())
+	}
+
+	for _, orphan := range orphans {
+		if !dryRun {
+			err := s.removeOrphan(orphan)
+			if err != nil {
+				orphan.Error = err.Error()
+				s.audit(AuditActionOrphanCleanup, AuditDecisionFailed, refOf(orphan.Namespace, orphan.Pod), "", fmt.Sprintf("failed to remove %s %s: %s", orphan.Resource, orphan.Name, err.Error()))
+			} else {
+				orphan.Removed = true
+				s.audit(AuditActionOrphanCleanup, AuditDecisionAllowed, refOf(orphan.Namespace, orphan.Pod), "", fmt.Sprintf("removed %s %s", orphan.Resource, orphan.Name))
+			}
+		}
+
+		report.Orphans = append(report.Orphans, orphan)
+	}
+
+	report.FinishedAt = time.Now().UTC()
+	return report
+}
+
+// findOrphans lists every resource solon created and returns the ones whose pod is gone, when the pod cache cannot
+// answer nothing is returned because every resource would look orphaned
+func (s *SolonHandler) findOrphans() ([]delphi.Orphan, []error) {
+	var errs []error
+
+	refs, err := s.listRegistrations()
+	if err != nil {
+		return nil, []error{fmt.Errorf("failed to list secrets: %w", err)}
+	}
+
+	// the users of a provider are listed once, the first time a registration in it is found
+	users := map[string]map[string]bool{}
+	usersOf := func(provider CredentialProvider) map[string]bool {
+		if listed, ok := users[provider.Name()]; ok {
+			return listed
+		}
+
+		listed := map[string]bool{}
+		users[provider.Name()] = listed
+
+		var userList []string
+		err := s.Metrics.timeProvider(provider.Name(), "list_users", func() error {
+			var err error
+			userList, err = provider.ListUsers()
+			return err
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to list users in %s: %w", provider.Name(), err))
+		}
+		for _, user := range userList {
+			listed[user] = true
+		}
+
+		return listed
+	}
+
+	var orphans []delphi.Orphan
+	orphanedPolicies := map[string]bool{}
+
+	for _, ref := range refs {
+		kept, err := s.isKept(ref)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to look up pod %s: %w", ref, err))
+			continue
+		}
+
+		if kept {
+			continue
+		}
+
+		orphanedPolicies[ref.policyName()] = true
+		orphans = append(orphans,
+			delphi.Orphan{Resource: OrphanResourceVaultSecret, Name: ref.secretName(), Pod: ref.Name, Namespace: ref.Namespace},
+			delphi.Orphan{Resource: OrphanResourceVaultPolicy, Name: ref.policyName(), Pod: ref.Name, Namespace: ref.Namespace},
+		)
+
+		data, err := s.readRegistrationData(ref.secretName())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to read secret %s: %w", ref.secretName(), err))
+			continue
+		}
+
+		if data == nil {
+			continue
+		}
+
+		usernames := data.ownedUsernames(ref.Name)
+		if len(usernames) == 0 {
+			continue
+		}
+
+		provider, err := s.providerOfRegistration(data)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("users of %s cannot be checked: %w", ref, err))
+			continue
+		}
+
+		listed := usersOf(provider)
+		for _, username := range usernames {
+			if listed[username] {
+				orphans = append(orphans, delphi.Orphan{Resource: userResource(provider.Name()), Name: username, Pod: ref.Name, Namespace: ref.Namespace})
+			}
+		}
+	}
+
+	lister, ok := s.Vault.(policyLister)
+	if !ok {
+		return orphans, errs
+	}
+
+	policies, err := lister.ListPolicies()
+	if err != nil {
+		return orphans, append(errs, fmt.Errorf("failed to list policies: %w", err))
+	}
+
+	// a policy is only removed when solon holds a registration for its pod, a policy that merely looks like one
+	// of solon may have been written by someone else sharing vault
+	for _, policy := range policies {
+		ref, ok := s.refOfPolicy(policy)
+		if !ok || orphanedPolicies[policy] {
+			continue
+		}
+
+		kept, err := s.isKept(ref)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to look up pod %s: %w", ref, err))
+			continue
+		}
+
+		if kept {
+			continue
+		}
+
+		data, err := s.readRegistrationData(ref.secretName())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to read secret %s: %w", ref.secretName(), err))
+			continue
+		}
+
+		if data == nil {
+			logging.Debug(fmt.Sprintf("policy %s has no registration of %s, it is left alone", policy, ref))
+			continue
+		}
+
+		orphans = append(orphans, delphi.Orphan{Resource: OrphanResourceVaultPolicy, Name: policy, Pod: ref.Name, Namespace: ref.Namespace})
+	}
+
+	return orphans, errs
+}
+
+// isKept is true for a pod that still exists or that was deleted within the cleanup grace window,
+// the cleanup scheduler decides about the registration of the latter
+func (s *SolonHandler) isKept(ref podRef) (bool, error) {
+	if s.Cleanup.isPending(ref) {
+		return true, nil
+	}
+
+	return s.isLivePod(ref)
+}
+
+// isLivePod is true for every pod in the cache whatever its phase, a pod that is starting up or terminating
+// still uses its registration
+func (s *SolonHandler) isLivePod(ref podRef) (bool, error) {
+	return s.Pods.Has(ref.Namespace, ref.Name)
+}
+
+func (s *SolonHandler) removeOrphan(orphan delphi.Orphan) error {
+	switch orphan.Resource {
+	case OrphanResourceVaultSecret:
+		return s.removeVaultSecret(orphan.Name)
+	case OrphanResourceVaultPolicy:
+		return s.removeVaultPolicy(orphan.Name)
+	case OrphanResourceElasticUser:
+		return s.removeOrphanedUser(ProviderElasticsearch, orphan.Name)
+	}
+
+	if name, ok := strings.CutSuffix(orphan.Resource, orphanResourceUserSuffix); ok {
+		return s.removeOrphanedUser(name, orphan.Name)
+	}
+
+	return fmt.Errorf("unknown resource %s", orphan.Resource)
+}
+
+func (s *SolonHandler) removeOrphanedUser(providerName, username string) error {
+	provider, err := s.credentialProvider(providerName)
+	if err != nil {
+		return err
+	}
+
+	return s.removeUser(provider, username)
+}
+
+// ReconcileReport returns the report of the last sweep, a dry run is done on the spot when asked for or when no sweep ran yet.
+// The report names every pod and user solon knows of so only admins can read it
+func (s *SolonHandler) ReconcileReport(w http.ResponseWriter, req *http.Request) {
+	requestId := req.Header.Get(plato.HeaderKey)
+	w.Header().Set(plato.HeaderKey, requestId)
+
+	admin, err := s.requireAdmin(req)
+	if err != nil {
+		s.audit(AuditActionReconcileRead, AuditDecisionDenied, podRef{}, requestId, err.Error())
+		s.respondWithError(w, requestId, err)
+		return
+	}
+
+	var report *delphi.ReconcileReport
+	if s.Reconciler != nil && req.URL.Query().Get(dryRunQueryParam) != "true" {
+		report = s.Reconciler.lastReport()
+	}
+
+	if report == nil {
+		report = s.reconcile(true)
+	}
+
+	s.audit(AuditActionReconcileRead, AuditDecisionAllowed, podRef{}, requestId, fmt.Sprintf("read by %s", admin))
+	middleware.ResponseWithCustomCode(w, http.StatusOK, report)
+}
@@ -0,0 +1,195 @@
+package lawgiver
+
+import (
+	"encoding/json"
+	elastic "github.com/odysseia-greek/agora/aristoteles"
+	delphi "github.com/odysseia-greek/delphi/solon/models"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestReconcile(t *testing.T) {
+	ns := "test"
+	livePod := "sokrates-5d8f7c9b4-abcde"
+	deadPod := "herodotos-7c9b4d8f5-fghij"
+	liveRef := refOf(ns, livePod)
+	deadRef := refOf(ns, deadPod)
+	usersFixture := []byte(`{"sokratesabcde":{"username":"sokratesabcde"},"herodotosfghij":{"username":"herodotosfghij"}}`)
+
+	newTestHandler := func(t *testing.T) (*SolonHandler, *fakeVault) {
+		pods := newTestPodCache()
+		err := addPodForTest(livePod, ns, "dictionary", "api", pods)
+		assert.Nil(t, err)
+
+		vault := &fakeVault{
+			secrets: map[string]map[string]interface{}{
+				liveRef.secretName(): {"elasticUsername": "sokratesabcde"},
+				deadRef.secretName(): {"elasticUsername": "herodotosfghij"},
+			},
+			policies: []string{liveRef.policyName(), deadRef.policyName(), "policy-alkibiades-1a2b3c4d5-klmno", "default"},
+		}
+
+		mockElasticClient, err := elastic.NewMockClient([][]byte{usersFixture, []byte(`{"found":true}`)}, 200)
+		assert.Nil(t, err)
+
+		return &SolonHandler{
+			Vault:     vault,
+			Elastic:   mockElasticClient,
+			Pods:      pods,
+			Namespace: ns,
+		}, vault
+	}
+
+	t.Run("DryRunRemovesNothing", func(t *testing.T) {
+		handler, vault := newTestHandler(t)
+
+		report := handler.reconcile(true)
+		assert.True(t, report.DryRun)
+		assert.Empty(t, report.Errors)
+		assert.Empty(t, vault.removed)
+		assert.ElementsMatch(t, []delphi.Orphan{
+			{Resource: OrphanResourceVaultSecret, Name: "test/herodotos-7c9b4d8f5-fghij", Pod: deadPod, Namespace: ns},
+			{Resource: OrphanResourceVaultPolicy, Name: "policy.test.herodotos-7c9b4d8f5-fghij", Pod: deadPod, Namespace: ns},
+			{Resource: OrphanResourceElasticUser, Name: "herodotosfghij", Pod: deadPod, Namespace: ns},
+		}, report.Orphans)
+	})
+
+	t.Run("SweepRemovesOrphans", func(t *testing.T) {
+		handler, vault := newTestHandler(t)
+
+		report := handler.reconcile(false)
+		assert.Len(t, report.Orphans, 3)
+		for _, orphan := range report.Orphans {
+			assert.True(t, orphan.Removed, orphan.Name)
+		}
+		assert.ElementsMatch(t, []string{deadRef.secretName(), deadRef.policyName()}, vault.removed)
+		assert.Contains(t, vault.secrets, liveRef.secretName())
+	})
+
+	t.Run("PolicyWithoutRegistrationIsKept", func(t *testing.T) {
+		handler, vault := newTestHandler(t)
+		vault.secrets = map[string]map[string]interface{}{}
+		vault.policies = []string{"policy-alkibiades-1a2b3c4d5-klmno", refOf(ns, "alkibiades-1a2b3c4d5-klmno").policyName()}
+
+		report := handler.reconcile(false)
+		assert.Empty(t, report.Errors)
+		assert.Empty(t, report.Orphans)
+		assert.Empty(t, vault.removed)
+	})
+
+	t.Run("PodsInTheGraceWindowAreKept", func(t *testing.T) {
+		handler, vault := newTestHandler(t)
+		handler.Cleanup = NewCleanupScheduler(time.Hour)
+		t.Cleanup(handler.Cleanup.Stop)
+		handler.Cleanup.schedule(deadRef, func() {})
+
+		report := handler.reconcile(false)
+		assert.Empty(t, report.Errors)
+		assert.Empty(t, report.Orphans)
+		assert.Empty(t, vault.removed)
+	})
+
+	t.Run("PodsStartingOrTerminatingAreKept", func(t *testing.T) {
+		handler, vault := newTestHandler(t)
+		starting := runningPodForTest("platon-6c8d9f7b5-pqrst", ns, "dictionary", "api")
+		starting.Status.Phase = v1.PodPending
+		starting.Status.PodIP = ""
+		terminating := runningPodForTest("alkibiades-1a2b3c4d5-klmno", ns, "dictionary", "api")
+		terminating.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+		for _, pod := range []*v1.Pod{starting, terminating} {
+			assert.Nil(t, handler.Pods.indexer.Add(pod))
+			vault.secrets[refOf(ns, pod.Name).secretName()] = map[string]interface{}{"elasticUsername": pod.Name}
+		}
+
+		report := handler.reconcile(true)
+		assert.Empty(t, report.Errors)
+		assert.ElementsMatch(t, []delphi.Orphan{
+			{Resource: OrphanResourceVaultSecret, Name: "test/herodotos-7c9b4d8f5-fghij", Pod: deadPod, Namespace: ns},
+			{Resource: OrphanResourceVaultPolicy, Name: "policy.test.herodotos-7c9b4d8f5-fghij", Pod: deadPod, Namespace: ns},
+			{Resource: OrphanResourceElasticUser, Name: "herodotosfghij", Pod: deadPod, Namespace: ns},
+		}, report.Orphans)
+	})
+
+	t.Run("LegacySecretsBelongToTheHomeNamespace", func(t *testing.T) {
+		handler, vault := newTestHandler(t)
+		vault.secrets = map[string]map[string]interface{}{
+			deadPod: {"elasticUsername": "herodotosfghij"},
+		}
+		vault.policies = nil
+
+		report := handler.reconcile(true)
+		assert.Empty(t, report.Errors)
+		assert.ElementsMatch(t, []delphi.Orphan{
+			{Resource: OrphanResourceVaultSecret, Name: deadPod, Pod: deadPod, Namespace: ns},
+			{Resource: OrphanResourceVaultPolicy, Name: "policy-herodotos-7c9b4d8f5-fghij", Pod: deadPod, Namespace: ns},
+			{Resource: OrphanResourceElasticUser, Name: "herodotosfghij", Pod: deadPod, Namespace: ns},
+		}, report.Orphans)
+	})
+
+	t.Run("OnlyServedNamespacesAreSwept", func(t *testing.T) {
+		handler, vault := newTestHandler(t)
+		handler.Namespaces = NewNamespaceList(ns, "staging")
+		vault.secrets = map[string]map[string]interface{}{
+			liveRef.secretName():                {"elasticUsername": "sokratesabcde"},
+			"staging/sokrates-5d8f7c9b4-abcde":  {"elasticUsername": "sokratesstaging"},
+			"production/herodotos-7c9b4d8f5-fg": {"elasticUsername": "herodotosfg"},
+		}
+		vault.policies = []string{"policy.staging.sokrates-5d8f7c9b4-abcde", "policy.production.herodotos-7c9b4d8f5-fg", "policy-alkibiades-1a2b3c4d5-klmno"}
+
+		report := handler.reconcile(true)
+		assert.Empty(t, report.Errors)
+		assert.ElementsMatch(t, []delphi.Orphan{
+			{Resource: OrphanResourceVaultSecret, Name: "staging/sokrates-5d8f7c9b4-abcde", Pod: livePod, Namespace: "staging"},
+			{Resource: OrphanResourceVaultPolicy, Name: "policy.staging.sokrates-5d8f7c9b4-abcde", Pod: livePod, Namespace: "staging"},
+		}, report.Orphans)
+	})
+
+	t.Run("CacheNotSyncedFindsNothing", func(t *testing.T) {
+		handler, vault := newTestHandler(t)
+		handler.Pods.hasSynced = func() bool { return false }
+
+		report := handler.reconcile(false)
+		assert.Empty(t, report.Orphans)
+		assert.NotEmpty(t, report.Errors)
+		assert.Empty(t, vault.removed)
+	})
+
+	t.Run("ReportEndpoint", func(t *testing.T) {
+		admin := "system:serviceaccount:odysseia:drakon"
+		handler, vault := newTestHandler(t)
+		handler.Reconciler = NewReconciler(0, false)
+		handler.AuthMode = AuthModeServiceAccount
+		handler.TokenReviewer = fakeTokenReviewer(true, admin, "", "")
+		handler.Admins = []string{admin}
+
+		router := InitRoutes(handler)
+		response := performGetRequestWithToken(router, "/solon/v1/reconcile", "admin-token")
+		assert.Equal(t, http.StatusOK, response.Code)
+
+		var sut delphi.ReconcileReport
+		err := json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+		assert.True(t, sut.DryRun)
+		assert.Len(t, sut.Orphans, 3)
+		assert.Empty(t, vault.removed)
+	})
+
+	t.Run("ReportEndpointNeedsAnAdmin", func(t *testing.T) {
+		handler, vault := newTestHandler(t)
+		handler.AuthMode = AuthModeIP
+
+		router := InitRoutes(handler)
+		response := performGetRequest(router, "/solon/v1/reconcile?dryRun=true")
+
+		var sut delphi.SolonError
+		err := json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusForbidden, response.Code)
+		assert.Equal(t, delphi.ErrorCodeAdminRequired, sut.Code)
+		assert.Empty(t, vault.removed)
+	})
+}
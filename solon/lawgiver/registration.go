@@ -0,0 +1,240 @@
+package lawgiver
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hashicorp/vault/api"
+	v1 "k8s.io/api/core/v1"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	HeaderIdempotencyKey string = "Idempotency-Key"
+	rotateQueryParam     string = "rotate"
+
+	// EnvSharedUsernames is a comma separated list of usernames every pod may ask to share, the tracing user by default
+	EnvSharedUsernames string = "SOLON_SHARED_USERNAMES"
+	// DefaultUsernameAnnotation names a shared username a single pod may ask for on top of EnvSharedUsernames
+	DefaultUsernameAnnotation string = "odysseia-greek/username"
+)
+
+// Registration is the record solon keeps next to the credentials of every pod it registered
+type Registration struct {
+	PodName        string `json:"podName"`
+	Namespace      string `json:"namespace,omitempty"`
+	PodUID         string `json:"podUid"`
+	Username       string `json:"username"`
+	SharedUsername bool   `json:"sharedUsername,omitempty"`
+	// Provider holds the users of the pod, registrations without one were created in elasticsearch
+	Provider       string    `json:"provider,omitempty"`
+	Roles          []string  `json:"roles"`
+	Leases         []Lease   `json:"leases,omitempty"`
+	IdempotencyKey string    `json:"idempotencyKey,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// registrationSecret is the payload written to vault, the credentials keep the keys sidecars already read
+// and the registration is stored alongside them so solon can recognise its own work
+type registrationSecret struct {
+	Data registrationData `json:"data"`
+}
+
+type registrationData struct {
+	Username       string        `json:"elasticUsername"`
+	Password       string        `json:"elasticPassword"`
+	ElasticCERT    string        `json:"elasticCert"`
+	LeaseExpiresAt *time.Time    `json:"leaseExpiresAt,omitempty"`
+	Registration   *Registration `json:"registration,omitempty"`
+}
+
+func (r *registrationSecret) Marshal() ([]byte, error) {
+	return json.Marshal(r)
+}
+
+// usernameForPod is the elastic username solon assigns to a pod, elastic does not accept hyphens in a username
+// so the first and last part of the pod name are joined: sokrates-5d8f7c9b4-abcde becomes sokratesabcde
+func usernameForPod(podName string) string {
+	splitPodName := strings.Split(podName, "-")
+	if len(splitPodName) > 1 {
+		return splitPodName[0] + splitPodName[len(splitPodName)-1]
+	}
+
+	return splitPodName[0]
+}
+
+// usernameFor returns the username a pod registers with and whether it is shared. A pod gets the username solon
+// assigns unless it asks for one that is on the shared list or declared in its username annotation, anything else
+// would let a pod take over the user of another pod
+func (s *SolonHandler) usernameFor(pod *v1.Pod, requested string) (string, bool, error) {
+	username := usernameForPod(pod.Name)
+	if requested == "" || requested == username {
+		return username, false, nil
+	}
+
+	annotation := s.UsernameAnnotation
+	if annotation == "" {
+		annotation = DefaultUsernameAnnotation
+	}
+
+	if !slices.Contains(s.SharedUsernames, requested) && pod.Annotations[annotation] != requested {
+		return "", false, fmt.Errorf("%s asked for username %s which is neither in %s nor in its %s annotation", pod.Name, requested, EnvSharedUsernames, annotation)
+	}
+
+	return requested, true, nil
+}
+
+// ownedUsernames returns the users that were created for this pod alone and may be removed with it,
+// a username shared between pods is never returned. Secrets written before solon kept a registration
+// only own their user when it follows the naming scheme
+func (d *registrationData) ownedUsernames(podName string) []string {
+	if d.Registration != nil {
+		if d.Registration.SharedUsername {
+			return nil
+		}
+
+		if len(d.Registration.Leases) > 0 {
+			var usernames []string
+			for _, lease := range d.Registration.Leases {
+				if !lease.Revoked {
+					usernames = append(usernames, lease.Username)
+				}
+			}
+			return usernames
+		}
+
+		return []string{d.Registration.Username}
+	}
+
+	if d.Username == usernameForPod(podName) {
+		return []string{d.Username}
+	}
+
+	return nil
+}
+
+// isRepeatOf decides if a request is a repeat of this registration: the same pod asking again, or a new pod that
+// reuses the name and presents the idempotency key of the earlier request
+func (r *Registration) isRepeatOf(podUID, idempotencyKey string) bool {
+	if r.PodUID == podUID {
+		return true
+	}
+
+	return idempotencyKey != "" && r.IdempotencyKey == idempotencyKey
+}
+
+// providerName is the provider holding the users of the pod, registrations from before providers existed used elasticsearch
+func (r *Registration) providerName() string {
+	if r.Provider == "" {
+		return ProviderElasticsearch
+	}
+
+	return r.Provider
+}
+
+// conflictsWith is true when a repeated request asks for something else than what was registered
+func (r *Registration) conflictsWith(username string, roles []string) bool {
+	if r.Username != username {
+		return true
+	}
+
+	sortedRoles := slices.Clone(roles)
+	slices.Sort(sortedRoles)
+	registeredRoles := slices.Clone(r.Roles)
+	slices.Sort(registeredRoles)
+
+	return !slices.Equal(sortedRoles, registeredRoles)
+}
+
+// readRegistration returns the registration stored in the vault secret of a pod, nil when the secret was not written by solon
+func (s *SolonHandler) readRegistration(podName string) (*Registration, error) {
+	data, err := s.readRegistrationData(podName)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	return data.Registration, nil
+}
+
+// readRegistrationData returns the credentials and registration stored in the vault secret of a pod, nil when there is no secret
+func (s *SolonHandler) readRegistrationData(podName string) (*registrationData, error) {
+	var secret *api.Secret
+	err := s.Metrics.timeVault("get_secret", func() error {
+		var err error
+		secret, err = s.Vault.GetSecret(podName)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := parseRegistrationData(secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse secret for %s: %w", podName, err)
+	}
+
+	return data, nil
+}
+
+// secretVersion reads back the kv v2 version of a secret from the metadata vault returns with every read
+func (s *SolonHandler) secretVersion(secretName string) (int, error) {
+	var secret *api.Secret
+	err := s.Metrics.timeVault("get_secret", func() error {
+		var err error
+		secret, err = s.Vault.GetSecret(secretName)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return versionOf(secretName, secret)
+}
+
+// versionOf reads the version from the kv v2 metadata of a secret
+func versionOf(secretName string, secret *api.Secret) (int, error) {
+	if secret == nil || secret.Data == nil {
+		return 0, fmt.Errorf("secret %s came back empty", secretName)
+	}
+
+	metadata, ok := secret.Data["metadata"].(map[string]interface{})
+	if !ok {
+		return 0, fmt.Errorf("secret %s has no kv v2 metadata", secretName)
+	}
+
+	switch version := metadata["version"].(type) {
+	case json.Number:
+		v, err := version.Int64()
+		return int(v), err
+	case float64:
+		return int(version), nil
+	default:
+		return 0, fmt.Errorf("secret %s has no version in its metadata", secretName)
+	}
+}
+
+// parseRegistrationData reads the kv v2 data block of a secret
+func parseRegistrationData(secret *api.Secret) (*registrationData, error) {
+	if secret == nil || secret.Data == nil {
+		return nil, nil
+	}
+
+	value, ok := secret.Data["data"]
+	if !ok || value == nil {
+		return nil, nil
+	}
+
+	j, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var data registrationData
+	err = json.Unmarshal(j, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &data, nil
+}
@@ -0,0 +1,219 @@
+package lawgiver
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/hashicorp/vault/api"
+	elastic "github.com/odysseia-greek/agora/aristoteles"
+	delphi "github.com/odysseia-greek/delphi/solon/models"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRegistration(t *testing.T) {
+	registration := Registration{
+		PodName:        "sokrates-5d8f7c9b4-abcde",
+		PodUID:         "d9b0f5a4-8e8c-4b4c-a1a4-0c7d6f1f2a11",
+		Username:       "sokratesabcde",
+		Roles:          []string{"dictionary_api", "text_api"},
+		IdempotencyKey: "register-sokrates-1",
+		CreatedAt:      time.Now(),
+	}
+
+	t.Run("RepeatForSamePodUID", func(t *testing.T) {
+		assert.True(t, registration.isRepeatOf(registration.PodUID, ""))
+	})
+
+	t.Run("RepeatForSameIdempotencyKey", func(t *testing.T) {
+		assert.True(t, registration.isRepeatOf("another-uid", registration.IdempotencyKey))
+	})
+
+	t.Run("NewPodWithSameName", func(t *testing.T) {
+		assert.False(t, registration.isRepeatOf("another-uid", ""))
+		assert.False(t, registration.isRepeatOf("another-uid", "register-sokrates-2"))
+	})
+
+	t.Run("RolesInOtherOrderDoNotConflict", func(t *testing.T) {
+		assert.False(t, registration.conflictsWith(registration.Username, []string{"text_api", "dictionary_api"}))
+	})
+
+	t.Run("DifferentRolesConflict", func(t *testing.T) {
+		assert.True(t, registration.conflictsWith(registration.Username, []string{"dictionary_seeder"}))
+	})
+
+	t.Run("DifferentUsernameConflicts", func(t *testing.T) {
+		assert.True(t, registration.conflictsWith("platon", registration.Roles))
+	})
+}
+
+func TestParseRegistrationData(t *testing.T) {
+	t.Run("SecretWrittenBySolon", func(t *testing.T) {
+		secret := &api.Secret{
+			Data: map[string]interface{}{
+				"data": map[string]interface{}{
+					"elasticUsername": "sokratesabcde",
+					"elasticPassword": "secret",
+					"registration": map[string]interface{}{
+						"podName":  "sokrates-5d8f7c9b4-abcde",
+						"podUid":   "d9b0f5a4",
+						"username": "sokratesabcde",
+						"roles":    []interface{}{"dictionary_api"},
+					},
+				},
+				"metadata": map[string]interface{}{
+					"version": 2,
+				},
+			},
+		}
+
+		sut, err := parseRegistrationData(secret)
+		assert.Nil(t, err)
+		assert.Equal(t, "secret", sut.Password)
+		assert.Equal(t, "d9b0f5a4", sut.Registration.PodUID)
+		assert.Equal(t, []string{"dictionary_api"}, sut.Registration.Roles)
+	})
+
+	t.Run("SecretWithoutRegistration", func(t *testing.T) {
+		secret := &api.Secret{
+			Data: map[string]interface{}{
+				"data": map[string]interface{}{
+					"elasticUsername": "sokratesabcde",
+				},
+			},
+		}
+
+		sut, err := parseRegistrationData(secret)
+		assert.Nil(t, err)
+		assert.Nil(t, sut.Registration)
+	})
+
+	t.Run("EmptySecret", func(t *testing.T) {
+		sut, err := parseRegistrationData(nil)
+		assert.Nil(t, err)
+		assert.Nil(t, sut)
+	})
+}
+
+func TestUsernameForPod(t *testing.T) {
+	t.Run("Deployment", func(t *testing.T) {
+		assert.Equal(t, "sokratesabcde", usernameForPod("sokrates-5d8f7c9b4-abcde"))
+	})
+
+	t.Run("SinglePart", func(t *testing.T) {
+		assert.Equal(t, "sokrates", usernameForPod("sokrates"))
+	})
+
+	t.Run("OwnedByRegistration", func(t *testing.T) {
+		data := registrationData{Username: "socrates", Registration: &Registration{Username: "socrates"}}
+		assert.Equal(t, []string{"socrates"}, data.ownedUsernames("sokrates-5d8f7c9b4-abcde"))
+	})
+
+	t.Run("SharedIsNeverOwned", func(t *testing.T) {
+		data := registrationData{Username: "agreus", Registration: &Registration{Username: "agreus", SharedUsername: true}}
+		assert.Empty(t, data.ownedUsernames("sokrates-5d8f7c9b4-abcde"))
+	})
+
+	t.Run("LeasedUsersThatAreNotRevoked", func(t *testing.T) {
+		data := registrationData{Registration: &Registration{Username: "sokratesabcde", Leases: []Lease{
+			{Username: "sokratesabcde_1730000000", Revoked: true},
+			{Username: "sokratesabcde_1730028800"},
+		}}}
+		assert.Equal(t, []string{"sokratesabcde_1730028800"}, data.ownedUsernames("sokrates-5d8f7c9b4-abcde"))
+	})
+
+	t.Run("LegacySecretFollowingTheScheme", func(t *testing.T) {
+		data := registrationData{Username: "sokratesabcde"}
+		assert.Equal(t, []string{"sokratesabcde"}, data.ownedUsernames("sokrates-5d8f7c9b4-abcde"))
+	})
+
+	t.Run("LegacySecretWithOtherUsername", func(t *testing.T) {
+		data := registrationData{Username: "agreus"}
+		assert.Empty(t, data.ownedUsernames("sokrates-5d8f7c9b4-abcde"))
+	})
+}
+
+func TestSharedUsername(t *testing.T) {
+	ns := "test"
+	podName := "sokrates-5d8f7c9b4-abcde"
+
+	register := func(t *testing.T, username string, annotations map[string]string) (*httptest.ResponseRecorder, *MemoryBackend) {
+		mockElasticClient, err := elastic.NewMockClient("createUser", 200)
+		assert.Nil(t, err)
+
+		pods := newTestPodCache()
+		pod := runningPodForTest(podName, ns, "dictionary", "api")
+		for key, value := range annotations {
+			pod.Annotations[key] = value
+		}
+		assert.Nil(t, pods.indexer.Add(pod))
+
+		backend := NewMemoryBackend()
+		handler := &SolonHandler{
+			Elastic:          mockElasticClient,
+			Vault:            backend,
+			Pods:             pods,
+			AuthMode:         AuthModeIP,
+			Namespace:        ns,
+			AccessAnnotation: "odysseia-greek/access",
+			RoleAnnotation:   "odysseia-greek/role",
+			SharedUsernames:  []string{"agreus"},
+		}
+
+		creationRequest := delphi.SolonCreationRequest{Role: "api", Access: []string{"dictionary"}, PodName: podName, Username: username}
+		jsonBody, err := creationRequest.Marshal()
+		assert.Nil(t, err)
+
+		router := InitRoutes(handler)
+		return performPostRequest(router, "/solon/v1/register", bytes.NewReader(jsonBody)), backend
+	}
+
+	registered := func(t *testing.T, backend *MemoryBackend) *Registration {
+		sut := &SolonHandler{Vault: backend}
+		registration, err := sut.readRegistration(refOf(ns, podName).secretName())
+		assert.Nil(t, err)
+		assert.NotNil(t, registration)
+		return registration
+	}
+
+	t.Run("AssignedWhenNotAsked", func(t *testing.T) {
+		response, backend := register(t, "", nil)
+		assert.Equal(t, http.StatusCreated, response.Code)
+		registration := registered(t, backend)
+		assert.Equal(t, "sokratesabcde", registration.Username)
+		assert.False(t, registration.SharedUsername)
+	})
+
+	t.Run("OnTheSharedList", func(t *testing.T) {
+		response, backend := register(t, "agreus", nil)
+		assert.Equal(t, http.StatusCreated, response.Code)
+		registration := registered(t, backend)
+		assert.Equal(t, "agreus", registration.Username)
+		assert.True(t, registration.SharedUsername)
+	})
+
+	t.Run("DeclaredInTheAnnotation", func(t *testing.T) {
+		response, backend := register(t, "herodotos", map[string]string{DefaultUsernameAnnotation: "herodotos"})
+		assert.Equal(t, http.StatusCreated, response.Code)
+		registration := registered(t, backend)
+		assert.Equal(t, "herodotos", registration.Username)
+		assert.True(t, registration.SharedUsername)
+	})
+
+	t.Run("UsernameOfAnotherPod", func(t *testing.T) {
+		response, backend := register(t, "herodotosfghij", map[string]string{DefaultUsernameAnnotation: "herodotos"})
+
+		var sut delphi.SolonError
+		err := json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusForbidden, response.Code)
+		assert.Equal(t, delphi.ErrorCodeAnnotationMismatch, sut.Code)
+		assert.Equal(t, "username", sut.Field)
+
+		secret, err := backend.GetSecret(refOf(ns, podName).secretName())
+		assert.Nil(t, err)
+		assert.Nil(t, secret, "nothing is registered under a username the pod may not use")
+	})
+}
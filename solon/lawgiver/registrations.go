@@ -0,0 +1,284 @@
+package lawgiver
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/hashicorp/vault/api"
+	plato "github.com/odysseia-greek/agora/plato/config"
+	"github.com/odysseia-greek/agora/plato/middleware"
+	delphi "github.com/odysseia-greek/delphi/solon/models"
+	"net/http"
+	"slices"
+)
+
+// ListRegistrations shows every pod solon keeps a secret for in the namespaces it serves, only admins can read it
+func (s *SolonHandler) ListRegistrations(w http.ResponseWriter, req *http.Request) {
+	requestId := req.Header.Get(plato.HeaderKey)
+	w.Header().Set(plato.HeaderKey, requestId)
+
+	admin, err := s.requireAdmin(req)
+	if err != nil {
+		s.audit(AuditActionRegistrationRead, AuditDecisionDenied, podRef{}, requestId, err.Error())
+		s.respondWithError(w, requestId, err)
+		return
+	}
+
+	list, err := s.registrationList()
+	if err != nil {
+		s.respondWithError(w, requestId, err)
+		return
+	}
+
+	s.audit(AuditActionRegistrationRead, AuditDecisionAllowed, podRef{}, requestId, fmt.Sprintf("%s listed %d registrations", admin, len(list.Registrations)))
+	middleware.ResponseWithCustomCode(w, http.StatusOK, list)
+}
+
+// GetRegistration shows the registration of a single pod, only admins can read it
+func (s *SolonHandler) GetRegistration(w http.ResponseWriter, req *http.Request) {
+	requestId := req.Header.Get(plato.HeaderKey)
+	w.Header().Set(plato.HeaderKey, requestId)
+
+	vars := mux.Vars(req)
+	requested := refOf(vars["namespace"], vars["podName"])
+
+	admin, err := s.requireAdmin(req)
+	if err != nil {
+		s.audit(AuditActionRegistrationRead, AuditDecisionDenied, requested, requestId, err.Error())
+		s.respondWithError(w, requestId, err)
+		return
+	}
+
+	detail, err := s.registrationDetail(requested)
+	if err != nil {
+		s.respondWithError(w, requestId, err)
+		return
+	}
+
+	s.audit(AuditActionRegistrationRead, AuditDecisionAllowed, requested, requestId, fmt.Sprintf("read by %s", admin))
+	middleware.ResponseWithCustomCode(w, http.StatusOK, detail)
+}
+
+// requireAdmin returns the username of the calling admin, any other caller is refused
+func (s *SolonHandler) requireAdmin(req *http.Request) (string, error) {
+	pod, admin, err := s.identifyPodOrAdmin(req)
+	if err != nil {
+		return "", err
+	}
+
+	if admin == "" {
+		return "", newSolonError(delphi.ErrorCodeAdminRequired, "authorization", fmt.Errorf("%s is not an admin", refOf(pod.Namespace, pod.Name)))
+	}
+
+	return admin, nil
+}
+
+func (s *SolonHandler) registrationList() (*delphi.RegistrationList, error) {
+	refs, err := s.listRegistrations()
+	if err != nil {
+		return nil, newSolonError(delphi.ErrorCodeVaultSecretFailed, "secrets", err)
+	}
+
+	list := delphi.RegistrationList{Registrations: []delphi.RegistrationSummary{}}
+
+	counts, err := s.tokenIssueCounts(nil)
+	if err != nil {
+		list.Errors = append(list.Errors, fmt.Sprintf("failed to count issued tokens: %s", err.Error()))
+	}
+
+	for _, ref := range refs {
+		summary, _, err := s.registrationSummary(ref)
+		if err != nil {
+			list.Errors = append(list.Errors, fmt.Sprintf("failed to read secret %s: %s", ref.secretName(), err.Error()))
+			continue
+		}
+
+		if summary == nil {
+			continue
+		}
+
+		if counts != nil {
+			count := counts[ref.String()]
+			summary.TokensIssued = &count
+		}
+
+		list.Registrations = append(list.Registrations, *summary)
+	}
+
+	return &list, nil
+}
+
+// registrationDetail reads the secret of a single pod, the listing tells if it is a legacy secret at the root of the mount
+func (s *SolonHandler) registrationDetail(requested podRef) (*delphi.RegistrationDetail, error) {
+	if !s.serves(requested.Namespace) {
+		return nil, newSolonError(delphi.ErrorCodeInvalidRequest, "namespace", fmt.Errorf("namespace %s is not served", requested.Namespace))
+	}
+
+	refs, err := s.listRegistrations()
+	if err != nil {
+		return nil, newSolonError(delphi.ErrorCodeVaultSecretFailed, "secrets", err)
+	}
+
+	index := slices.IndexFunc(refs, func(ref podRef) bool {
+		return ref.Namespace == requested.Namespace && ref.Name == requested.Name
+	})
+	if index == -1 {
+		return nil, newSolonError(delphi.ErrorCodeRegistrationNotFound, "podName", fmt.Errorf("%s has no registration", requested))
+	}
+
+	ref := refs[index]
+	summary, data, err := s.registrationSummary(ref)
+	if err != nil {
+		return nil, newSolonError(delphi.ErrorCodeVaultSecretFailed, "secret", err)
+	}
+
+	if summary == nil {
+		return nil, newSolonError(delphi.ErrorCodeRegistrationNotFound, "podName", fmt.Errorf("%s has no registration", requested))
+	}
+
+	detail := delphi.RegistrationDetail{
+		RegistrationSummary: *summary,
+		Policy:              ref.policyName(),
+		LeaseExpiresAt:      data.LeaseExpiresAt,
+	}
+
+	if registration := data.Registration; registration != nil {
+		detail.PodUID = registration.PodUID
+		detail.SharedUsername = registration.SharedUsername
+		for _, lease := range registration.Leases {
+			detail.Leases = append(detail.Leases, delphi.LeaseDetail{Username: lease.Username, ExpiresAt: lease.ExpiresAt, Revoked: lease.Revoked})
+		}
+	}
+
+	detail.Live, err = s.isLivePod(ref)
+	if err != nil {
+		detail.Errors = append(detail.Errors, fmt.Sprintf("failed to look up pod: %s", err.Error()))
+	}
+
+	counts, err := s.tokenIssueCounts(&ref)
+	if err != nil {
+		detail.Errors = append(detail.Errors, fmt.Sprintf("failed to count issued tokens: %s", err.Error()))
+	} else if counts != nil {
+		count := counts[ref.String()]
+		detail.TokensIssued = &count
+	}
+
+	return &detail, nil
+}
+
+// registrationSummary reads the secret of a pod once for both the data and its version, nil when there is no secret
+func (s *SolonHandler) registrationSummary(ref podRef) (*delphi.RegistrationSummary, *registrationData, error) {
+	var secret *api.Secret
+	err := s.Metrics.timeVault("get_secret", func() error {
+		var err error
+		secret, err = s.Vault.GetSecret(ref.secretName())
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := parseRegistrationData(secret)
+	if err != nil || data == nil {
+		return nil, nil, err
+	}
+
+	version, err := versionOf(ref.secretName(), secret)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	summary := delphi.RegistrationSummary{
+		PodName:       ref.Name,
+		Namespace:     ref.Namespace,
+		Username:      data.Username,
+		SecretVersion: version,
+	}
+
+	if registration := data.Registration; registration != nil {
+		summary.Roles = registration.Roles
+		if !registration.CreatedAt.IsZero() {
+			createdAt := registration.CreatedAt
+			summary.CreatedAt = &createdAt
+		}
+	}
+
+	return &summary, data, nil
+}
+
+// tokenIssueCounts counts the tokens issued per pod from the audit events stored in elastic, keyed by namespace/pod.
+// The counts are nil when audit events are not written to elastic
+func (s *SolonHandler) tokenIssueCounts(pod *podRef) (map[string]int64, error) {
+	index, ok := s.Audit.elasticIndex()
+	if !ok {
+		return nil, nil
+	}
+
+	filters := []map[string]interface{}{
+		{"term": map[string]interface{}{"action.keyword": AuditActionTokenIssue}},
+		{"term": map[string]interface{}{"decision.keyword": AuditDecisionAllowed}},
+	}
+
+	if pod != nil {
+		filters = append(filters,
+			map[string]interface{}{"term": map[string]interface{}{"namespace.keyword": pod.Namespace}},
+			map[string]interface{}{"term": map[string]interface{}{"pod.keyword": pod.Name}},
+		)
+	}
+
+	request := map[string]interface{}{
+		"size": 0,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{"filter": filters},
+		},
+		"aggs": map[string]interface{}{
+			"namespaces": map[string]interface{}{
+				"terms": map[string]interface{}{"field": "namespace.keyword", "size": 1000},
+				"aggs": map[string]interface{}{
+					"pods": map[string]interface{}{
+						"terms": map[string]interface{}{"field": "pod.keyword", "size": 10000},
+					},
+				},
+			},
+		},
+	}
+
+	var body []byte
+	err := s.Metrics.timeElastic("count_tokens", func() error {
+		var err error
+		body, err = s.Elastic.Query().MatchRaw(index, request)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Aggregations struct {
+			Namespaces struct {
+				Buckets []struct {
+					Key  string `json:"key"`
+					Pods struct {
+						Buckets []struct {
+							Key      string `json:"key"`
+							DocCount int64  `json:"doc_count"`
+						} `json:"buckets"`
+					} `json:"pods"`
+				} `json:"buckets"`
+			} `json:"namespaces"`
+		} `json:"aggregations"`
+	}
+	err = json.Unmarshal(body, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64)
+	for _, ns := range response.Aggregations.Namespaces.Buckets {
+		for _, p := range ns.Pods.Buckets {
+			counts[refOf(ns.Key, p.Key).String()] = p.DocCount
+		}
+	}
+
+	return counts, nil
+}
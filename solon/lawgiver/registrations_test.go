@@ -0,0 +1,148 @@
+package lawgiver
+
+import (
+	"encoding/json"
+	elastic "github.com/odysseia-greek/agora/aristoteles"
+	delphi "github.com/odysseia-greek/delphi/solon/models"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRegistrations(t *testing.T) {
+	ns := "odysseia"
+	podName := "sokrates-5d8f7c9b4-abcde"
+	legacyPod := "herodotos-7c9b4d8f5-fghij"
+	admin := "system:serviceaccount:odysseia:periandros-admin"
+	createdAt := time.Date(2024, 11, 2, 10, 15, 0, 0, time.UTC)
+
+	counts := `{"aggregations":{"namespaces":{"buckets":[{"key":"odysseia","pods":{"buckets":[{"key":"sokrates-5d8f7c9b4-abcde","doc_count":12}]}}]}}}`
+
+	newTestHandler := func(t *testing.T) (*SolonHandler, *memorySink) {
+		pods := newTestPodCache()
+		err := addBoundPodForTest(podName, ns, "dictionary", "api", "sokrates", "uid-1", pods)
+		assert.Nil(t, err)
+
+		mockElasticClient, err := elastic.NewMockClient([][]byte{[]byte(counts)}, 200)
+		assert.Nil(t, err)
+		auditElasticClient, err := elastic.NewMockClient([][]byte{[]byte(`{"result":"created"}`)}, 200)
+		assert.Nil(t, err)
+
+		vault := &fakeVault{
+			secrets: map[string]map[string]interface{}{
+				refOf(ns, podName).secretName(): {
+					"elasticUsername": "sokratesabcde",
+					"elasticPassword": "secret",
+					"registration": map[string]interface{}{
+						"podName":   podName,
+						"podUid":    "uid-1",
+						"username":  "sokratesabcde",
+						"roles":     []interface{}{"dictionary_api"},
+						"createdAt": createdAt.Format(time.RFC3339),
+					},
+				},
+				legacyPod: {
+					"elasticUsername": "herodotosfghij",
+					"elasticPassword": "secret",
+				},
+			},
+			versions: map[string]int{refOf(ns, podName).secretName(): 3, legacyPod: 1},
+		}
+
+		sink := &memorySink{}
+		return &SolonHandler{
+			Vault:         vault,
+			Elastic:       mockElasticClient,
+			Pods:          pods,
+			AuthMode:      AuthModeServiceAccount,
+			TokenReviewer: fakeTokenReviewer(true, admin, "", ""),
+			Admins:        []string{admin},
+			Namespace:     ns,
+			Audit:         NewAuditor(sink, NewElasticSink(auditElasticClient, defaultAuditIndex)),
+		}, sink
+	}
+
+	t.Run("AdminListsRegistrations", func(t *testing.T) {
+		handler, sink := newTestHandler(t)
+
+		router := InitRoutes(handler)
+		response := performGetRequestWithToken(router, "/solon/v1/registrations", "admin-token")
+		assert.Equal(t, http.StatusOK, response.Code)
+
+		var sut delphi.RegistrationList
+		err := json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+		assert.Empty(t, sut.Errors)
+		assert.Len(t, sut.Registrations, 2)
+
+		for _, registration := range sut.Registrations {
+			switch registration.PodName {
+			case podName:
+				assert.Equal(t, 3, registration.SecretVersion)
+				assert.Equal(t, []string{"dictionary_api"}, registration.Roles)
+				assert.Equal(t, createdAt, *registration.CreatedAt)
+				assert.Equal(t, int64(12), *registration.TokensIssued)
+			case legacyPod:
+				assert.Equal(t, ns, registration.Namespace)
+				assert.Nil(t, registration.CreatedAt)
+				assert.Equal(t, int64(0), *registration.TokensIssued)
+			}
+		}
+
+		handler.Audit.Close()
+		assert.Equal(t, AuditActionRegistrationRead, sink.events[0].Action)
+		assert.Equal(t, AuditDecisionAllowed, sink.events[0].Decision)
+	})
+
+	t.Run("AdminReadsASinglePod", func(t *testing.T) {
+		handler, _ := newTestHandler(t)
+
+		router := InitRoutes(handler)
+		response := performGetRequestWithToken(router, "/solon/v1/registrations/odysseia/"+podName, "admin-token")
+		assert.Equal(t, http.StatusOK, response.Code)
+
+		var sut delphi.RegistrationDetail
+		err := json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+		assert.True(t, sut.Live)
+		assert.Equal(t, "uid-1", sut.PodUID)
+		assert.Equal(t, refOf(ns, podName).policyName(), sut.Policy)
+		assert.Equal(t, int64(12), *sut.TokensIssued)
+	})
+
+	t.Run("LegacySecretIsFound", func(t *testing.T) {
+		handler, _ := newTestHandler(t)
+		handler.Audit = nil
+
+		sut, err := handler.registrationDetail(refOf(ns, legacyPod))
+		assert.Nil(t, err)
+		assert.Equal(t, "policy-"+legacyPod, sut.Policy)
+		assert.False(t, sut.Live)
+		assert.Nil(t, sut.TokensIssued)
+	})
+
+	t.Run("UnknownPodIsNotFound", func(t *testing.T) {
+		handler, _ := newTestHandler(t)
+
+		router := InitRoutes(handler)
+		response := performGetRequestWithToken(router, "/solon/v1/registrations/odysseia/alexandros-79bbf86f4b-s48lc", "admin-token")
+		assert.Equal(t, http.StatusNotFound, response.Code)
+	})
+
+	t.Run("PodsCannotReadRegistrations", func(t *testing.T) {
+		handler, sink := newTestHandler(t)
+		handler.TokenReviewer = fakeTokenReviewer(true, "system:serviceaccount:odysseia:sokrates", podName, "uid-1")
+
+		router := InitRoutes(handler)
+		response := performGetRequestWithToken(router, "/solon/v1/registrations", "pod-token")
+		assert.Equal(t, http.StatusForbidden, response.Code)
+
+		var sut delphi.SolonError
+		err := json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+		assert.Equal(t, delphi.ErrorCodeAdminRequired, sut.Code)
+		handler.Audit.Close()
+		assert.Equal(t, AuditDecisionDenied, sink.events[0].Decision)
+	})
+}
@@ -0,0 +1,188 @@
+package lawgiver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	plato "github.com/odysseia-greek/agora/plato/config"
+	"github.com/odysseia-greek/agora/plato/generator"
+	"github.com/odysseia-greek/agora/plato/middleware"
+	delphi "github.com/odysseia-greek/delphi/solon/models"
+	"io"
+	v1 "k8s.io/api/core/v1"
+	"net/http"
+	"time"
+)
+
+// stepRotatePassword is the saga step that sets the new password on the elastic user of a pod
+const stepRotatePassword string = "rotatePassword"
+
+// RotateCredentials replaces the elastic password of a running pod and returns the vault version holding it,
+// a pod can only rotate its own credentials while an admin can name any pod in a served namespace
+func (s *SolonHandler) RotateCredentials(w http.ResponseWriter, req *http.Request) {
+	requestId := req.Header.Get(plato.HeaderKey)
+	w.Header().Set(plato.HeaderKey, requestId)
+
+	var rotateRequest delphi.RotateRequest
+	if err := json.NewDecoder(req.Body).Decode(&rotateRequest); err != nil && !errors.Is(err, io.EOF) {
+		s.respondWithError(w, requestId, newSolonError(delphi.ErrorCodeInvalidRequest, "decoding", err))
+		return
+	}
+
+	requested := podRef{Namespace: rotateRequest.Namespace, Name: rotateRequest.PodName}
+
+	pod, admin, err := s.identifyPodOrAdmin(req)
+	if err != nil {
+		s.audit(AuditActionRotate, AuditDecisionDenied, requested, requestId, err.Error())
+		s.respondWithError(w, requestId, err)
+		return
+	}
+
+	target, err := s.rotationTarget(pod, admin, rotateRequest)
+	if err != nil {
+		action := AuditActionRotate
+		var solonErr *solonError
+		if errors.As(err, &solonErr) && solonErr.Code == delphi.ErrorCodePodNameMismatch {
+			action = AuditActionImpersonation
+		}
+		s.audit(action, AuditDecisionDenied, requested, requestId, err.Error())
+		s.respondWithError(w, requestId, err)
+		return
+	}
+
+	response, err := s.rotateCredentials(target, time.Now().UTC())
+	if err != nil {
+		s.audit(AuditActionRotate, AuditDecisionFailed, target, requestId, err.Error())
+		s.respondWithError(w, requestId, err)
+		return
+	}
+
+	reason := fmt.Sprintf("rotated credentials of %s to version %d", response.Username, response.Version)
+	if admin != "" {
+		reason = fmt.Sprintf("%s on behalf of %s", reason, admin)
+	}
+	s.audit(AuditActionRotate, AuditDecisionAllowed, target, requestId, reason)
+
+	middleware.ResponseWithCustomCode(w, http.StatusOK, response)
+}
+
+// rotationTarget decides whose credentials are rotated, a pod naming another pod is treated as impersonation
+func (s *SolonHandler) rotationTarget(pod *v1.Pod, admin string, rotateRequest delphi.RotateRequest) (podRef, error) {
+	if admin == "" {
+		if (rotateRequest.PodName != "" && rotateRequest.PodName != pod.Name) || (rotateRequest.Namespace != "" && rotateRequest.Namespace != pod.Namespace) {
+			err := fmt.Errorf("illegal action detected: %s requested rotation of %s", pod.Name, rotateRequest.PodName)
+			return podRef{}, newSolonError(delphi.ErrorCodePodNameMismatch, "rotateRequest.PodName", err)
+		}
+
+		return refOf(pod.Namespace, pod.Name), nil
+	}
+
+	if rotateRequest.PodName == "" {
+		return podRef{}, newSolonError(delphi.ErrorCodeInvalidRequest, "rotateRequest.PodName", fmt.Errorf("%s has to name the pod to rotate", admin))
+	}
+
+	ns := rotateRequest.Namespace
+	if ns == "" {
+		ns = s.Namespace
+	}
+
+	if !s.serves(ns) {
+		return podRef{}, newSolonError(delphi.ErrorCodeInvalidRequest, "rotateRequest.Namespace", fmt.Errorf("namespace %s is not served", ns))
+	}
+
+	target, err := s.Pods.ByName(ns, rotateRequest.PodName)
+	if err != nil {
+		return podRef{}, podLookupError(err)
+	}
+
+	if target == nil {
+		return podRef{}, newSolonError(delphi.ErrorCodePodNotFound, "rotateRequest.PodName", fmt.Errorf("pod %s/%s could not be found", ns, rotateRequest.PodName))
+	}
+
+	return refOf(ns, target.Name), nil
+}
+
+// rotateCredentials hands the pod a new password, with leases a new user is issued and the old one is revoked
+// once its lease runs out, without leases the password of the existing user is replaced
+func (s *SolonHandler) rotateCredentials(pod podRef, now time.Time) (*delphi.RotateResponse, error) {
+	data, err := s.readRegistrationData(pod.secretName())
+	if err != nil {
+		return nil, newSolonError(delphi.ErrorCodeVaultSecretFailed, "secret", err)
+	}
+
+	if data == nil || data.Registration == nil {
+		return nil, newSolonError(delphi.ErrorCodeRegistrationNotFound, "secret", fmt.Errorf("%s has no registration to rotate", pod))
+	}
+
+	if data.Registration.SharedUsername {
+		return nil, newSolonError(delphi.ErrorCodeRegistrationConflict, "username", fmt.Errorf("%s is shared between pods and cannot be rotated for %s alone", data.Registration.Username, pod))
+	}
+
+	if s.Leases != nil {
+		// a user from before leases were enabled becomes a lease of its own so it is revoked like any other
+		if len(data.Registration.Leases) == 0 {
+			data.Registration.Leases = []Lease{{Username: data.Username, ExpiresAt: now.Add(s.Leases.RenewBefore)}}
+		}
+
+		_, err = s.issueLease(pod, data, now)
+	} else {
+		err = s.rotatePassword(pod, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := s.secretVersion(pod.secretName())
+	if err != nil {
+		return nil, newSolonError(delphi.ErrorCodeVaultSecretFailed, "secret", err)
+	}
+
+	return &delphi.RotateResponse{
+		PodName:        pod.Name,
+		Namespace:      pod.Namespace,
+		Username:       data.Username,
+		Version:        version,
+		LeaseExpiresAt: data.LeaseExpiresAt,
+	}, nil
+}
+
+// rotatePassword replaces the password of the user in place. The secret is written first so a failing
+// provider update can put the old password back, once the provider has the new password the old one stops working
+func (s *SolonHandler) rotatePassword(pod podRef, data *registrationData) error {
+	rotation := newSaga(pod.Name)
+
+	var password string
+	err := rotation.run(stepGeneratePassword, delphi.ErrorCodePasswordGenerationFailed, func() error {
+		var err error
+		password, err = generator.RandomPassword(18)
+		return err
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	provider, err := s.providerOfRegistration(data)
+	if err != nil {
+		return err
+	}
+
+	previous := *data
+	data.Password = password
+
+	err = rotation.run(stepCreateSecret, delphi.ErrorCodeVaultSecretFailed, func() error {
+		return s.writeRegistrationData(pod.secretName(), data)
+	}, func() error {
+		return s.writeRegistrationData(pod.secretName(), &previous)
+	})
+	if err != nil {
+		return err
+	}
+
+	registration := data.Registration
+	return rotation.run(stepRotatePassword, userFailedCode(provider), func() error {
+		return s.Metrics.timeProvider(provider.Name(), "update_user", func() error {
+			_, err := provider.CreateUser(Credential{Username: data.Username, Password: password, Roles: registration.Roles, Owner: registration.Username})
+			return err
+		})
+	}, nil)
+}
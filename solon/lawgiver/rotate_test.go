@@ -0,0 +1,162 @@
+package lawgiver
+
+import (
+	"bytes"
+	"encoding/json"
+	elastic "github.com/odysseia-greek/agora/aristoteles"
+	delphi "github.com/odysseia-greek/delphi/solon/models"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRotate(t *testing.T) {
+	ns := "test"
+	podName := "sokrates-5d8f7c9b4-abcde"
+	secretName := refOf(ns, podName).secretName()
+	admin := "system:serviceaccount:odysseia:periandros-admin"
+
+	registered := func() map[string]interface{} {
+		return map[string]interface{}{
+			"elasticUsername": "sokratesabcde",
+			"elasticPassword": "oldpassword",
+			"registration": map[string]interface{}{
+				"podName":  podName,
+				"username": "sokratesabcde",
+				"roles":    []interface{}{"dictionary_api"},
+			},
+		}
+	}
+
+	newTestHandler := func(t *testing.T, vault *fakeVault, fixture string) *SolonHandler {
+		pods := newTestPodCache()
+		err := addBoundPodForTest(podName, ns, "dictionary", "api", "sokrates", "uid-1", pods)
+		assert.Nil(t, err)
+
+		mockElasticClient, err := elastic.NewMockClient([][]byte{[]byte(fixture)}, 200)
+		assert.Nil(t, err)
+
+		return &SolonHandler{
+			Vault:            vault,
+			Elastic:          mockElasticClient,
+			Pods:             pods,
+			AuthMode:         AuthModeIP,
+			Namespace:        ns,
+			AccessAnnotation: "odysseia-greek/access",
+			RoleAnnotation:   "odysseia-greek/role",
+		}
+	}
+
+	t.Run("PodRotatesItsOwnPassword", func(t *testing.T) {
+		vault := &fakeVault{secrets: map[string]map[string]interface{}{secretName: registered()}, versions: map[string]int{secretName: 1}}
+		handler := newTestHandler(t, vault, `{"created":false}`)
+
+		router := InitRoutes(handler)
+		response := performPostRequest(router, "/solon/v1/rotate", bytes.NewReader(nil))
+		assert.Equal(t, http.StatusOK, response.Code)
+
+		var sut delphi.RotateResponse
+		err := json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, sut.Version)
+		assert.Equal(t, "sokratesabcde", sut.Username)
+		assert.Equal(t, ns, sut.Namespace)
+
+		data, err := handler.readRegistrationData(secretName)
+		assert.Nil(t, err)
+		assert.NotEqual(t, "oldpassword", data.Password)
+	})
+
+	t.Run("LeasesIssueANewUser", func(t *testing.T) {
+		vault := &fakeVault{secrets: map[string]map[string]interface{}{secretName: registered()}}
+		handler := newTestHandler(t, vault, `{"created":true}`)
+		handler.Leases = NewLeaseManager(3 * time.Hour)
+
+		sut, err := handler.rotateCredentials(refOf(ns, podName), time.Unix(1730548800, 0).UTC())
+		assert.Nil(t, err)
+		assert.Equal(t, "sokratesabcde_1730548800000000000", sut.Username)
+		assert.Equal(t, 1, sut.Version)
+
+		data, err := handler.readRegistrationData(secretName)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"sokratesabcde", "sokratesabcde_1730548800000000000"}, data.ownedUsernames(podName))
+	})
+
+	t.Run("FailedElasticUpdateRestoresTheSecret", func(t *testing.T) {
+		vault := &fakeVault{secrets: map[string]map[string]interface{}{secretName: registered()}}
+		handler := newTestHandler(t, vault, `{"error":"unavailable"}`)
+		mockElasticClient, err := elastic.NewMockClient([][]byte{[]byte(`{"error":"unavailable"}`)}, 500)
+		assert.Nil(t, err)
+		handler.Elastic = mockElasticClient
+
+		_, err = handler.rotateCredentials(refOf(ns, podName), time.Now())
+		assert.NotNil(t, err)
+
+		data, err := handler.readRegistrationData(secretName)
+		assert.Nil(t, err)
+		assert.Equal(t, "oldpassword", data.Password)
+	})
+
+	t.Run("SharedUserCannotBeRotated", func(t *testing.T) {
+		secret := registered()
+		secret["registration"].(map[string]interface{})["sharedUsername"] = true
+		vault := &fakeVault{secrets: map[string]map[string]interface{}{secretName: secret}}
+		handler := newTestHandler(t, vault, `{}`)
+
+		router := InitRoutes(handler)
+		response := performPostRequest(router, "/solon/v1/rotate", bytes.NewReader(nil))
+		assert.Equal(t, http.StatusConflict, response.Code)
+	})
+
+	t.Run("PodCannotRotateAnotherPod", func(t *testing.T) {
+		sink := &memorySink{}
+		vault := &fakeVault{secrets: map[string]map[string]interface{}{secretName: registered()}}
+		handler := newTestHandler(t, vault, `{}`)
+		handler.Audit = NewAuditor(sink)
+
+		body, err := (&delphi.RotateRequest{PodName: "herodotos-7c9b4d8f5-fghij"}).Marshal()
+		assert.Nil(t, err)
+
+		router := InitRoutes(handler)
+		response := performPostRequest(router, "/solon/v1/rotate", bytes.NewReader(body))
+		assert.Equal(t, http.StatusForbidden, response.Code)
+		handler.Audit.Close()
+		assert.Equal(t, AuditActionImpersonation, sink.events[0].Action)
+	})
+
+	t.Run("AdminRotatesAnyPod", func(t *testing.T) {
+		vault := &fakeVault{secrets: map[string]map[string]interface{}{secretName: registered()}}
+		handler := newTestHandler(t, vault, `{"created":false}`)
+		handler.AuthMode = AuthModeServiceAccount
+		handler.Admins = []string{admin}
+		handler.TokenReviewer = fakeTokenReviewer(true, admin, "", "")
+
+		body, err := (&delphi.RotateRequest{PodName: podName}).Marshal()
+		assert.Nil(t, err)
+
+		router := InitRoutes(handler)
+		response := performPostRequestWithToken(router, "/solon/v1/rotate", "admin-token", bytes.NewReader(body))
+		assert.Equal(t, http.StatusOK, response.Code)
+	})
+
+	t.Run("AdminMustNameAPod", func(t *testing.T) {
+		handler := newTestHandler(t, &fakeVault{}, `{}`)
+		handler.AuthMode = AuthModeServiceAccount
+		handler.Admins = []string{admin}
+		handler.TokenReviewer = fakeTokenReviewer(true, admin, "", "")
+
+		router := InitRoutes(handler)
+		response := performPostRequestWithToken(router, "/solon/v1/rotate", "admin-token", bytes.NewReader(nil))
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+	})
+
+	t.Run("AdminServiceAccountsFromEnv", func(t *testing.T) {
+		admins, err := parseAdminServiceAccounts("odysseia:periandros-admin, ops:rotator")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{admin, "system:serviceaccount:ops:rotator"}, admins)
+
+		_, err = parseAdminServiceAccounts("periandros-admin")
+		assert.NotNil(t, err)
+	})
+}
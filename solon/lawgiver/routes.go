@@ -3,16 +3,89 @@ package lawgiver
 import (
 	"github.com/gorilla/mux"
 	"github.com/odysseia-greek/agora/plato/middleware"
-	"github.com/odysseia-greek/attike/aristophanes/comedy"
+	platomodels "github.com/odysseia-greek/agora/plato/models"
+	"github.com/odysseia-greek/delphi/solon/docs"
+	delphi "github.com/odysseia-greek/delphi/solon/models"
+	"net/http"
 )
 
+// route is a single endpoint, the router and the openapi spec are both built from the same routes
+type route struct {
+	docs.Operation
+	handler http.HandlerFunc
+	// adapters wrap the handler after the method and body are validated, the last one runs first
+	adapters []middleware.Adapter
+}
+
+func (s *SolonHandler) routes() []route {
+	return []route{
+		{
+			Operation: docs.Operation{Path: "/solon/v1/health", Method: http.MethodGet, OperationID: "health", Tag: docs.TagStatus, Summary: "Health of solon and every dependency it uses", Response: delphi.HealthReport{}},
+			handler:   s.Health,
+			adapters:  []middleware.Adapter{s.Metrics.Instrument("health")},
+		},
+		{
+			Operation: docs.Operation{Path: "/solon/v1/ready", Method: http.MethodGet, OperationID: "ready", Tag: docs.TagStatus, Summary: "Whether solon can serve requests", Response: delphi.ReadyResponse{}},
+			handler:   s.Ready,
+			adapters:  []middleware.Adapter{s.Metrics.Instrument("ready")},
+		},
+		{
+			Operation: docs.Operation{Path: "/solon/v1/metrics", Method: http.MethodGet, OperationID: "metrics", Tag: docs.TagStatus, Summary: "Prometheus metrics", ContentType: docs.ContentTypeText},
+			handler:   s.ServeMetrics,
+		},
+		{
+			Operation: docs.Operation{Path: "/solon/v1/openapi.json", Method: http.MethodGet, OperationID: "openapi", Tag: docs.TagStatus, Summary: "This document"},
+			handler:   s.ServeOpenAPI,
+		},
+		{
+			Operation: docs.Operation{Path: "/solon/v1/reconcile", Method: http.MethodGet, OperationID: "reconcile", Tag: docs.TagAdmin, Summary: "Report of the last reconciliation run", Response: delphi.ReconcileReport{}, Authenticated: true},
+			handler:   s.ReconcileReport,
+			adapters:  []middleware.Adapter{s.Metrics.Instrument("reconcile")},
+		},
+		{
+			Operation: docs.Operation{Path: "/solon/v1/token", Method: http.MethodGet, OperationID: "createToken", Tag: docs.TagService, Summary: "One time vault token for the calling pod", Query: tokenQuery, Response: delphi.TokenResponse{}, Authenticated: true},
+			handler:   s.CreateOneTimeToken,
+			adapters:  []middleware.Adapter{s.tracer().Middleware(), s.Metrics.Instrument("token")},
+		},
+		{
+			Operation: docs.Operation{Path: "/solon/v1/rotate", Method: http.MethodPost, OperationID: "rotateCredentials", Tag: docs.TagService, Summary: "Rotate the elastic credentials of a pod, an empty body rotates the calling pod", Request: delphi.RotateRequest{}, Response: delphi.RotateResponse{}, Authenticated: true},
+			handler:   s.RotateCredentials,
+			adapters:  []middleware.Adapter{s.Metrics.Instrument("rotate")},
+		},
+		{
+			Operation: docs.Operation{Path: "/solon/v1/registrations", Method: http.MethodGet, OperationID: "listRegistrations", Tag: docs.TagAdmin, Summary: "Every registered pod", Response: delphi.RegistrationList{}, Authenticated: true},
+			handler:   s.ListRegistrations,
+			adapters:  []middleware.Adapter{s.Metrics.Instrument("registrations")},
+		},
+		{
+			Operation: docs.Operation{Path: "/solon/v1/registrations/{namespace}/{podName}", Method: http.MethodGet, OperationID: "getRegistration", Tag: docs.TagAdmin, Summary: "Registration of a single pod", Response: delphi.RegistrationDetail{}, Authenticated: true},
+			handler:   s.GetRegistration,
+			adapters:  []middleware.Adapter{s.Metrics.Instrument("registration")},
+		},
+		{
+			Operation: docs.Operation{Path: "/solon/v1/register", Method: http.MethodPost, OperationID: "registerService", Tag: docs.TagService, Summary: "Create an elastic user and vault secret for the calling pod", Request: delphi.SolonCreationRequest{}, RequestRequired: true, Response: platomodels.SolonResponse{}, Authenticated: true},
+			handler:   s.RegisterService,
+			adapters:  []middleware.Adapter{middleware.LogRequestDetails(), s.Metrics.Instrument("register")},
+		},
+	}
+}
+
 // InitRoutes to start up a mux router and return the routes
 func InitRoutes(solonHandler *SolonHandler) *mux.Router {
 	serveMux := mux.NewRouter()
 
-	serveMux.HandleFunc("/solon/v1/health", middleware.Adapt(solonHandler.Health, middleware.ValidateRestMethod("GET")))
-	serveMux.HandleFunc("/solon/v1/token", middleware.Adapt(solonHandler.CreateOneTimeToken, middleware.ValidateRestMethod("GET"), middleware.Adapter(comedy.TraceWithLogAndSpan(solonHandler.Streamer))))
-	serveMux.HandleFunc("/solon/v1/register", middleware.Adapt(solonHandler.RegisterService, middleware.ValidateRestMethod("POST"), middleware.LogRequestDetails()))
+	routes := solonHandler.routes()
+	operations := make([]docs.Operation, 0, len(routes))
+	for _, r := range routes {
+		operations = append(operations, r.Operation)
+	}
+
+	solonHandler.spec = newOpenAPISpec(operations)
+
+	for _, r := range routes {
+		adapters := []middleware.Adapter{solonHandler.validateBody(r.Operation), middleware.ValidateRestMethod(r.Method)}
+		serveMux.HandleFunc(r.Path, middleware.Adapt(r.handler, append(adapters, r.adapters...)...))
+	}
 
 	return serveMux
 }
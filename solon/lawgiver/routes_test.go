@@ -2,9 +2,11 @@ package lawgiver
 
 import (
 	"bytes"
-	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	uuid2 "github.com/google/uuid"
+	"github.com/hashicorp/vault/api"
 	elastic "github.com/odysseia-greek/agora/aristoteles"
 	vault "github.com/odysseia-greek/agora/diogenes"
 	"github.com/odysseia-greek/agora/plato/models"
@@ -13,32 +15,39 @@ import (
 	delphi "github.com/odysseia-greek/delphi/solon/models"
 	"github.com/stretchr/testify/assert"
 	"io"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	authv1 "k8s.io/api/authentication/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	authenticationv1 "k8s.io/client-go/kubernetes/typed/authentication/v1"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
-	"time"
 )
 
+const testPodIP = "10.42.0.17"
+
 func TestHealth(t *testing.T) {
 	t.Run("HappyPath", func(t *testing.T) {
 		fixtureFile := "info"
 		mockCode := 200
 		mockElasticClient, err := elastic.NewMockClient(fixtureFile, mockCode)
 		assert.Nil(t, err)
-		vaultFixtures := []string{"health"}
-		mockVaultClient, err := vault.CreateMockVaultClient(vaultFixtures, mockCode)
-		assert.Nil(t, err)
 
 		testConfig := &SolonHandler{
 			Elastic: mockElasticClient,
-			Vault:   mockVaultClient,
+			Vault:   NewMemoryBackend(),
 		}
 
 		router := InitRoutes(testConfig)
 		response := performGetRequest(router, "/solon/v1/health")
 
-		var healthModel models.Health
+		var healthModel delphi.HealthReport
 		err = json.NewDecoder(response.Body).Decode(&healthModel)
 		assert.Nil(t, err)
 		assert.Equal(t, http.StatusOK, response.Code)
@@ -49,10 +58,9 @@ func TestHealth(t *testing.T) {
 func TestRegister(t *testing.T) {
 	access := "everywhere"
 	creationRequest := delphi.SolonCreationRequest{
-		Role:     "theonethatquestions",
-		Access:   []string{access},
-		PodName:  "somepodname-122",
-		Username: "sokrates",
+		Role:    "theonethatquestions",
+		Access:  []string{access},
+		PodName: "somepodname-122",
 	}
 
 	ns := "test"
@@ -62,21 +70,19 @@ func TestRegister(t *testing.T) {
 		mockCode := 200
 		mockElasticClient, err := elastic.NewMockClient(fixtureFile, mockCode)
 		assert.Nil(t, err)
-		vaultFixtures := []string{"createSecret"}
-		mockVaultClient, err := vault.CreateMockVaultClient(vaultFixtures, mockCode)
-		assert.Nil(t, err)
-		mockKube := kubernetes.NewFakeKubeClient()
+		pods := newTestPodCache()
 
 		testConfig := &SolonHandler{
 			Elastic:          mockElasticClient,
-			Vault:            mockVaultClient,
-			Kube:             mockKube,
+			Vault:            NewMemoryBackend(),
+			Pods:             pods,
+			AuthMode:         AuthModeIP,
 			Namespace:        ns,
 			AccessAnnotation: "odysseia-greek/access",
 			RoleAnnotation:   "odysseia-greek/role",
 		}
 
-		err = createPodForTest(creationRequest.PodName, ns, access, creationRequest.Role, mockKube)
+		err = addPodForTest(creationRequest.PodName, ns, access, creationRequest.Role, pods)
 		assert.Nil(t, err)
 
 		jsonBody, err := creationRequest.Marshal()
@@ -93,18 +99,52 @@ func TestRegister(t *testing.T) {
 		assert.True(t, sut.SecretCreated)
 	})
 
+	t.Run("FromAnInitContainer", func(t *testing.T) {
+		mockElasticClient, err := elastic.NewMockClient("createUser", 200)
+		assert.Nil(t, err)
+		pods := newTestPodCache()
+
+		testConfig := &SolonHandler{
+			Elastic:          mockElasticClient,
+			Vault:            NewMemoryBackend(),
+			Pods:             pods,
+			AuthMode:         AuthModeIP,
+			Namespace:        ns,
+			AccessAnnotation: "odysseia-greek/access",
+			RoleAnnotation:   "odysseia-greek/role",
+		}
+
+		pod := runningPodForTest(creationRequest.PodName, ns, access, creationRequest.Role)
+		pod.Status.Phase = v1.PodPending
+		err = pods.indexer.Add(pod)
+		assert.Nil(t, err)
+
+		jsonBody, err := creationRequest.Marshal()
+		assert.Nil(t, err)
+
+		router := InitRoutes(testConfig)
+		response := performPostRequest(router, "/solon/v1/register", bytes.NewReader(jsonBody))
+
+		var sut models.SolonResponse
+		err = json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusCreated, response.Code)
+		assert.True(t, sut.SecretCreated)
+	})
+
 	t.Run("AnnotationNotOnPodRole", func(t *testing.T) {
 		fixtureFile := "createUser"
 		mockCode := 200
 		mockElasticClient, err := elastic.NewMockClient(fixtureFile, mockCode)
 		assert.Nil(t, err)
-		mockKube := kubernetes.NewFakeKubeClient()
+		pods := newTestPodCache()
 		assert.Nil(t, err)
 
 		testConfig := &SolonHandler{
 			Elastic:          mockElasticClient,
-			Vault:            nil,
-			Kube:             mockKube,
+			Vault:            NewMemoryBackend(),
+			Pods:             pods,
+			AuthMode:         AuthModeIP,
 			Namespace:        ns,
 			AccessAnnotation: "odysseia-greek/access",
 			RoleAnnotation:   "odysseia-greek/role",
@@ -112,7 +152,7 @@ func TestRegister(t *testing.T) {
 
 		differentRole := "nottheroleyouarelookingfor"
 
-		err = createPodForTest(creationRequest.PodName, ns, access, differentRole, mockKube)
+		err = addPodForTest(creationRequest.PodName, ns, access, differentRole, pods)
 		assert.Nil(t, err)
 
 		jsonBody, err := creationRequest.Marshal()
@@ -122,12 +162,13 @@ func TestRegister(t *testing.T) {
 		router := InitRoutes(testConfig)
 		response := performPostRequest(router, "/solon/v1/register", bodyInBytes)
 
-		var sut models.ValidationError
+		var sut delphi.SolonError
 		err = json.NewDecoder(response.Body).Decode(&sut)
 		assert.Nil(t, err)
-		assert.Equal(t, http.StatusBadRequest, response.Code)
-		assert.Equal(t, "annotations", sut.Messages[0].Field)
-		assert.Contains(t, sut.Messages[0].Message, creationRequest.PodName)
+		assert.Equal(t, http.StatusForbidden, response.Code)
+		assert.Equal(t, "annotations", sut.Field)
+		assert.Contains(t, sut.Message, creationRequest.PodName)
+		assert.Equal(t, delphi.ErrorCodeAnnotationMismatch, sut.Code)
 	})
 
 	t.Run("AnnotationNotOnAccess", func(t *testing.T) {
@@ -135,12 +176,13 @@ func TestRegister(t *testing.T) {
 		mockCode := 200
 		mockElasticClient, err := elastic.NewMockClient(fixtureFile, mockCode)
 		assert.Nil(t, err)
-		mockKube := kubernetes.NewFakeKubeClient()
+		pods := newTestPodCache()
 
 		testConfig := &SolonHandler{
 			Elastic:          mockElasticClient,
-			Vault:            nil,
-			Kube:             mockKube,
+			Vault:            NewMemoryBackend(),
+			Pods:             pods,
+			AuthMode:         AuthModeIP,
 			Namespace:        ns,
 			AccessAnnotation: "odysseia-greek/access",
 			RoleAnnotation:   "odysseia-greek/role",
@@ -148,7 +190,7 @@ func TestRegister(t *testing.T) {
 
 		differentAccess := "nottheroleyouarelookingfor"
 
-		err = createPodForTest(creationRequest.PodName, ns, differentAccess, creationRequest.Role, mockKube)
+		err = addPodForTest(creationRequest.PodName, ns, differentAccess, creationRequest.Role, pods)
 		assert.Nil(t, err)
 
 		jsonBody, err := creationRequest.Marshal()
@@ -158,12 +200,13 @@ func TestRegister(t *testing.T) {
 		router := InitRoutes(testConfig)
 		response := performPostRequest(router, "/solon/v1/register", bodyInBytes)
 
-		var sut models.ValidationError
+		var sut delphi.SolonError
 		err = json.NewDecoder(response.Body).Decode(&sut)
 		assert.Nil(t, err)
-		assert.Equal(t, http.StatusBadRequest, response.Code)
-		assert.Equal(t, "annotations", sut.Messages[0].Field)
-		assert.Contains(t, sut.Messages[0].Message, creationRequest.PodName)
+		assert.Equal(t, http.StatusForbidden, response.Code)
+		assert.Equal(t, "annotations", sut.Field)
+		assert.Contains(t, sut.Message, creationRequest.PodName)
+		assert.Equal(t, delphi.ErrorCodeAnnotationMismatch, sut.Code)
 	})
 
 	t.Run("UserCannotBeCreated", func(t *testing.T) {
@@ -171,18 +214,19 @@ func TestRegister(t *testing.T) {
 		mockCode := 502
 		mockElasticClient, err := elastic.NewMockClient(fixtureFile, mockCode)
 		assert.Nil(t, err)
-		mockKube := kubernetes.NewFakeKubeClient()
+		pods := newTestPodCache()
 
 		testConfig := &SolonHandler{
 			Elastic:          mockElasticClient,
-			Vault:            nil,
-			Kube:             mockKube,
+			Vault:            NewMemoryBackend(),
+			Pods:             pods,
+			AuthMode:         AuthModeIP,
 			Namespace:        ns,
 			AccessAnnotation: "odysseia-greek/access",
 			RoleAnnotation:   "odysseia-greek/role",
 		}
 
-		err = createPodForTest(creationRequest.PodName, ns, access, creationRequest.Role, mockKube)
+		err = addPodForTest(creationRequest.PodName, ns, access, creationRequest.Role, pods)
 		assert.Nil(t, err)
 
 		jsonBody, err := creationRequest.Marshal()
@@ -192,34 +236,75 @@ func TestRegister(t *testing.T) {
 		router := InitRoutes(testConfig)
 		response := performPostRequest(router, "/solon/v1/register", bodyInBytes)
 
-		var sut models.ValidationError
+		var sut delphi.SolonError
 		err = json.NewDecoder(response.Body).Decode(&sut)
 		assert.Nil(t, err)
-		assert.Equal(t, http.StatusBadRequest, response.Code)
-		assert.Equal(t, "createUser", sut.Messages[0].Field)
-		assert.Contains(t, sut.Messages[0].Message, "Bad Gateway")
+		assert.Equal(t, http.StatusInternalServerError, response.Code)
+		assert.Equal(t, "createUser", sut.Field)
+		assert.Contains(t, sut.Message, "Bad Gateway")
+		assert.Equal(t, delphi.ErrorCodeElasticUserFailed, sut.Code)
+		assert.Equal(t, stepCreateUser, sut.FailedStep)
+		assert.Empty(t, sut.RolledBack)
 	})
 
 	t.Run("VaultDown", func(t *testing.T) {
+		mockElasticClient, err := elastic.NewMockClient("createUser", 200)
+		assert.Nil(t, err)
+		pods := newTestPodCache()
+		vault := &fakeVault{failWrites: true}
+
+		testConfig := &SolonHandler{
+			Elastic:          mockElasticClient,
+			Pods:             pods,
+			Vault:            vault,
+			AuthMode:         AuthModeIP,
+			Namespace:        ns,
+			AccessAnnotation: "odysseia-greek/access",
+			RoleAnnotation:   "odysseia-greek/role",
+		}
+
+		err = addPodForTest(creationRequest.PodName, ns, access, creationRequest.Role, pods)
+		assert.Nil(t, err)
+
+		jsonBody, err := creationRequest.Marshal()
+		assert.Nil(t, err)
+
+		router := InitRoutes(testConfig)
+		response := performPostRequest(router, "/solon/v1/register", bytes.NewReader(jsonBody))
+
+		var sut delphi.SolonError
+		err = json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusInternalServerError, response.Code)
+		assert.Equal(t, "createSecret", sut.Field)
+		assert.Contains(t, sut.Message, "vault")
+		assert.Equal(t, delphi.ErrorCodeVaultSecretFailed, sut.Code)
+		assert.Equal(t, stepCreateSecret, sut.FailedStep)
+		assert.Equal(t, []string{stepCreateUser}, sut.RolledBack)
+		assert.Empty(t, vault.secrets)
+	})
+
+	t.Run("VaultUnreachable", func(t *testing.T) {
 		fixtureFile := "createUser"
 		mockCode := 200
 		mockElasticClient, err := elastic.NewMockClient(fixtureFile, mockCode)
 		assert.Nil(t, err)
-		mockKube := kubernetes.NewFakeKubeClient()
+		pods := newTestPodCache()
 		assert.Nil(t, err)
 		vaultClient, err := vault.NewVaultClient("localhost:239riwefj", "token", nil)
 		assert.Nil(t, err)
 
 		testConfig := &SolonHandler{
 			Elastic:          mockElasticClient,
-			Kube:             mockKube,
+			Pods:             pods,
 			Vault:            vaultClient,
+			AuthMode:         AuthModeIP,
 			Namespace:        ns,
 			AccessAnnotation: "odysseia-greek/access",
 			RoleAnnotation:   "odysseia-greek/role",
 		}
 
-		err = createPodForTest(creationRequest.PodName, ns, access, creationRequest.Role, mockKube)
+		err = addPodForTest(creationRequest.PodName, ns, access, creationRequest.Role, pods)
 		assert.Nil(t, err)
 
 		jsonBody, err := creationRequest.Marshal()
@@ -229,12 +314,385 @@ func TestRegister(t *testing.T) {
 		router := InitRoutes(testConfig)
 		response := performPostRequest(router, "/solon/v1/register", bodyInBytes)
 
-		var sut models.ValidationError
+		var sut delphi.SolonError
+		err = json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, response.Code)
+		assert.Equal(t, "secret", sut.Field)
+		assert.Contains(t, sut.Message, "earlier registration")
+		assert.Equal(t, delphi.ErrorCodeVaultSecretFailed, sut.Code)
+		assert.Empty(t, sut.FailedStep, "nothing is created while the earlier registration cannot be read")
+		assert.Empty(t, sut.RolledBack)
+	})
+
+	t.Run("EarlierRegistrationUnreadable", func(t *testing.T) {
+		mockElasticClient, err := elastic.NewMockClient("createUser", 200)
+		assert.Nil(t, err)
+		pods := newTestPodCache()
+		vault := &fakeVault{down: true}
+
+		testConfig := &SolonHandler{
+			Elastic:          mockElasticClient,
+			Pods:             pods,
+			Vault:            vault,
+			AuthMode:         AuthModeIP,
+			Namespace:        ns,
+			AccessAnnotation: "odysseia-greek/access",
+			RoleAnnotation:   "odysseia-greek/role",
+		}
+
+		err = addPodForTest(creationRequest.PodName, ns, access, creationRequest.Role, pods)
+		assert.Nil(t, err)
+
+		jsonBody, err := creationRequest.Marshal()
+		assert.Nil(t, err)
+
+		router := InitRoutes(testConfig)
+		response := performPostRequest(router, "/solon/v1/register", bytes.NewReader(jsonBody))
+
+		var sut delphi.SolonError
+		err = json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, response.Code)
+		assert.Equal(t, delphi.ErrorCodeVaultSecretFailed, sut.Code)
+		assert.Contains(t, sut.Message, "connection refused")
+		assert.Empty(t, vault.secrets, "credentials are not replaced without knowing the earlier registration")
+	})
+
+	t.Run("RollbackKeepsAnExistingUser", func(t *testing.T) {
+		pods := newTestPodCache()
+		vault := &fakeVault{}
+		provider := &fakeProvider{name: ProviderElasticsearch}
+
+		testConfig := &SolonHandler{
+			Providers:        map[string]CredentialProvider{ProviderElasticsearch: provider},
+			Pods:             pods,
+			Vault:            vault,
+			AuthMode:         AuthModeIP,
+			Namespace:        ns,
+			AccessAnnotation: "odysseia-greek/access",
+			RoleAnnotation:   "odysseia-greek/role",
+		}
+
+		err := addPodForTest(creationRequest.PodName, ns, access, creationRequest.Role, pods)
+		assert.Nil(t, err)
+
+		jsonBody, err := creationRequest.Marshal()
+		assert.Nil(t, err)
+
+		router := InitRoutes(testConfig)
+		response := performPostRequest(router, "/solon/v1/register", bytes.NewReader(jsonBody))
+		assert.Equal(t, http.StatusCreated, response.Code)
+		registered := provider.usernames()
+		assert.Len(t, registered, 1)
+
+		vault.failWrites = true
+		response = performPostRequest(router, "/solon/v1/register?rotate=true", bytes.NewReader(jsonBody))
+
+		var sut delphi.SolonError
+		err = json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusInternalServerError, response.Code)
+		assert.Equal(t, stepCreateSecret, sut.FailedStep)
+		assert.Empty(t, sut.RolledBack, "a user that already existed is not created by this registration")
+		assert.Equal(t, registered, provider.usernames(), "the user of the earlier registration is still in use")
+	})
+
+	t.Run("PodNotFound", func(t *testing.T) {
+		testConfig := &SolonHandler{
+			Pods:             newTestPodCache(),
+			AuthMode:         AuthModeIP,
+			Namespace:        ns,
+			AccessAnnotation: "odysseia-greek/access",
+			RoleAnnotation:   "odysseia-greek/role",
+		}
+
+		jsonBody, err := creationRequest.Marshal()
+		assert.Nil(t, err)
+
+		router := InitRoutes(testConfig)
+		response := performPostRequest(router, "/solon/v1/register", bytes.NewReader(jsonBody))
+
+		var sut delphi.SolonError
 		err = json.NewDecoder(response.Body).Decode(&sut)
 		assert.Nil(t, err)
+		assert.Equal(t, http.StatusNotFound, response.Code)
+		assert.Equal(t, delphi.ErrorCodePodNotFound, sut.Code)
+	})
+
+	t.Run("PodNameImpersonated", func(t *testing.T) {
+		pods := newTestPodCache()
+
+		testConfig := &SolonHandler{
+			Pods:             pods,
+			AuthMode:         AuthModeIP,
+			Namespace:        ns,
+			AccessAnnotation: "odysseia-greek/access",
+			RoleAnnotation:   "odysseia-greek/role",
+		}
+
+		err := addPodForTest("someotherpod-123", ns, access, creationRequest.Role, pods)
+		assert.Nil(t, err)
+
+		jsonBody, err := creationRequest.Marshal()
+		assert.Nil(t, err)
+
+		router := InitRoutes(testConfig)
+		response := performPostRequest(router, "/solon/v1/register", bytes.NewReader(jsonBody))
+
+		var sut delphi.SolonError
+		err = json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusForbidden, response.Code)
+		assert.Equal(t, delphi.ErrorCodePodNameMismatch, sut.Code)
+		assert.Contains(t, sut.Message, "someotherpod-123")
+	})
+
+	t.Run("MalformedBody", func(t *testing.T) {
+		testConfig := &SolonHandler{
+			Pods:      newTestPodCache(),
+			AuthMode:  AuthModeIP,
+			Namespace: ns,
+		}
+
+		router := InitRoutes(testConfig)
+		response := performPostRequest(router, "/solon/v1/register", bytes.NewReader([]byte("{notjson")))
+
+		var sut delphi.SolonError
+		err := json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
 		assert.Equal(t, http.StatusBadRequest, response.Code)
-		assert.Equal(t, "createSecret", sut.Messages[0].Field)
-		assert.Contains(t, sut.Messages[0].Message, "vault")
+		assert.Equal(t, delphi.ErrorCodeInvalidRequest, sut.Code)
+		assert.NotEmpty(t, sut.UniqueCode)
+	})
+}
+
+func TestCreateOneTimeToken(t *testing.T) {
+	ns := "test"
+
+	t.Run("PodNotFound", func(t *testing.T) {
+		testConfig := &SolonHandler{
+			Pods:      newTestPodCache(),
+			AuthMode:  AuthModeIP,
+			Namespace: ns,
+		}
+
+		router := InitRoutes(testConfig)
+		response := performGetRequest(router, "/solon/v1/token")
+
+		var sut delphi.SolonError
+		err := json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusNotFound, response.Code)
+		assert.Equal(t, delphi.ErrorCodePodNotFound, sut.Code)
+	})
+
+	t.Run("CacheNotSynced", func(t *testing.T) {
+		pods := newTestPodCache()
+		pods.hasSynced = func() bool { return false }
+
+		testConfig := &SolonHandler{
+			Pods:      pods,
+			AuthMode:  AuthModeIP,
+			Namespace: ns,
+		}
+
+		router := InitRoutes(testConfig)
+		response := performGetRequest(router, "/solon/v1/token")
+
+		var sut delphi.SolonError
+		err := json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, response.Code)
+		assert.Equal(t, delphi.ErrorCodeServiceUnavailable, sut.Code)
+	})
+}
+
+func TestRegisterWithServiceAccountToken(t *testing.T) {
+	access := "everywhere"
+	creationRequest := delphi.SolonCreationRequest{
+		Role:    "theonethatquestions",
+		Access:  []string{access},
+		PodName: "somepodname-122",
+	}
+
+	ns := "test"
+	serviceAccount := "sokrates"
+	podUID := "d9b0f5a4-8e8c-4b4c-a1a4-0c7d6f1f2a11"
+	token := "projected-token"
+
+	t.Run("HappyPath", func(t *testing.T) {
+		mockElasticClient, err := elastic.NewMockClient("createUser", 200)
+		assert.Nil(t, err)
+		pods := newTestPodCache()
+
+		testConfig := &SolonHandler{
+			Elastic:          mockElasticClient,
+			Vault:            NewMemoryBackend(),
+			Pods:             pods,
+			TokenReviewer:    fakeTokenReviewer(true, fmt.Sprintf("system:serviceaccount:%s:%s", ns, serviceAccount), creationRequest.PodName, podUID),
+			AuthMode:         AuthModeServiceAccount,
+			Namespace:        ns,
+			AccessAnnotation: "odysseia-greek/access",
+			RoleAnnotation:   "odysseia-greek/role",
+		}
+
+		err = addBoundPodForTest(creationRequest.PodName, ns, access, creationRequest.Role, serviceAccount, podUID, pods)
+		assert.Nil(t, err)
+
+		jsonBody, err := creationRequest.Marshal()
+		assert.Nil(t, err)
+
+		router := InitRoutes(testConfig)
+		response := performPostRequestWithToken(router, "/solon/v1/register", token, bytes.NewReader(jsonBody))
+
+		var sut models.SolonResponse
+		err = json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusCreated, response.Code)
+		assert.True(t, sut.SecretCreated)
+	})
+
+	t.Run("FromAnInitContainer", func(t *testing.T) {
+		mockElasticClient, err := elastic.NewMockClient("createUser", 200)
+		assert.Nil(t, err)
+		pods := newTestPodCache()
+
+		testConfig := &SolonHandler{
+			Elastic:          mockElasticClient,
+			Vault:            NewMemoryBackend(),
+			Pods:             pods,
+			TokenReviewer:    fakeTokenReviewer(true, fmt.Sprintf("system:serviceaccount:%s:%s", ns, serviceAccount), creationRequest.PodName, podUID),
+			AuthMode:         AuthModeServiceAccount,
+			Namespace:        ns,
+			AccessAnnotation: "odysseia-greek/access",
+			RoleAnnotation:   "odysseia-greek/role",
+		}
+
+		pod := runningPodForTest(creationRequest.PodName, ns, access, creationRequest.Role)
+		pod.UID = types.UID(podUID)
+		pod.Spec.ServiceAccountName = serviceAccount
+		pod.Status.Phase = v1.PodPending
+		err = pods.indexer.Add(pod)
+		assert.Nil(t, err)
+
+		jsonBody, err := creationRequest.Marshal()
+		assert.Nil(t, err)
+
+		router := InitRoutes(testConfig)
+		response := performPostRequestWithToken(router, "/solon/v1/register", token, bytes.NewReader(jsonBody))
+
+		assert.Equal(t, http.StatusCreated, response.Code)
+	})
+
+	t.Run("NoTokenProvided", func(t *testing.T) {
+		pods := newTestPodCache()
+
+		testConfig := &SolonHandler{
+			Pods:             pods,
+			TokenReviewer:    fakeTokenReviewer(true, fmt.Sprintf("system:serviceaccount:%s:%s", ns, serviceAccount), creationRequest.PodName, podUID),
+			AuthMode:         AuthModeServiceAccount,
+			Namespace:        ns,
+			AccessAnnotation: "odysseia-greek/access",
+			RoleAnnotation:   "odysseia-greek/role",
+		}
+
+		err := addBoundPodForTest(creationRequest.PodName, ns, access, creationRequest.Role, serviceAccount, podUID, pods)
+		assert.Nil(t, err)
+
+		jsonBody, err := creationRequest.Marshal()
+		assert.Nil(t, err)
+
+		router := InitRoutes(testConfig)
+		response := performPostRequest(router, "/solon/v1/register", bytes.NewReader(jsonBody))
+
+		var sut delphi.SolonError
+		err = json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusUnauthorized, response.Code)
+		assert.Contains(t, sut.Message, "Authorization")
+		assert.Equal(t, delphi.ErrorCodeUnauthenticated, sut.Code)
+	})
+
+	t.Run("TokenNotAuthenticated", func(t *testing.T) {
+		pods := newTestPodCache()
+
+		testConfig := &SolonHandler{
+			Pods:             pods,
+			TokenReviewer:    fakeTokenReviewer(false, "", "", ""),
+			AuthMode:         AuthModeServiceAccount,
+			Namespace:        ns,
+			AccessAnnotation: "odysseia-greek/access",
+			RoleAnnotation:   "odysseia-greek/role",
+		}
+
+		jsonBody, err := creationRequest.Marshal()
+		assert.Nil(t, err)
+
+		router := InitRoutes(testConfig)
+		response := performPostRequestWithToken(router, "/solon/v1/register", token, bytes.NewReader(jsonBody))
+
+		var sut delphi.SolonError
+		err = json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusUnauthorized, response.Code)
+		assert.Contains(t, sut.Message, "could not be authenticated")
+		assert.Equal(t, delphi.ErrorCodeUnauthenticated, sut.Code)
+	})
+
+	t.Run("TokenBoundToDifferentPodUID", func(t *testing.T) {
+		pods := newTestPodCache()
+
+		testConfig := &SolonHandler{
+			Pods:             pods,
+			TokenReviewer:    fakeTokenReviewer(true, fmt.Sprintf("system:serviceaccount:%s:%s", ns, serviceAccount), creationRequest.PodName, "an-old-uid"),
+			AuthMode:         AuthModeServiceAccount,
+			Namespace:        ns,
+			AccessAnnotation: "odysseia-greek/access",
+			RoleAnnotation:   "odysseia-greek/role",
+		}
+
+		err := addBoundPodForTest(creationRequest.PodName, ns, access, creationRequest.Role, serviceAccount, podUID, pods)
+		assert.Nil(t, err)
+
+		jsonBody, err := creationRequest.Marshal()
+		assert.Nil(t, err)
+
+		router := InitRoutes(testConfig)
+		response := performPostRequestWithToken(router, "/solon/v1/register", token, bytes.NewReader(jsonBody))
+
+		var sut delphi.SolonError
+		err = json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusUnauthorized, response.Code)
+		assert.Contains(t, sut.Message, "an-old-uid")
+		assert.Equal(t, delphi.ErrorCodeUnauthenticated, sut.Code)
+	})
+
+	t.Run("TokenFromOtherNamespace", func(t *testing.T) {
+		pods := newTestPodCache()
+
+		testConfig := &SolonHandler{
+			Pods:             pods,
+			TokenReviewer:    fakeTokenReviewer(true, fmt.Sprintf("system:serviceaccount:%s:%s", "elsewhere", serviceAccount), creationRequest.PodName, podUID),
+			AuthMode:         AuthModeServiceAccount,
+			Namespace:        ns,
+			AccessAnnotation: "odysseia-greek/access",
+			RoleAnnotation:   "odysseia-greek/role",
+		}
+
+		jsonBody, err := creationRequest.Marshal()
+		assert.Nil(t, err)
+
+		router := InitRoutes(testConfig)
+		response := performPostRequestWithToken(router, "/solon/v1/register", token, bytes.NewReader(jsonBody))
+
+		var sut delphi.SolonError
+		err = json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusUnauthorized, response.Code)
+		assert.Contains(t, sut.Message, "elsewhere")
+		assert.Equal(t, delphi.ErrorCodeUnauthenticated, sut.Code)
 	})
 }
 
@@ -243,6 +701,19 @@ func performGetRequest(r http.Handler, path string) *httptest.ResponseRecorder {
 	req, _ := http.NewRequest("GET", path, nil)
 	req.Header.Set(service.HeaderKey, uuid)
 	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = fmt.Sprintf("%s:48212", testPodIP)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func performGetRequestWithToken(r http.Handler, path, token string) *httptest.ResponseRecorder {
+	uuid := uuid2.New().String()
+	req, _ := http.NewRequest("GET", path, nil)
+	req.Header.Set(service.HeaderKey, uuid)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	req.RemoteAddr = fmt.Sprintf("%s:48212", testPodIP)
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 	return w
@@ -253,15 +724,182 @@ func performPostRequest(r http.Handler, path string, body io.Reader) *httptest.R
 	req, _ := http.NewRequest("POST", path, body)
 	req.Header.Set(service.HeaderKey, uuid)
 	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = fmt.Sprintf("%s:48212", testPodIP)
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 	return w
 }
 
-func createPodForTest(name, ns, access, role string, client *kubernetes.KubeClient) error {
+func performPostRequestWithToken(r http.Handler, path, token string, body io.Reader) *httptest.ResponseRecorder {
+	uuid := uuid2.New().String()
+	req, _ := http.NewRequest("POST", path, body)
+	req.Header.Set(service.HeaderKey, uuid)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	req.RemoteAddr = fmt.Sprintf("%s:48212", testPodIP)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func fakeTokenReviewer(authenticated bool, username, podName, podUID string) authenticationv1.TokenReviewInterface {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authv1.TokenReview)
+		review.Status = authv1.TokenReviewStatus{
+			Authenticated: authenticated,
+			User: authv1.UserInfo{
+				Username: username,
+				Extra: map[string]authv1.ExtraValue{
+					podNameExtraKey: {podName},
+					podUIDExtraKey:  {podUID},
+				},
+			},
+		}
+		return true, review, nil
+	})
+
+	return clientset.AuthenticationV1().TokenReviews()
+}
+
+func newTestPodCache() *PodCache {
+	return &PodCache{
+		indexer:   cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{podIPIndex: indexPodByIP}),
+		hasSynced: func() bool { return true },
+	}
+}
+
+func addBoundPodForTest(name, ns, access, role, serviceAccount, uid string, pods *PodCache) error {
+	pod := runningPodForTest(name, ns, access, role)
+	pod.UID = types.UID(uid)
+	pod.Spec.ServiceAccountName = serviceAccount
+	return pods.indexer.Add(pod)
+}
+
+func addPodForTest(name, ns, access, role string, pods *PodCache) error {
+	return pods.indexer.Add(runningPodForTest(name, ns, access, role))
+}
+
+func runningPodForTest(name, ns, access, role string) *v1.Pod {
 	pod := kubernetes.TestPodObject(name, ns, access, role)
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
-	defer cancel()
-	_, err := client.CoreV1().Pods(ns).Create(ctx, pod, metav1.CreateOptions{})
-	return err
+	pod.Status.Phase = v1.PodRunning
+	pod.Status.PodIP = testPodIP
+	return pod
+}
+
+// fakeVault keeps secrets and policies in memory, methods a test does not need fall through to the nil client
+type fakeVault struct {
+	SecretBackend
+	secrets  map[string]map[string]interface{}
+	versions map[string]int
+	policies []string
+	removed  []string
+	written  map[string]string
+	tokens   []string
+	down     bool
+	// failWrites makes every write of a secret fail while reads keep working
+	failWrites bool
+}
+
+func (f *fakeVault) Health() (bool, error) {
+	if f.down {
+		return false, errors.New("connection refused")
+	}
+	return true, nil
+}
+
+// ListSecrets lists the root of the mount like vault does, secrets below a namespace show up as a single folder
+func (f *fakeVault) ListSecrets() ([]string, error) {
+	var names []string
+	for name := range f.secrets {
+		if folder, _, ok := strings.Cut(name, "/"); ok {
+			name = folder + "/"
+		}
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func (f *fakeVault) ListSecretsIn(path string) ([]string, error) {
+	var names []string
+	for name := range f.secrets {
+		if secret, ok := strings.CutPrefix(name, path+"/"); ok {
+			names = append(names, secret)
+		}
+	}
+	return names, nil
+}
+
+func (f *fakeVault) GetSecret(name string) (*api.Secret, error) {
+	if f.down {
+		return nil, errors.New("connection refused")
+	}
+	data, ok := f.secrets[name]
+	if !ok {
+		return nil, nil
+	}
+	metadata := map[string]interface{}{"version": json.Number(fmt.Sprintf("%d", f.versions[name]))}
+	return &api.Secret{Data: map[string]interface{}{"data": data, "metadata": metadata}}, nil
+}
+
+func (f *fakeVault) DeleteSecret(name string) error {
+	return nil
+}
+
+func (f *fakeVault) RemoveSecret(name string) error {
+	delete(f.secrets, name)
+	f.removed = append(f.removed, name)
+	return nil
+}
+
+func (f *fakeVault) DeletePolicy(policy string) (*api.Secret, error) {
+	f.removed = append(f.removed, policy)
+	return nil, nil
+}
+
+func (f *fakeVault) ListPolicies() ([]string, error) {
+	return f.policies, nil
+}
+
+func (f *fakeVault) CreateNewSecret(name string, payload []byte) (bool, error) {
+	if f.failWrites {
+		return false, errors.New("vault is sealed")
+	}
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	err := json.Unmarshal(payload, &secret)
+	if err != nil {
+		return false, err
+	}
+
+	if f.secrets == nil {
+		f.secrets = map[string]map[string]interface{}{}
+	}
+	if f.versions == nil {
+		f.versions = map[string]int{}
+	}
+	f.secrets[name] = secret.Data
+	f.versions[name]++
+	return true, nil
+}
+
+func (f *fakeVault) WritePolicy(policy string, rules []byte) error {
+	if f.written == nil {
+		f.written = map[string]string{}
+	}
+	f.written[policy] = string(rules)
+	return nil
+}
+
+func (f *fakeVault) CreateOneTimeToken(policies []string) (string, error) {
+	f.tokens = append(f.tokens, fmt.Sprintf("one-time:%s", strings.Join(policies, ",")))
+	return "s.onetime", nil
+}
+
+func (f *fakeVault) CreateTokenWithOptions(policies []string, ttl string, numUses int) (string, error) {
+	f.tokens = append(f.tokens, fmt.Sprintf("options:%s:%s:%d", strings.Join(policies, ","), ttl, numUses))
+	return "s.options", nil
 }
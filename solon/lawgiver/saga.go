@@ -0,0 +1,71 @@
+package lawgiver
+
+import (
+	"fmt"
+	"github.com/odysseia-greek/agora/plato/logging"
+	delphi "github.com/odysseia-greek/delphi/solon/models"
+)
+
+const (
+	stepGeneratePassword string = "passwordgenerator"
+	stepCreateUser       string = "createUser"
+	stepCreateSecret     string = "createSecret"
+)
+
+type compensation struct {
+	step string
+	undo func() error
+}
+
+// saga runs the steps of a registration in order and records how to undo every step that succeeded,
+// when a step fails the earlier steps are compensated in reverse order so no half registered pod is left behind
+type saga struct {
+	name          string
+	compensations []compensation
+}
+
+func newSaga(name string) *saga {
+	return &saga{name: name}
+}
+
+// run executes the action of a step, undo may be nil when the step has nothing to compensate
+func (s *saga) run(step string, code delphi.ErrorCode, action func() error, undo func() error) error {
+	err := action()
+	if err != nil {
+		solonErr := newSolonError(code, step, err)
+		solonErr.FailedStep = step
+		solonErr.RolledBack = s.rollback()
+		return solonErr
+	}
+
+	if undo != nil {
+		s.compensate(step, undo)
+	}
+
+	return nil
+}
+
+// compensate records how to undo a step that already succeeded, for steps that only know after running if they
+// created something that is theirs to remove
+func (s *saga) compensate(step string, undo func() error) {
+	s.compensations = append(s.compensations, compensation{step: step, undo: undo})
+}
+
+// rollback compensates every completed step and returns the steps that were undone
+func (s *saga) rollback() []string {
+	var rolledBack []string
+	for i := len(s.compensations) - 1; i >= 0; i-- {
+		c := s.compensations[i]
+		err := c.undo()
+		if err != nil {
+			logging.Error(fmt.Sprintf("failed to compensate step %s for %s: %s", c.step, s.name, err.Error()))
+			continue
+		}
+
+		logging.System(fmt.Sprintf("compensated step %s for %s", c.step, s.name))
+		rolledBack = append(rolledBack, c.step)
+	}
+
+	s.compensations = nil
+	return rolledBack
+}
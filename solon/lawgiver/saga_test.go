@@ -0,0 +1,52 @@
+package lawgiver
+
+import (
+	"errors"
+	delphi "github.com/odysseia-greek/delphi/solon/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSaga(t *testing.T) {
+	t.Run("CompensatesInReverseOrder", func(t *testing.T) {
+		var undone []string
+		sut := newSaga("sokrates-5d8f7c9b4-abcde")
+
+		err := sut.run("first", delphi.ErrorCodeInternal, func() error { return nil }, func() error {
+			undone = append(undone, "first")
+			return nil
+		})
+		assert.Nil(t, err)
+
+		err = sut.run("second", delphi.ErrorCodeInternal, func() error { return nil }, func() error {
+			undone = append(undone, "second")
+			return nil
+		})
+		assert.Nil(t, err)
+
+		err = sut.run("third", delphi.ErrorCodeVaultSecretFailed, func() error { return errors.New("vault sealed") }, nil)
+		assert.NotNil(t, err)
+
+		var solonErr *solonError
+		assert.True(t, errors.As(err, &solonErr))
+		assert.Equal(t, delphi.ErrorCodeVaultSecretFailed, solonErr.Code)
+		assert.Equal(t, "third", solonErr.FailedStep)
+		assert.Equal(t, []string{"second", "first"}, solonErr.RolledBack)
+		assert.Equal(t, []string{"second", "first"}, undone)
+	})
+
+	t.Run("FailedCompensationIsNotReported", func(t *testing.T) {
+		sut := newSaga("sokrates-5d8f7c9b4-abcde")
+
+		err := sut.run("first", delphi.ErrorCodeInternal, func() error { return nil }, func() error {
+			return errors.New("elastic unreachable")
+		})
+		assert.Nil(t, err)
+
+		err = sut.run("second", delphi.ErrorCodeInternal, func() error { return errors.New("failed") }, nil)
+
+		var solonErr *solonError
+		assert.True(t, errors.As(err, &solonErr))
+		assert.Empty(t, solonErr.RolledBack)
+	})
+}
@@ -0,0 +1,113 @@
+package lawgiver
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"github.com/hashicorp/vault/api"
+	"github.com/odysseia-greek/agora/diogenes"
+	"github.com/odysseia-greek/agora/plato/logging"
+	"time"
+)
+
+const (
+	EnvSecretBackend string = "SOLON_SECRET_BACKEND"
+	// EnvSecretFile is where the file backend keeps its secrets, EnvSecretFileKey is the base64 encoded aes-256 key
+	EnvSecretFile    string = "SOLON_SECRET_FILE"
+	EnvSecretFileKey string = "SOLON_SECRET_FILE_KEY"
+
+	SecretBackendVault  string = "vault"
+	SecretBackendMemory string = "memory"
+	SecretBackendFile   string = "file"
+
+	defaultSecretBackend string = SecretBackendVault
+)
+
+// SecretBackend is everything solon needs from the store that holds the credentials of the pods it registers.
+// Secrets are kv v2 secrets: a payload is written as {"data": {...}} and read back with the data and metadata,
+// including the version, in the Data of the secret. Every backend also has to implement namespacedSecretLister
+type SecretBackend interface {
+	WritePolicy(policyName string, policy []byte) error
+	DeletePolicy(policyName string) (*api.Secret, error)
+	CreateOneTimeToken(policies []string) (string, error)
+	CreateNewSecret(name string, payload []byte) (bool, error)
+	// GetSecret returns nil without an error when there is no secret with the name
+	GetSecret(name string) (*api.Secret, error)
+	// DeleteSecret deletes the latest version of a secret, RemoveSecret removes the secret with every version
+	DeleteSecret(name string) error
+	RemoveSecret(name string) error
+	// ListSecrets lists the root of the mount, a path holding secrets shows up as a single name ending in a /
+	ListSecrets() ([]string, error)
+	Health() (bool, error)
+}
+
+// Apart from namespacedSecretLister a backend can implement any of the interfaces below, solon falls back to less
+// precise behaviour without them
+
+// namespacedSecretLister lists the secrets below a path, secrets are stored per namespace so solon refuses
+// to start with a backend that cannot find them
+type namespacedSecretLister interface {
+	ListSecretsIn(path string) ([]string, error)
+}
+
+// policyLister is implemented by backends that can list acl policies, without it only the policies
+// belonging to an orphaned secret are found
+type policyLister interface {
+	ListPolicies() ([]string, error)
+}
+
+// tokenOptionsCreator is implemented by backends that can set the ttl and use count of a token,
+// other backends always hand out their default one time token
+type tokenOptionsCreator interface {
+	CreateTokenWithOptions(policies []string, ttl string, numUses int) (string, error)
+}
+
+// tokenWrapper is implemented by backends that can put a token in a response wrapping token that is unwrapped once,
+// without it a pod asking for a wrapped token is turned down rather than handed the token itself
+type tokenWrapper interface {
+	WrapToken(token string, ttl time.Duration) (string, error)
+}
+
+// tokenLookup is implemented by backends that hand out the accessor of a token they create and can look the token up
+// by it, solon only keeps the accessor. A token that can no longer be looked up has been used or revoked, without
+// the interface a token is outstanding until its ttl runs out
+type tokenLookup interface {
+	CreateTokenWithAccessor(policies []string, ttl string, numUses int) (token string, accessor string, err error)
+	LookupAccessor(accessor string) (bool, error)
+}
+
+// vaultStatusReporter is implemented by backends that return the full sys/health response of vault,
+// without it only the healthy flag of the backend is known
+type vaultStatusReporter interface {
+	HealthStatus(ctx context.Context) (*api.HealthResponse, error)
+}
+
+// secretBackendFromEnv creates the backend by name, the memory and file backends are meant for tests and local clusters
+func secretBackendFromEnv(backend, file, key string) (SecretBackend, error) {
+	switch backend {
+	case SecretBackendVault:
+		client, err := diogenes.CreateVaultClient(true)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewVaultBackend(client)
+	case SecretBackendMemory:
+		logging.Warn("secrets are kept in memory and are lost when solon restarts, do not use this outside of a local cluster")
+		return NewMemoryBackend(), nil
+	case SecretBackendFile:
+		if file == "" {
+			return nil, fmt.Errorf("%s is required for the %s secret backend", EnvSecretFile, SecretBackendFile)
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s, expected a base64 encoded key: %w", EnvSecretFileKey, err)
+		}
+
+		logging.Warn(fmt.Sprintf("secrets are kept in %s, do not use this outside of a local cluster", file))
+		return NewFileBackend(file, decoded)
+	default:
+		return nil, fmt.Errorf("unknown secret backend %s, expected %s, %s or %s", backend, SecretBackendVault, SecretBackendMemory, SecretBackendFile)
+	}
+}
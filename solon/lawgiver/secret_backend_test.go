@@ -0,0 +1,201 @@
+package lawgiver
+
+import (
+	"bytes"
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSecretBackends(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+
+	backends := map[string]func(t *testing.T) SecretBackend{
+		SecretBackendMemory: func(t *testing.T) SecretBackend {
+			return NewMemoryBackend()
+		},
+		SecretBackendFile: func(t *testing.T) SecretBackend {
+			backend, err := NewFileBackend(filepath.Join(t.TempDir(), "secrets"), key)
+			assert.Nil(t, err)
+			return backend
+		},
+	}
+
+	for name, newBackend := range backends {
+		t.Run(name, func(t *testing.T) {
+			t.Run("SecretsAreVersioned", func(t *testing.T) {
+				backend := newBackend(t)
+
+				missing, err := backend.GetSecret("test/sokrates")
+				assert.Nil(t, err)
+				assert.Nil(t, missing)
+
+				for _, password := range []string{"first", "second"} {
+					created, err := backend.CreateNewSecret("test/sokrates", []byte(`{"data":{"elasticUsername":"sokrates","elasticPassword":"`+password+`"}}`))
+					assert.Nil(t, err)
+					assert.True(t, created)
+				}
+
+				secret, err := backend.GetSecret("test/sokrates")
+				assert.Nil(t, err)
+				version, err := versionOf("test/sokrates", secret)
+				assert.Nil(t, err)
+				assert.Equal(t, 2, version)
+
+				data, err := parseRegistrationData(secret)
+				assert.Nil(t, err)
+				assert.Equal(t, "second", data.Password)
+
+				err = backend.DeleteSecret("test/sokrates")
+				assert.Nil(t, err)
+				secret, err = backend.GetSecret("test/sokrates")
+				assert.Nil(t, err)
+				data, err = parseRegistrationData(secret)
+				assert.Nil(t, err)
+				assert.Nil(t, data, "a deleted version has no data")
+
+				err = backend.RemoveSecret("test/sokrates")
+				assert.Nil(t, err)
+				secret, err = backend.GetSecret("test/sokrates")
+				assert.Nil(t, err)
+				assert.Nil(t, secret)
+			})
+
+			t.Run("PayloadWithoutData", func(t *testing.T) {
+				backend := newBackend(t)
+				created, err := backend.CreateNewSecret("sokrates", []byte(`{"elasticUsername":"sokrates"}`))
+				assert.NotNil(t, err)
+				assert.False(t, created)
+			})
+
+			t.Run("ListsLikeAKvMount", func(t *testing.T) {
+				backend := newBackend(t)
+				for _, name := range []string{"legacy", "test/sokrates", "test/platon", "staging/sokrates"} {
+					_, err := backend.CreateNewSecret(name, []byte(`{"data":{"elasticUsername":"x"}}`))
+					assert.Nil(t, err)
+				}
+
+				root, err := backend.ListSecrets()
+				assert.Nil(t, err)
+				assert.Equal(t, []string{"legacy", "staging/", "test/"}, root)
+
+				lister, ok := backend.(namespacedSecretLister)
+				assert.True(t, ok)
+				names, err := lister.ListSecretsIn("test")
+				assert.Nil(t, err)
+				assert.Equal(t, []string{"platon", "sokrates"}, names)
+			})
+
+			t.Run("Policies", func(t *testing.T) {
+				backend := newBackend(t)
+				assert.Nil(t, backend.WritePolicy("policy.test.sokrates", []byte(`path "configs/data/test/sokrates" {}`)))
+				assert.Nil(t, backend.WritePolicy("policy.test.platon", []byte(`path "configs/data/test/platon" {}`)))
+
+				_, err := backend.DeletePolicy("policy.test.platon")
+				assert.Nil(t, err)
+
+				lister, ok := backend.(policyLister)
+				assert.True(t, ok)
+				policies, err := lister.ListPolicies()
+				assert.Nil(t, err)
+				assert.Equal(t, []string{"policy.test.sokrates"}, policies)
+			})
+
+			t.Run("Tokens", func(t *testing.T) {
+				backend := newBackend(t)
+				token, err := backend.CreateOneTimeToken([]string{"policy.test.sokrates"})
+				assert.Nil(t, err)
+				assert.NotEmpty(t, token)
+
+				lookup, ok := backend.(tokenLookup)
+				assert.True(t, ok)
+				token, accessor, err := lookup.CreateTokenWithAccessor([]string{"policy.test.sokrates"}, "", 1)
+				assert.Nil(t, err)
+				assert.NotEqual(t, token, accessor)
+				valid, err := lookup.LookupAccessor(accessor)
+				assert.Nil(t, err)
+				assert.True(t, valid)
+
+				valid, err = lookup.LookupAccessor(token)
+				assert.Nil(t, err)
+				assert.False(t, valid, "a token is not its own accessor")
+
+				creator, ok := backend.(tokenOptionsCreator)
+				assert.True(t, ok)
+				_, err = creator.CreateTokenWithOptions([]string{"policy.test.sokrates"}, "soon", 1)
+				assert.NotNil(t, err)
+			})
+		})
+	}
+
+	t.Run("OneTimeTokenIsSpent", func(t *testing.T) {
+		backend := NewMemoryBackend()
+		token, err := backend.CreateOneTimeToken([]string{"policy.test.sokrates"})
+		assert.Nil(t, err)
+
+		assert.Nil(t, backend.UseToken(token))
+		valid, err := backend.LookupToken(token)
+		assert.Nil(t, err)
+		assert.False(t, valid)
+		assert.NotNil(t, backend.UseToken(token))
+	})
+
+	t.Run("TokenExpires", func(t *testing.T) {
+		now := time.Date(2024, 11, 3, 10, 0, 0, 0, time.UTC)
+		backend := NewMemoryBackend()
+		backend.now = func() time.Time { return now }
+
+		token, err := backend.CreateTokenWithOptions([]string{"policy.test.sokrates"}, "5m", 0)
+		assert.Nil(t, err)
+
+		now = now.Add(6 * time.Minute)
+		valid, err := backend.LookupToken(token)
+		assert.Nil(t, err)
+		assert.False(t, valid)
+	})
+
+	t.Run("FileSurvivesARestart", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "secrets")
+		backend, err := NewFileBackend(path, key)
+		assert.Nil(t, err)
+		_, err = backend.CreateNewSecret("test/sokrates", []byte(`{"data":{"elasticPassword":"kept"}}`))
+		assert.Nil(t, err)
+
+		onDisk, err := os.ReadFile(path)
+		assert.Nil(t, err)
+		assert.NotContains(t, string(onDisk), "kept")
+
+		reopened, err := NewFileBackend(path, key)
+		assert.Nil(t, err)
+		secret, err := reopened.GetSecret("test/sokrates")
+		assert.Nil(t, err)
+		data, err := parseRegistrationData(secret)
+		assert.Nil(t, err)
+		assert.Equal(t, "kept", data.Password)
+
+		_, err = NewFileBackend(path, bytes.Repeat([]byte{8}, 32))
+		assert.NotNil(t, err)
+	})
+
+	t.Run("FromEnv", func(t *testing.T) {
+		backend, err := secretBackendFromEnv(SecretBackendMemory, "", "")
+		assert.Nil(t, err)
+		assert.IsType(t, &MemoryBackend{}, backend)
+
+		backend, err = secretBackendFromEnv(SecretBackendFile, filepath.Join(t.TempDir(), "secrets"), base64.StdEncoding.EncodeToString(key))
+		assert.Nil(t, err)
+		assert.IsType(t, &FileBackend{}, backend)
+
+		_, err = secretBackendFromEnv(SecretBackendFile, "", base64.StdEncoding.EncodeToString(key))
+		assert.NotNil(t, err)
+
+		_, err = secretBackendFromEnv(SecretBackendFile, filepath.Join(t.TempDir(), "secrets"), base64.StdEncoding.EncodeToString([]byte("short")))
+		assert.NotNil(t, err)
+
+		_, err = secretBackendFromEnv("consul", "", "")
+		assert.NotNil(t, err)
+	})
+}
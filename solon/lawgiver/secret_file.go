@@ -0,0 +1,112 @@
+package lawgiver
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileBackend is a MemoryBackend that writes its state to a file encrypted with aes-256-gcm after every change,
+// secrets survive a restart of solon without a vault server. The file is only read when the backend is created
+type FileBackend struct {
+	*MemoryBackend
+	path string
+	aead cipher.AEAD
+}
+
+// NewFileBackend opens the file at path with a 32 byte key, a file that does not exist yet is created on the first write
+func NewFileBackend(path string, key []byte) (*FileBackend, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("the key of the secret file has to be 32 bytes, got %d", len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	backend := &FileBackend{
+		MemoryBackend: &MemoryBackend{state: newBackendState(), now: time.Now},
+		path:          path,
+		aead:          aead,
+	}
+
+	if err := backend.load(); err != nil {
+		return nil, err
+	}
+
+	backend.persist = backend.save
+	return backend, nil
+}
+
+func (f *FileBackend) load() error {
+	sealed, err := os.ReadFile(f.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	nonceSize := f.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return fmt.Errorf("secret file %s is too short to be valid", f.path)
+	}
+
+	plain, err := f.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt secret file %s, is the key right: %w", f.path, err)
+	}
+
+	state := newBackendState()
+	if err := json.Unmarshal(plain, &state); err != nil {
+		return fmt.Errorf("secret file %s is corrupt: %w", f.path, err)
+	}
+
+	f.state = state
+	return nil
+}
+
+// save writes to a temporary file first so a crash halfway through a write never leaves a broken file behind
+func (f *FileBackend) save(state *backendState) error {
+	plain, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, f.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	sealed := f.aead.Seal(nonce, nonce, plain, nil)
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(sealed); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), f.path)
+}
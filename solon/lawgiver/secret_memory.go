@@ -0,0 +1,351 @@
+package lawgiver
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/hashicorp/vault/api"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryBackend keeps secrets, policies and tokens in memory the way a kv v2 mount of vault would, every write adds a
+// version to the secret. It implements every optional capability so tests and local clusters see the full behaviour
+type MemoryBackend struct {
+	mu    sync.Mutex
+	state backendState
+	// persist is called with the state after every change, it is how the file backend keeps its file up to date
+	persist func(state *backendState) error
+	now     func() time.Time
+}
+
+// backendState is what a backend holds, it is written to disk as is by the file backend
+type backendState struct {
+	Secrets  map[string]*storedSecret `json:"secrets"`
+	Policies map[string]string        `json:"policies"`
+	Tokens   map[string]*storedToken  `json:"tokens"`
+	// Wrapped maps a response wrapping token to the token it wraps
+	Wrapped map[string]*wrappedToken `json:"wrapped"`
+}
+
+type storedSecret struct {
+	Versions []secretVersion `json:"versions"`
+}
+
+type secretVersion struct {
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Deleted   bool            `json:"deleted,omitempty"`
+}
+
+type storedToken struct {
+	Policies []string `json:"policies"`
+	// UsesLeft is the number of uses the token has left, 0 means it can be used without limit
+	UsesLeft  int        `json:"usesLeft"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	Accessor  string     `json:"accessor"`
+}
+
+type wrappedToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{state: newBackendState(), now: time.Now}
+}
+
+func newBackendState() backendState {
+	return backendState{
+		Secrets:  map[string]*storedSecret{},
+		Policies: map[string]string{},
+		Tokens:   map[string]*storedToken{},
+		Wrapped:  map[string]*wrappedToken{},
+	}
+}
+
+// update changes the state under the lock and persists it, a failed persist leaves the change in memory only
+func (m *MemoryBackend) update(change func(state *backendState) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := change(&m.state); err != nil {
+		return err
+	}
+
+	if m.persist == nil {
+		return nil
+	}
+
+	return m.persist(&m.state)
+}
+
+func (m *MemoryBackend) read(view func(state *backendState) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return view(&m.state)
+}
+
+func (m *MemoryBackend) WritePolicy(policyName string, policy []byte) error {
+	return m.update(func(state *backendState) error {
+		state.Policies[policyName] = string(policy)
+		return nil
+	})
+}
+
+func (m *MemoryBackend) DeletePolicy(policyName string) (*api.Secret, error) {
+	return nil, m.update(func(state *backendState) error {
+		delete(state.Policies, policyName)
+		return nil
+	})
+}
+
+func (m *MemoryBackend) ListPolicies() ([]string, error) {
+	var policies []string
+	err := m.read(func(state *backendState) error {
+		for name := range state.Policies {
+			policies = append(policies, name)
+		}
+		return nil
+	})
+
+	slices.Sort(policies)
+	return policies, err
+}
+
+func (m *MemoryBackend) CreateOneTimeToken(policies []string) (string, error) {
+	return m.CreateTokenWithOptions(policies, "", 1)
+}
+
+func (m *MemoryBackend) CreateTokenWithOptions(policies []string, ttl string, numUses int) (string, error) {
+	token, _, err := m.CreateTokenWithAccessor(policies, ttl, numUses)
+	return token, err
+}
+
+// CreateTokenWithAccessor creates a token and a separate accessor to look it up by, like vault does
+func (m *MemoryBackend) CreateTokenWithAccessor(policies []string, ttl string, numUses int) (string, string, error) {
+	token := &storedToken{Policies: slices.Clone(policies), UsesLeft: numUses}
+	if ttl != "" {
+		duration, err := time.ParseDuration(ttl)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid token ttl %s: %w", ttl, err)
+		}
+		expiresAt := m.now().Add(duration)
+		token.ExpiresAt = &expiresAt
+	}
+
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", "", err
+	}
+
+	name := "s." + hex.EncodeToString(random[:16])
+	token.Accessor = hex.EncodeToString(random[16:])
+	err := m.update(func(state *backendState) error {
+		state.Tokens[name] = token
+		return nil
+	})
+
+	return name, token.Accessor, err
+}
+
+// WrapToken hands out a wrapping token that can be unwrapped once within the ttl, like sys/wrapping/wrap of vault
+func (m *MemoryBackend) WrapToken(token string, ttl time.Duration) (string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+
+	name := "hvs.wrap." + hex.EncodeToString(random)
+	err := m.update(func(state *backendState) error {
+		state.Wrapped[name] = &wrappedToken{Token: token, ExpiresAt: m.now().Add(ttl)}
+		return nil
+	})
+
+	return name, err
+}
+
+// UnwrapToken returns the wrapped token, a wrapping token that was unwrapped before or expired is not valid
+func (m *MemoryBackend) UnwrapToken(wrappingToken string) (string, error) {
+	var token string
+	err := m.update(func(state *backendState) error {
+		wrapped, ok := state.Wrapped[wrappingToken]
+		delete(state.Wrapped, wrappingToken)
+		if !ok || !m.now().Before(wrapped.ExpiresAt) {
+			return fmt.Errorf("wrapping token is not valid")
+		}
+
+		token = wrapped.Token
+		return nil
+	})
+
+	return token, err
+}
+
+// LookupToken is true while the token has uses left and has not expired
+func (m *MemoryBackend) LookupToken(token string) (bool, error) {
+	var valid bool
+	err := m.read(func(state *backendState) error {
+		stored, ok := state.Tokens[token]
+		valid = ok && (stored.ExpiresAt == nil || m.now().Before(*stored.ExpiresAt))
+		return nil
+	})
+
+	return valid, err
+}
+
+// LookupAccessor is true while the token with the accessor has uses left and has not expired
+func (m *MemoryBackend) LookupAccessor(accessor string) (bool, error) {
+	var valid bool
+	err := m.read(func(state *backendState) error {
+		for _, stored := range state.Tokens {
+			if stored.Accessor == accessor {
+				valid = stored.ExpiresAt == nil || m.now().Before(*stored.ExpiresAt)
+				return nil
+			}
+		}
+		return nil
+	})
+
+	return valid, err
+}
+
+// UseToken spends a use of the token the way a request to vault would, a token without uses left is revoked
+func (m *MemoryBackend) UseToken(token string) error {
+	return m.update(func(state *backendState) error {
+		stored, ok := state.Tokens[token]
+		if !ok || (stored.ExpiresAt != nil && !m.now().Before(*stored.ExpiresAt)) {
+			delete(state.Tokens, token)
+			return fmt.Errorf("token is not valid")
+		}
+
+		if stored.UsesLeft == 0 {
+			return nil
+		}
+
+		stored.UsesLeft--
+		if stored.UsesLeft == 0 {
+			delete(state.Tokens, token)
+		}
+		return nil
+	})
+}
+
+func (m *MemoryBackend) CreateNewSecret(name string, payload []byte) (bool, error) {
+	var secret struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &secret); err != nil {
+		return false, fmt.Errorf("secret %s is not a kv v2 payload: %w", name, err)
+	}
+
+	if len(secret.Data) == 0 || bytes.Equal(secret.Data, []byte("null")) {
+		return false, fmt.Errorf("secret %s has no data", name)
+	}
+
+	err := m.update(func(state *backendState) error {
+		stored, ok := state.Secrets[name]
+		if !ok {
+			stored = &storedSecret{}
+			state.Secrets[name] = stored
+		}
+
+		stored.Versions = append(stored.Versions, secretVersion{Data: secret.Data, CreatedAt: m.now().UTC()})
+		return nil
+	})
+
+	return err == nil, err
+}
+
+// GetSecret returns the latest version, the data of a deleted version is nil like it is in vault
+func (m *MemoryBackend) GetSecret(name string) (*api.Secret, error) {
+	var secret *api.Secret
+	err := m.read(func(state *backendState) error {
+		stored, ok := state.Secrets[name]
+		if !ok || len(stored.Versions) == 0 {
+			return nil
+		}
+
+		latest := stored.Versions[len(stored.Versions)-1]
+		metadata := map[string]interface{}{
+			"version":      json.Number(fmt.Sprintf("%d", len(stored.Versions))),
+			"created_time": latest.CreatedAt.Format(time.RFC3339Nano),
+		}
+
+		var data interface{}
+		if !latest.Deleted {
+			decoder := json.NewDecoder(bytes.NewReader(latest.Data))
+			decoder.UseNumber()
+			if err := decoder.Decode(&data); err != nil {
+				return fmt.Errorf("secret %s cannot be read: %w", name, err)
+			}
+		}
+
+		secret = &api.Secret{Data: map[string]interface{}{"data": data, "metadata": metadata}}
+		return nil
+	})
+
+	return secret, err
+}
+
+func (m *MemoryBackend) DeleteSecret(name string) error {
+	return m.update(func(state *backendState) error {
+		stored, ok := state.Secrets[name]
+		if !ok || len(stored.Versions) == 0 {
+			return nil
+		}
+
+		stored.Versions[len(stored.Versions)-1].Deleted = true
+		return nil
+	})
+}
+
+func (m *MemoryBackend) RemoveSecret(name string) error {
+	return m.update(func(state *backendState) error {
+		delete(state.Secrets, name)
+		return nil
+	})
+}
+
+func (m *MemoryBackend) ListSecrets() ([]string, error) {
+	return m.ListSecretsIn("")
+}
+
+// ListSecretsIn lists the names directly below the path, a deeper path shows up once as a folder ending in a /
+func (m *MemoryBackend) ListSecretsIn(path string) ([]string, error) {
+	prefix := ""
+	if path != "" {
+		prefix = strings.TrimSuffix(path, "/") + "/"
+	}
+
+	var names []string
+	err := m.read(func(state *backendState) error {
+		for name := range state.Secrets {
+			rest, ok := strings.CutPrefix(name, prefix)
+			if !ok {
+				continue
+			}
+
+			if folder, _, isFolder := strings.Cut(rest, "/"); isFolder {
+				rest = folder + "/"
+			}
+
+			if !slices.Contains(names, rest) {
+				names = append(names, rest)
+			}
+		}
+		return nil
+	})
+
+	slices.Sort(names)
+	return names, err
+}
+
+func (m *MemoryBackend) Health() (bool, error) {
+	return true, nil
+}
@@ -0,0 +1,172 @@
+package lawgiver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hashicorp/vault/api"
+	"github.com/odysseia-greek/agora/diogenes"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// vaultTokenTTL and vaultTokenUses are what diogenes creates a one time token with, a token created with options
+	// falls back to them for what is not set
+	vaultTokenTTL         string = "5m"
+	vaultTokenUses        int    = 1
+	vaultTokenDisplayName string = "solonCreated"
+)
+
+// VaultBackend is the vault client of diogenes with the capabilities solon needs on top of it, it talks to the
+// same connection and kv mount as the client it wraps
+type VaultBackend struct {
+	diogenes.Client
+	connection *api.Client
+	mount      string
+}
+
+// NewVaultBackend wraps a diogenes client, only the vault implementation exposes the connection the extra calls need
+func NewVaultBackend(client diogenes.Client) (*VaultBackend, error) {
+	vault, ok := client.(*diogenes.Vault)
+	if !ok || vault.Connection == nil {
+		return nil, fmt.Errorf("vault client %T has no connection to vault", client)
+	}
+
+	return &VaultBackend{Client: vault, connection: vault.Connection, mount: vault.KVSecretPath}, nil
+}
+
+// ListSecretsIn lists the names directly below the path in the metadata of the kv mount, a folder ends in a /
+func (v *VaultBackend) ListSecretsIn(path string) ([]string, error) {
+	vaultPath := fmt.Sprintf("%s/metadata/%s", v.mount, strings.Trim(path, "/"))
+	secret, err := v.connection.Logical().List(vaultPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list secrets in %s: %w", path, err)
+	}
+
+	if secret == nil || secret.Data == nil {
+		return nil, nil
+	}
+
+	keys, ok := secret.Data["keys"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected data format when listing secrets in %s", path)
+	}
+
+	names := make([]string, 0, len(keys))
+	for _, key := range keys {
+		name, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected key %v when listing secrets in %s", key, path)
+		}
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// HealthStatus returns the sys/health response of vault, a sealed, uninitialised or standby vault is not an error
+func (v *VaultBackend) HealthStatus(ctx context.Context) (*api.HealthResponse, error) {
+	response, err := v.connection.Sys().HealthWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the health of vault: %w", err)
+	}
+
+	return response, nil
+}
+
+// LookupAccessor is false for an accessor vault no longer knows, a one time token is gone from the moment it was used.
+// Vault answers an unknown accessor with a bad request, any other failure is an error
+func (v *VaultBackend) LookupAccessor(accessor string) (bool, error) {
+	_, err := v.connection.Auth().Token().LookupAccessor(accessor)
+	if err == nil {
+		return true, nil
+	}
+
+	var responseErr *api.ResponseError
+	if errors.As(err, &responseErr) && responseErr.StatusCode == http.StatusBadRequest {
+		return false, nil
+	}
+
+	return false, fmt.Errorf("unable to look up token accessor: %w", err)
+}
+
+// CreateTokenWithOptions creates a token that cannot be renewed, see CreateTokenWithAccessor
+func (v *VaultBackend) CreateTokenWithOptions(policies []string, ttl string, numUses int) (string, error) {
+	token, _, err := v.CreateTokenWithAccessor(policies, ttl, numUses)
+	return token, err
+}
+
+// CreateTokenWithAccessor creates a token that cannot be renewed and returns its accessor with it, vault lowers a ttl
+// above the maximum of the token mount without an error so such a token is revoked and refused rather than handed
+// out with a shorter life
+func (v *VaultBackend) CreateTokenWithAccessor(policies []string, ttl string, numUses int) (string, string, error) {
+	if ttl == "" {
+		ttl = vaultTokenTTL
+	}
+	if numUses == 0 {
+		numUses = vaultTokenUses
+	}
+
+	requested, err := time.ParseDuration(ttl)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid token ttl %s: %w", ttl, err)
+	}
+
+	renewable := false
+	response, err := v.connection.Auth().Token().Create(&api.TokenCreateRequest{
+		Policies:    policies,
+		TTL:         ttl,
+		NumUses:     numUses,
+		DisplayName: vaultTokenDisplayName,
+		Renewable:   &renewable,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	if response == nil || response.Auth == nil {
+		return "", "", fmt.Errorf("vault returned no token")
+	}
+
+	granted := time.Duration(response.Auth.LeaseDuration) * time.Second
+	if granted < requested {
+		if err := v.connection.Auth().Token().RevokeTree(response.Auth.ClientToken); err != nil {
+			return "", "", fmt.Errorf("vault granted a ttl of %s instead of %s and the token could not be revoked: %w", granted, requested, err)
+		}
+
+		return "", "", fmt.Errorf("vault granted a ttl of %s instead of %s", granted, requested)
+	}
+
+	return response.Auth.ClientToken, response.Auth.Accessor, nil
+}
+
+// WrapToken puts the token in a response wrapping token through sys/wrapping/wrap, the pod gets the token back
+// from sys/wrapping/unwrap as the token field of the data
+func (v *VaultBackend) WrapToken(token string, ttl time.Duration) (string, error) {
+	client, err := v.connection.Clone()
+	if err != nil {
+		return "", err
+	}
+
+	client.SetToken(v.connection.Token())
+	client.SetWrappingLookupFunc(func(operation, path string) string {
+		return ttl.String()
+	})
+
+	secret, err := client.Logical().Write("sys/wrapping/wrap", map[string]interface{}{"token": token})
+	if err != nil {
+		return "", fmt.Errorf("unable to wrap token: %w", err)
+	}
+
+	if secret == nil || secret.WrapInfo == nil || secret.WrapInfo.Token == "" {
+		return "", fmt.Errorf("vault did not return a wrapping token")
+	}
+
+	if granted := time.Duration(secret.WrapInfo.TTL) * time.Second; granted < ttl {
+		return "", fmt.Errorf("vault wrapped the token for %s instead of %s", granted, ttl)
+	}
+
+	return secret.WrapInfo.Token, nil
+}
@@ -0,0 +1,212 @@
+package lawgiver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/hashicorp/vault/api"
+	"github.com/odysseia-greek/agora/diogenes"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestVaultBackend(t *testing.T) {
+	newBackend := func(t *testing.T, handler http.HandlerFunc) *VaultBackend {
+		server := httptest.NewServer(handler)
+		t.Cleanup(server.Close)
+
+		client, err := diogenes.NewVaultClient(server.URL, "root", nil)
+		assert.Nil(t, err)
+		backend, err := NewVaultBackend(client)
+		assert.Nil(t, err)
+		return backend
+	}
+
+	respond := func(w http.ResponseWriter, data map[string]interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}
+
+	t.Run("ListSecretsIn", func(t *testing.T) {
+		backend := newBackend(t, func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/v1/configs/metadata/test", r.URL.Path)
+			assert.Equal(t, "true", r.URL.Query().Get("list"))
+			respond(w, map[string]interface{}{"keys": []string{"platon", "sokrates", "nested/"}})
+		})
+
+		names, err := backend.ListSecretsIn("test/")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"platon", "sokrates", "nested/"}, names)
+	})
+
+	t.Run("ListSecretsInAnEmptyPath", func(t *testing.T) {
+		backend := newBackend(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		})
+
+		names, err := backend.ListSecretsIn("staging")
+		assert.Nil(t, err)
+		assert.Empty(t, names)
+	})
+
+	t.Run("ListSecretsInFails", func(t *testing.T) {
+		backend := newBackend(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		})
+
+		_, err := backend.ListSecretsIn("test")
+		assert.ErrorContains(t, err, "unable to list secrets in test")
+	})
+
+	t.Run("GetSecretThatDoesNotExist", func(t *testing.T) {
+		backend := newBackend(t, func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/v1/configs/data/test/sokrates", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		})
+
+		secret, err := backend.GetSecret("test/sokrates")
+		assert.Nil(t, err)
+		assert.Nil(t, secret)
+	})
+
+	t.Run("HealthStatus", func(t *testing.T) {
+		backend := newBackend(t, func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/v1/sys/health", r.URL.Path)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(299)
+			json.NewEncoder(w).Encode(api.HealthResponse{Initialized: true, Sealed: true, Version: "1.17.2"})
+		})
+
+		sut, err := backend.HealthStatus(context.Background())
+		assert.Nil(t, err)
+		assert.True(t, sut.Sealed)
+		assert.Equal(t, "1.17.2", sut.Version)
+	})
+
+	t.Run("LookupAccessor", func(t *testing.T) {
+		backend := newBackend(t, func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/v1/auth/token/lookup-accessor", r.URL.Path)
+
+			var body map[string]string
+			assert.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+			switch body["accessor"] {
+			case "valid":
+				respond(w, map[string]interface{}{"num_uses": 1})
+			case "used":
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{"invalid accessor"}})
+			case "denied":
+				w.WriteHeader(http.StatusForbidden)
+			default:
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		})
+
+		valid, err := backend.LookupAccessor("valid")
+		assert.Nil(t, err)
+		assert.True(t, valid)
+
+		valid, err = backend.LookupAccessor("used")
+		assert.Nil(t, err)
+		assert.False(t, valid)
+
+		_, err = backend.LookupAccessor("denied")
+		assert.NotNil(t, err, "solon not being allowed to look up a token says nothing about the token")
+
+		_, err = backend.LookupAccessor("sealed")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("CreateTokenWithOptions", func(t *testing.T) {
+		var revoked []string
+		backend := newBackend(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.URL.Path {
+			case "/v1/auth/token/create":
+				var request api.TokenCreateRequest
+				assert.Nil(t, json.NewDecoder(r.Body).Decode(&request))
+				assert.False(t, *request.Renewable)
+
+				// the token mount caps the ttl at ten minutes
+				granted, err := time.ParseDuration(request.TTL)
+				assert.Nil(t, err)
+				granted = min(granted, 10*time.Minute)
+				json.NewEncoder(w).Encode(map[string]interface{}{"auth": map[string]interface{}{
+					"client_token":   fmt.Sprintf("s.%s.%d", request.TTL, request.NumUses),
+					"accessor":       fmt.Sprintf("accessor.%s.%d", request.TTL, request.NumUses),
+					"lease_duration": int(granted.Seconds()),
+				}})
+			case "/v1/auth/token/revoke":
+				var body map[string]string
+				assert.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+				revoked = append(revoked, body["token"])
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		})
+
+		token, err := backend.CreateTokenWithOptions([]string{"policy.test.sokrates"}, "10m", 3)
+		assert.Nil(t, err)
+		assert.Equal(t, "s.10m.3", token)
+
+		token, err = backend.CreateTokenWithOptions([]string{"policy.test.sokrates"}, "", 0)
+		assert.Nil(t, err)
+		assert.Equal(t, "s.5m.1", token, "what is not set is taken from the one time token")
+
+		token, accessor, err := backend.CreateTokenWithAccessor([]string{"policy.test.sokrates"}, "", 1)
+		assert.Nil(t, err)
+		assert.Equal(t, "s.5m.1", token)
+		assert.Equal(t, "accessor.5m.1", accessor)
+
+		_, err = backend.CreateTokenWithOptions([]string{"policy.test.sokrates"}, "1h", 1)
+		assert.ErrorContains(t, err, "instead of 1h0m0s")
+		assert.Equal(t, []string{"s.1h.1"}, revoked, "a token with a shorter ttl is not left behind")
+	})
+
+	t.Run("WrapToken", func(t *testing.T) {
+		backend := newBackend(t, func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/v1/sys/wrapping/wrap", r.URL.Path)
+			assert.Equal(t, "root", r.Header.Get("X-Vault-Token"))
+
+			var body map[string]string
+			assert.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+			assert.Equal(t, "s.sokrates", body["token"])
+
+			ttl, err := time.ParseDuration(r.Header.Get("X-Vault-Wrap-TTL"))
+			assert.Nil(t, err)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{"wrap_info": map[string]interface{}{
+				"token": "hvs.wrapped",
+				"ttl":   int(min(ttl, 5*time.Minute).Seconds()),
+			}})
+		})
+
+		wrapped, err := backend.WrapToken("s.sokrates", time.Minute)
+		assert.Nil(t, err)
+		assert.Equal(t, "hvs.wrapped", wrapped)
+
+		_, err = backend.WrapToken("s.sokrates", time.Hour)
+		assert.ErrorContains(t, err, "instead of 1h0m0s")
+	})
+
+	t.Run("OnlyTheVaultClient", func(t *testing.T) {
+		_, err := NewVaultBackend(&diogenes.Vault{})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("RegistrationsNeedALister", func(t *testing.T) {
+		handler := &SolonHandler{
+			Vault:     struct{ SecretBackend }{NewMemoryBackend()},
+			Namespace: "test",
+		}
+		_, err := handler.Vault.CreateNewSecret("test/sokrates", []byte(`{"data":{"elasticUsername":"sokrates"}}`))
+		assert.Nil(t, err)
+
+		_, err = handler.listRegistrations()
+		assert.ErrorContains(t, err, "cannot list the secrets in test")
+	})
+}
@@ -0,0 +1,134 @@
+package lawgiver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	plato "github.com/odysseia-greek/agora/plato/config"
+	"github.com/odysseia-greek/agora/plato/logging"
+	"github.com/odysseia-greek/agora/plato/middleware"
+	delphi "github.com/odysseia-greek/delphi/solon/models"
+	"net/http"
+	"time"
+)
+
+const (
+	// EnvShutdownDelay is how long solon keeps serving after it turned unready, endpoints are removed from services
+	// and load balancers asynchronously and requests keep arriving until they have caught up
+	EnvShutdownDelay     string = "SOLON_SHUTDOWN_DELAY"
+	defaultShutdownDelay string = "5s"
+
+	readyCheckShutdown string = "shutdown"
+	readyCheckPodCache string = "podCache"
+	readyCheckVault    string = "vault"
+	readyCheckElastic  string = "elastic"
+)
+
+// Ready reports if solon can take requests: the pod cache has synced and vault and elastic are reachable.
+// Health is the liveness check, Ready turns unready as soon as a shutdown starts so no new requests are routed here
+func (s *SolonHandler) Ready(w http.ResponseWriter, req *http.Request) {
+	requestId := req.Header.Get(plato.HeaderKey)
+	w.Header().Set(plato.HeaderKey, requestId)
+
+	response := delphi.ReadyResponse{Ready: true}
+	check := func(name string, err error) {
+		result := delphi.ReadyCheck{Name: name, Ready: err == nil}
+		if err != nil {
+			result.Error = err.Error()
+			response.Ready = false
+		}
+		response.Checks = append(response.Checks, result)
+	}
+
+	if s.shuttingDown.Load() {
+		check(readyCheckShutdown, errors.New("solon is shutting down"))
+	}
+
+	check(readyCheckPodCache, s.podCacheReady())
+	check(readyCheckVault, s.vaultReady())
+	check(readyCheckElastic, s.elasticReady())
+
+	code := http.StatusOK
+	if !response.Ready {
+		code = http.StatusServiceUnavailable
+	}
+
+	middleware.ResponseWithCustomCode(w, code, response)
+}
+
+func (s *SolonHandler) podCacheReady() error {
+	if s.Pods == nil || !s.Pods.HasSynced() {
+		return errPodCacheNotSynced
+	}
+
+	return nil
+}
+
+func (s *SolonHandler) vaultReady() error {
+	healthy, err := s.Vault.Health()
+	if err != nil {
+		return err
+	}
+
+	if !healthy {
+		return errors.New("vault is not healthy")
+	}
+
+	return nil
+}
+
+func (s *SolonHandler) elasticReady() error {
+	info := s.Elastic.Health().Info()
+	if !info.Healthy {
+		return errors.New("elasticsearch is not healthy")
+	}
+
+	return nil
+}
+
+// StopServing marks solon as unready, in-flight requests are still served while the server drains
+func (s *SolonHandler) StopServing() {
+	s.shuttingDown.Store(true)
+	logging.System("marked as not ready, draining in-flight requests")
+}
+
+// AwaitEndpointRemoval waits out the ShutdownDelay after StopServing so the server is only shut down once no new
+// requests are routed here, it returns early when the context is done
+func (s *SolonHandler) AwaitEndpointRemoval(ctx context.Context) {
+	if s.ShutdownDelay <= 0 {
+		return
+	}
+
+	logging.System(fmt.Sprintf("waiting %s for the endpoint to be removed before draining", s.ShutdownDelay))
+
+	timer := time.NewTimer(s.ShutdownDelay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// Close closes the trace stream, stops the informers, drops the pending cleanups and writes the queued audit events,
+// it is called once every request has drained. The trace stream is closed before the context it was opened on is cancelled
+func (s *SolonHandler) Close() {
+	err := s.tracer().Close()
+	if err != nil {
+		logging.Error(fmt.Sprintf("failed to close trace stream: %s", err.Error()))
+	}
+
+	if s.Cancel != nil {
+		s.Cancel()
+	}
+
+	s.Cleanup.Stop()
+
+	if s.Informers != nil {
+		s.Informers.Shutdown()
+	}
+
+	s.Audit.Close()
+
+	logging.System("informers stopped, audit events written and trace stream closed")
+}
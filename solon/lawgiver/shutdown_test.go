@@ -0,0 +1,121 @@
+package lawgiver
+
+import (
+	"context"
+	"encoding/json"
+	elastic "github.com/odysseia-greek/agora/aristoteles"
+	delphi "github.com/odysseia-greek/delphi/solon/models"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestReady(t *testing.T) {
+	newTestHandler := func(t *testing.T) *SolonHandler {
+		mockElasticClient, err := elastic.NewMockClient("info", 200)
+		assert.Nil(t, err)
+
+		return &SolonHandler{
+			Vault:   &fakeVault{},
+			Elastic: mockElasticClient,
+			Pods:    newTestPodCache(),
+		}
+	}
+
+	readyResponse := func(t *testing.T, handler *SolonHandler) (int, delphi.ReadyResponse) {
+		router := InitRoutes(handler)
+		response := performGetRequest(router, "/solon/v1/ready")
+
+		var sut delphi.ReadyResponse
+		err := json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+		return response.Code, sut
+	}
+
+	t.Run("Ready", func(t *testing.T) {
+		code, sut := readyResponse(t, newTestHandler(t))
+		assert.Equal(t, http.StatusOK, code)
+		assert.True(t, sut.Ready)
+		assert.Len(t, sut.Checks, 3)
+	})
+
+	t.Run("CacheNotSynced", func(t *testing.T) {
+		handler := newTestHandler(t)
+		handler.Pods.hasSynced = func() bool { return false }
+
+		code, sut := readyResponse(t, handler)
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.False(t, sut.Ready)
+		assert.Equal(t, delphi.ReadyCheck{Name: readyCheckPodCache, Error: errPodCacheNotSynced.Error()}, sut.Checks[0])
+	})
+
+	t.Run("VaultUnreachable", func(t *testing.T) {
+		handler := newTestHandler(t)
+		handler.Vault = &fakeVault{down: true}
+
+		code, sut := readyResponse(t, handler)
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, "connection refused", sut.Checks[1].Error)
+	})
+
+	t.Run("UnreadyOnceShutdownStarts", func(t *testing.T) {
+		handler := newTestHandler(t)
+		handler.StopServing()
+
+		code, sut := readyResponse(t, handler)
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, readyCheckShutdown, sut.Checks[0].Name)
+
+		router := InitRoutes(handler)
+		response := performGetRequest(router, "/solon/v1/health")
+		assert.Equal(t, http.StatusOK, response.Code)
+	})
+
+	t.Run("AwaitEndpointRemoval", func(t *testing.T) {
+		handler := newTestHandler(t)
+		handler.ShutdownDelay = 50 * time.Millisecond
+
+		started := time.Now()
+		handler.AwaitEndpointRemoval(context.Background())
+		assert.GreaterOrEqual(t, time.Since(started), handler.ShutdownDelay)
+
+		handler.ShutdownDelay = time.Hour
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		started = time.Now()
+		handler.AwaitEndpointRemoval(ctx)
+		assert.Less(t, time.Since(started), time.Second, "the shutdown timeout cuts the delay short")
+	})
+
+	t.Run("TraceStreamClosedBeforeCancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		tracer := &closingTracer{Tracer: NewNoopTracer(nil), ctx: ctx}
+		handler := &SolonHandler{Tracer: tracer, Cancel: cancel}
+
+		handler.Close()
+		assert.True(t, tracer.closed)
+		assert.Nil(t, tracer.closedErr, "the stream was still open when it was closed")
+		assert.NotNil(t, ctx.Err())
+	})
+
+	t.Run("CloseWithoutDependencies", func(t *testing.T) {
+		handler := &SolonHandler{}
+		assert.NotPanics(t, handler.Close)
+	})
+}
+
+// closingTracer records if the context its stream was opened on was still alive when it was closed
+type closingTracer struct {
+	Tracer
+	ctx       context.Context
+	closed    bool
+	closedErr error
+}
+
+func (s *closingTracer) Close() error {
+	s.closed = true
+	s.closedErr = s.ctx.Err()
+	return s.closedErr
+}
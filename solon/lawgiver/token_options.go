@@ -0,0 +1,163 @@
+package lawgiver
+
+import (
+	"fmt"
+	"github.com/odysseia-greek/delphi/solon/docs"
+	delphi "github.com/odysseia-greek/delphi/solon/models"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// EnvTokenMaxTTL and EnvTokenMaxUses cap the ttl and use count a pod can ask for, a policy template can only lower them
+	EnvTokenMaxTTL  string = "SOLON_TOKEN_MAX_TTL"
+	EnvTokenMaxUses string = "SOLON_TOKEN_MAX_USES"
+	// EnvTokenWrapTTL is how long a response wrapping token can be unwrapped
+	EnvTokenWrapTTL string = "SOLON_TOKEN_WRAP_TTL"
+
+	defaultTokenMaxTTL  string = "1h"
+	defaultTokenMaxUses string = "10"
+	defaultTokenWrapTTL string = "1m"
+
+	tokenQueryTTL     string = "ttl"
+	tokenQueryNumUses string = "numUses"
+	tokenQueryWrap    string = "wrap"
+)
+
+// tokenQuery documents the query parameters of the token endpoint
+var tokenQuery = []docs.Parameter{
+	{Name: tokenQueryTTL, Description: "Lifetime of the token as a duration, at most the maximum of solon and the policy template", Schema: &docs.Schema{Type: "string"}},
+	{Name: tokenQueryNumUses, Description: "Number of times the token can be used, at most the maximum of solon and the policy template", Schema: &docs.Schema{Type: "integer"}},
+	{Name: tokenQueryWrap, Description: "Return a single use response wrapping token instead of the token", Schema: &docs.Schema{Type: "boolean"}},
+}
+
+// defaultTokenLimits are used by a handler without TokenLimits
+var defaultTokenLimits = TokenLimits{MaxTTL: time.Hour, MaxUses: 10, WrapTTL: time.Minute}
+
+// TokenLimits are the server side maximums of the options a pod can set on its token
+type TokenLimits struct {
+	MaxTTL  time.Duration
+	MaxUses int
+	WrapTTL time.Duration
+}
+
+// tokenOptions is what a single token is created with, an empty TTL and zero NumUses leave it to the backend
+type tokenOptions struct {
+	TTL     string
+	NumUses int
+	Wrap    bool
+}
+
+func tokenLimitsFromEnv(maxTTL, maxUses, wrapTTL string) (*TokenLimits, error) {
+	ttl, err := time.ParseDuration(maxTTL)
+	if err != nil || ttl <= 0 {
+		return nil, fmt.Errorf("invalid %s %q, expected a positive duration", EnvTokenMaxTTL, maxTTL)
+	}
+
+	uses, err := strconv.Atoi(maxUses)
+	if err != nil || uses <= 0 {
+		return nil, fmt.Errorf("invalid %s %q, expected a positive number", EnvTokenMaxUses, maxUses)
+	}
+
+	wrap, err := time.ParseDuration(wrapTTL)
+	if err != nil || wrap <= 0 {
+		return nil, fmt.Errorf("invalid %s %q, expected a positive duration", EnvTokenWrapTTL, wrapTTL)
+	}
+
+	return &TokenLimits{MaxTTL: ttl, MaxUses: uses, WrapTTL: wrap}, nil
+}
+
+// options reads the ttl, numUses and wrap query parameters of a token request, what a pod does not ask for
+// comes from the template. A value above the limits or the template is refused rather than lowered so a pod
+// does not end up with a token that expires before it expects
+func (l *TokenLimits) options(query url.Values, tpl *PolicyTemplate) (tokenOptions, error) {
+	if l == nil {
+		l = &defaultTokenLimits
+	}
+
+	opts := tokenOptions{TTL: tpl.TTL, NumUses: tpl.NumUses}
+
+	if value := query.Get(tokenQueryTTL); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			return opts, newSolonError(delphi.ErrorCodeInvalidRequest, tokenQueryTTL, fmt.Errorf("invalid ttl %q, expected a positive duration", value))
+		}
+
+		maxTTL := l.MaxTTL
+		if templateTTL := tpl.ttl(); templateTTL > 0 && templateTTL < maxTTL {
+			maxTTL = templateTTL
+		}
+
+		if ttl > maxTTL {
+			return opts, newSolonError(delphi.ErrorCodeInvalidRequest, tokenQueryTTL, fmt.Errorf("ttl %s exceeds the maximum of %s", ttl, maxTTL))
+		}
+
+		opts.TTL = ttl.String()
+	}
+
+	if value := query.Get(tokenQueryNumUses); value != "" {
+		uses, err := strconv.Atoi(value)
+		if err != nil || uses <= 0 {
+			return opts, newSolonError(delphi.ErrorCodeInvalidRequest, tokenQueryNumUses, fmt.Errorf("invalid numUses %q, expected a positive number", value))
+		}
+
+		maxUses := l.MaxUses
+		if tpl.NumUses > 0 && tpl.NumUses < maxUses {
+			maxUses = tpl.NumUses
+		}
+
+		if uses > maxUses {
+			return opts, newSolonError(delphi.ErrorCodeInvalidRequest, tokenQueryNumUses, fmt.Errorf("numUses %d exceeds the maximum of %d", uses, maxUses))
+		}
+
+		opts.NumUses = uses
+	}
+
+	if value := query.Get(tokenQueryWrap); value != "" {
+		wrap, err := strconv.ParseBool(value)
+		if err != nil {
+			return opts, newSolonError(delphi.ErrorCodeInvalidRequest, tokenQueryWrap, fmt.Errorf("invalid wrap %q, expected true or false", value))
+		}
+
+		opts.Wrap = wrap
+	}
+
+	return opts, nil
+}
+
+// wrapTTL is how long the wrapping token of a wrapped response lives
+func (l *TokenLimits) wrapTTL() time.Duration {
+	if l == nil {
+		return defaultTokenLimits.WrapTTL
+	}
+
+	return l.WrapTTL
+}
+
+// ttl is the lifetime of a token created with the options, zero when the backend decides
+func (o tokenOptions) ttl() time.Duration {
+	ttl, err := time.ParseDuration(o.TTL)
+	if err != nil {
+		return 0
+	}
+
+	return ttl
+}
+
+// String describes the options a token was created with for the audit log, it is empty for the defaults
+func (o tokenOptions) String() string {
+	var described []string
+	if o.TTL != "" {
+		described = append(described, fmt.Sprintf("ttl %s", o.TTL))
+	}
+	if o.NumUses != 0 {
+		described = append(described, fmt.Sprintf("%d uses", o.NumUses))
+	}
+	if o.Wrap {
+		described = append(described, "wrapped")
+	}
+
+	return strings.Join(described, ", ")
+}
@@ -0,0 +1,158 @@
+package lawgiver
+
+import (
+	"encoding/json"
+	delphi "github.com/odysseia-greek/delphi/solon/models"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestTokenOptions(t *testing.T) {
+	ns := "test"
+	podName := "sokrates-5d8f7c9b4-abcde"
+
+	t.Run("FromEnv", func(t *testing.T) {
+		limits, err := tokenLimitsFromEnv(defaultTokenMaxTTL, defaultTokenMaxUses, defaultTokenWrapTTL)
+		assert.Nil(t, err)
+		assert.Equal(t, defaultTokenLimits, *limits)
+
+		_, err = tokenLimitsFromEnv("forever", defaultTokenMaxUses, defaultTokenWrapTTL)
+		assert.ErrorContains(t, err, EnvTokenMaxTTL)
+
+		_, err = tokenLimitsFromEnv(defaultTokenMaxTTL, "0", defaultTokenWrapTTL)
+		assert.ErrorContains(t, err, EnvTokenMaxUses)
+
+		_, err = tokenLimitsFromEnv(defaultTokenMaxTTL, defaultTokenMaxUses, "-1m")
+		assert.ErrorContains(t, err, EnvTokenWrapTTL)
+	})
+
+	t.Run("Options", func(t *testing.T) {
+		limits := &TokenLimits{MaxTTL: 30 * time.Minute, MaxUses: 5, WrapTTL: time.Minute}
+		capped := &PolicyTemplate{TTL: "10m", NumUses: 2}
+
+		tests := []struct {
+			name     string
+			query    string
+			tpl      *PolicyTemplate
+			expected tokenOptions
+			field    string
+		}{
+			{name: "Defaults", query: "", tpl: &PolicyTemplate{}, expected: tokenOptions{}},
+			{name: "Template", query: "", tpl: capped, expected: tokenOptions{TTL: "10m", NumUses: 2}},
+			{name: "Requested", query: "ttl=20m&numUses=5&wrap=true", tpl: &PolicyTemplate{}, expected: tokenOptions{TTL: "20m0s", NumUses: 5, Wrap: true}},
+			{name: "BelowTheTemplate", query: "ttl=90s&numUses=1", tpl: capped, expected: tokenOptions{TTL: "1m30s", NumUses: 1}},
+			{name: "TTLAboveTheLimit", query: "ttl=2h", tpl: &PolicyTemplate{}, field: tokenQueryTTL},
+			{name: "TTLAboveTheTemplate", query: "ttl=15m", tpl: capped, field: tokenQueryTTL},
+			{name: "InvalidTTL", query: "ttl=soon", tpl: &PolicyTemplate{}, field: tokenQueryTTL},
+			{name: "UsesAboveTheLimit", query: "numUses=6", tpl: &PolicyTemplate{}, field: tokenQueryNumUses},
+			{name: "UsesAboveTheTemplate", query: "numUses=3", tpl: capped, field: tokenQueryNumUses},
+			{name: "UnlimitedUses", query: "numUses=0", tpl: &PolicyTemplate{}, field: tokenQueryNumUses},
+			{name: "InvalidWrap", query: "wrap=please", tpl: &PolicyTemplate{}, field: tokenQueryWrap},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				query, err := url.ParseQuery(tt.query)
+				assert.Nil(t, err)
+
+				sut, err := limits.options(query, tt.tpl)
+				if tt.field == "" {
+					assert.Nil(t, err)
+					assert.Equal(t, tt.expected, sut)
+					return
+				}
+
+				var solonErr *solonError
+				assert.ErrorAs(t, err, &solonErr)
+				assert.Equal(t, delphi.ErrorCodeInvalidRequest, solonErr.Code)
+				assert.Equal(t, tt.field, solonErr.Field)
+			})
+		}
+	})
+
+	t.Run("WrappedToken", func(t *testing.T) {
+		pods := newTestPodCache()
+		assert.Nil(t, addPodForTest(podName, ns, "dictionary", "api", pods))
+
+		backend := NewMemoryBackend()
+		handler := &SolonHandler{
+			Vault:       backend,
+			Pods:        pods,
+			AuthMode:    AuthModeIP,
+			Namespace:   ns,
+			TokenLimits: &TokenLimits{MaxTTL: time.Hour, MaxUses: 3, WrapTTL: time.Minute},
+		}
+
+		router := InitRoutes(handler)
+		response := performGetRequest(router, "/solon/v1/token?ttl=5m&numUses=3&wrap=true")
+		assert.Equal(t, http.StatusOK, response.Code)
+
+		var sut delphi.TokenResponse
+		err := json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+		assert.True(t, sut.Wrapped)
+		assert.Equal(t, "5m0s", sut.TTL)
+		assert.Equal(t, 3, sut.NumUses)
+
+		valid, err := backend.LookupToken(sut.Token)
+		assert.Nil(t, err)
+		assert.False(t, valid, "the wrapping token is not the token itself")
+
+		token, err := backend.UnwrapToken(sut.Token)
+		assert.Nil(t, err)
+		valid, err = backend.LookupToken(token)
+		assert.Nil(t, err)
+		assert.True(t, valid)
+
+		_, err = backend.UnwrapToken(sut.Token)
+		assert.NotNil(t, err, "a wrapping token can be unwrapped once")
+	})
+
+	t.Run("BackendCannotWrap", func(t *testing.T) {
+		pods := newTestPodCache()
+		assert.Nil(t, addPodForTest(podName, ns, "dictionary", "api", pods))
+
+		vault := &fakeVault{}
+		handler := &SolonHandler{
+			Vault:     vault,
+			Pods:      pods,
+			AuthMode:  AuthModeIP,
+			Namespace: ns,
+		}
+
+		router := InitRoutes(handler)
+		response := performGetRequest(router, "/solon/v1/token?wrap=true")
+
+		var sut delphi.SolonError
+		err := json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+		assert.Equal(t, tokenQueryWrap, sut.Field)
+		assert.Empty(t, vault.tokens, "no token is created that cannot be handed out")
+	})
+
+	t.Run("AboveTheLimit", func(t *testing.T) {
+		pods := newTestPodCache()
+		assert.Nil(t, addPodForTest(podName, ns, "dictionary", "api", pods))
+
+		handler := &SolonHandler{
+			Vault:     NewMemoryBackend(),
+			Pods:      pods,
+			AuthMode:  AuthModeIP,
+			Namespace: ns,
+		}
+
+		router := InitRoutes(handler)
+		response := performGetRequest(router, "/solon/v1/token?ttl=24h")
+
+		var sut delphi.SolonError
+		err := json.NewDecoder(response.Body).Decode(&sut)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+		assert.Equal(t, delphi.ErrorCodeInvalidRequest, sut.Code)
+		assert.Contains(t, sut.Message, "exceeds the maximum of 1h0m0s")
+	})
+}
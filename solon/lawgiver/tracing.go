@@ -0,0 +1,137 @@
+package lawgiver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/odysseia-greek/agora/plato/logging"
+	"github.com/odysseia-greek/agora/plato/middleware"
+	aristophanes "github.com/odysseia-greek/attike/aristophanes/comedy"
+	pb "github.com/odysseia-greek/attike/aristophanes/proto"
+	"net/http"
+)
+
+const (
+	EnvTracingMode string = "SOLON_TRACING_MODE"
+
+	// TracingModeRequired refuses to start without a healthy tracer
+	TracingModeRequired string = "required"
+	// TracingModeDegraded starts without tracing when the tracer cannot be reached and logs a warning
+	TracingModeDegraded string = "degraded"
+	// TracingModeDisabled never connects to a tracer
+	TracingModeDisabled string = "disabled"
+
+	defaultTracingMode string = TracingModeRequired
+)
+
+// Tracer sends the traces of requests to aristophanes
+type Tracer interface {
+	// Middleware traces every request to a route
+	Middleware() middleware.Adapter
+	// Health returns why traces are not being sent, nil when they are or when tracing is disabled on purpose
+	Health(ctx context.Context) error
+	Close() error
+}
+
+// newTracer connects to the tracer at address, depending on the mode a tracer that cannot be reached stops startup
+// or is replaced by a no-op tracer
+func newTracer(ctx context.Context, mode, address string) (Tracer, error) {
+	switch mode {
+	case TracingModeDisabled:
+		logging.System("tracing disabled")
+		return NewNoopTracer(nil), nil
+	case TracingModeRequired, TracingModeDegraded:
+	default:
+		return nil, fmt.Errorf("unknown tracing mode %s, expected %s, %s or %s", mode, TracingModeRequired, TracingModeDegraded, TracingModeDisabled)
+	}
+
+	tracer, err := newStreamTracer(ctx, address)
+	if err == nil {
+		return tracer, nil
+	}
+
+	if mode == TracingModeRequired {
+		return nil, err
+	}
+
+	logging.Warn(fmt.Sprintf("running without tracing: %s", err.Error()))
+	return NewNoopTracer(err), nil
+}
+
+// streamTracer streams traces to the aristophanes sidecar
+type streamTracer struct {
+	client *aristophanes.ClientTracer
+	stream pb.TraceService_ChorusClient
+}
+
+func newStreamTracer(ctx context.Context, address string) (*streamTracer, error) {
+	client, err := aristophanes.NewClientTracer(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if !client.WaitForHealthyState() {
+		return nil, errors.New("tracing service not ready")
+	}
+
+	stream, err := client.Chorus(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trace stream: %w", err)
+	}
+
+	return &streamTracer{client: client, stream: stream}, nil
+}
+
+func (t *streamTracer) Middleware() middleware.Adapter {
+	return middleware.Adapter(aristophanes.TraceWithLogAndSpan(t.stream))
+}
+
+func (t *streamTracer) Health(ctx context.Context) error {
+	response, err := t.client.HealthCheck(ctx, &pb.Empty{})
+	if err != nil {
+		return err
+	}
+
+	if !response.Status {
+		return errors.New("tracing service reports unhealthy")
+	}
+
+	return nil
+}
+
+func (t *streamTracer) Close() error {
+	_, err := t.stream.CloseAndRecv()
+	return err
+}
+
+// NoopTracer drops every trace, degraded holds the reason the real tracer could not be used
+type NoopTracer struct {
+	degraded error
+}
+
+func NewNoopTracer(degraded error) *NoopTracer {
+	return &NoopTracer{degraded: degraded}
+}
+
+func (n *NoopTracer) Middleware() middleware.Adapter {
+	return func(f http.HandlerFunc) http.HandlerFunc {
+		return f
+	}
+}
+
+func (n *NoopTracer) Health(ctx context.Context) error {
+	return n.degraded
+}
+
+func (n *NoopTracer) Close() error {
+	return nil
+}
+
+// tracer falls back to the no-op tracer when none is configured
+func (s *SolonHandler) tracer() Tracer {
+	if s.Tracer == nil {
+		return NewNoopTracer(nil)
+	}
+
+	return s.Tracer
+}
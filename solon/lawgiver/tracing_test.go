@@ -0,0 +1,50 @@
+package lawgiver
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTracer(t *testing.T) {
+	t.Run("DisabledUsesTheNoopTracer", func(t *testing.T) {
+		sut, err := newTracer(context.Background(), TracingModeDisabled, "localhost:0")
+		assert.Nil(t, err)
+		assert.IsType(t, &NoopTracer{}, sut)
+		assert.Nil(t, sut.Health(context.Background()))
+	})
+
+	t.Run("UnknownModeFails", func(t *testing.T) {
+		_, err := newTracer(context.Background(), "sometimes", "localhost:0")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("DegradedReportsWhyTracingIsOff", func(t *testing.T) {
+		reason := errors.New("tracing service not ready")
+		sut := NewNoopTracer(reason)
+		assert.Equal(t, reason, sut.Health(context.Background()))
+		assert.Nil(t, sut.Close())
+	})
+
+	t.Run("NoopMiddlewarePassesRequestsThrough", func(t *testing.T) {
+		called := false
+		handler := NewNoopTracer(nil).Middleware()(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			w.WriteHeader(http.StatusTeapot)
+		})
+
+		recorder := httptest.NewRecorder()
+		handler(recorder, httptest.NewRequest(http.MethodGet, "/solon/v1/token", nil))
+		assert.True(t, called)
+		assert.Equal(t, http.StatusTeapot, recorder.Code)
+	})
+
+	t.Run("HandlerWithoutTracerFallsBackToNoop", func(t *testing.T) {
+		handler := &SolonHandler{}
+		assert.IsType(t, &NoopTracer{}, handler.tracer())
+		assert.Nil(t, handler.tracer().Close())
+	})
+}
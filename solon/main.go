@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"github.com/gorilla/mux"
 	"github.com/odysseia-greek/agora/plato/logging"
@@ -12,13 +13,18 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 	"time"
 )
 
 const defaultPort = ":5443"
 const SolonService string = "solon"
 
+// shutdownTimeout is how long the endpoint removal and in-flight requests get after a SIGTERM, it stays below the default grace period of a pod
+const shutdownTimeout = 25 * time.Second
+
 var currentTLSConfig *tls.Config
 
 func main() {
@@ -26,10 +32,11 @@ func main() {
 
 	logBanner()
 
-	ctx := context.Background()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
 
-	// Initialize Solon handler
-	solonHandler, err := lawgiver.CreateNewConfig(ctx)
+	// Initialize Solon handler, the trace stream is not bound to the signal so requests that are draining can still be traced
+	solonHandler, err := lawgiver.CreateNewConfig(context.Background())
 	if err != nil {
 		logging.Error(fmt.Sprintf("Failed to initialize Solon handler: %v", err))
 		log.Fatal("Startup failure")
@@ -41,17 +48,38 @@ func main() {
 	logging.System(fmt.Sprintf("Running on port: %s", port))
 
 	go func() {
-		err := solonHandler.StartWatching()
+		err := solonHandler.StartWatching(ctx)
 		if err != nil {
 			logging.Error(fmt.Sprintf("Failed to start watching deployments and pods: %v", err))
 		}
 	}()
 
+	go solonHandler.StartReconciling(ctx)
+	go solonHandler.StartRenewingLeases(ctx)
+
+	var server *http.Server
 	if solonHandler.TLSEnabled {
-		startTLSServer(port, srv)
+		server = startTLSServer(port, srv, solonHandler.RequireClientCert)
 	} else {
-		startHTTPServer(port, srv)
+		server = startHTTPServer(port, srv)
+	}
+
+	<-ctx.Done()
+	logging.System("Shutdown signal received")
+
+	// the delay before draining counts towards the timeout so the whole shutdown stays within the grace period
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	solonHandler.StopServing()
+	solonHandler.AwaitEndpointRemoval(shutdownCtx)
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logging.Error(fmt.Sprintf("Failed to drain in-flight requests: %v", err))
 	}
+
+	solonHandler.Close()
+	logging.System("Shutdown complete")
 }
 
 func logBanner() {
@@ -77,15 +105,24 @@ func getEnv(key, fallback string) string {
 	return value
 }
 
-func startHTTPServer(port string, srv *mux.Router) {
-	logging.System("Starting HTTP server...")
-	if err := http.ListenAndServe(port, srv); err != nil {
-		logging.Error(fmt.Sprintf("HTTP server error: %v", err))
-		log.Fatal("Server shutdown")
+func startHTTPServer(port string, srv *mux.Router) *http.Server {
+	server := &http.Server{
+		Addr:    port,
+		Handler: srv,
 	}
+
+	logging.System("Starting HTTP server...")
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Error(fmt.Sprintf("HTTP server error: %v", err))
+			log.Fatal("Server shutdown")
+		}
+	}()
+
+	return server
 }
 
-func startTLSServer(port string, srv *mux.Router) {
+func startTLSServer(port string, srv *mux.Router, requireClientCert bool) *http.Server {
 	gracePeriod := 1 * time.Hour
 	pollInterval := 5 * time.Minute
 
@@ -118,19 +155,36 @@ func startTLSServer(port string, srv *mux.Router) {
 	// Start watching for certificate changes
 	tlsManager.WatchCertificates(pollInterval)
 
+	if requireClientCert {
+		logging.System(fmt.Sprintf("client certificates signed by the ca in %s are required", caPath))
+	}
+
 	// Create and configure the HTTPS server
 	server := &http.Server{
 		Addr:    port,
 		Handler: srv,
 		TLSConfig: &tls.Config{
 			GetConfigForClient: func(clientHello *tls.ClientHelloInfo) (*tls.Config, error) {
-				return tlsManager.GetTLSConfig(), nil
+				if !requireClientCert {
+					return tlsManager.GetTLSConfig(), nil
+				}
+
+				// a certificate is verified when given but not demanded in the handshake, probes reach health and metrics
+				// without one and the routes that identify a pod turn down a request that has none
+				config := tlsManager.GetTLSConfig().Clone()
+				config.ClientCAs = ca
+				config.ClientAuth = tls.VerifyClientCertIfGiven
+				return config, nil
 			},
 		},
 	}
 
 	logging.System("Starting TLS server...")
-	if err := server.ListenAndServeTLS("", ""); err != nil {
-		log.Fatalf("Server error: %v", err)
-	}
+	go func() {
+		if err := server.ListenAndServeTLS("", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server error: %v", err)
+		}
+	}()
+
+	return server
 }
@@ -0,0 +1,57 @@
+package models
+
+import "encoding/json"
+
+// ErrorCode is the stable machine readable reason a request to solon failed, clients should branch on this instead of the message
+type ErrorCode string
+
+const (
+	ErrorCodeInvalidRequest           ErrorCode = "invalid-request"
+	ErrorCodeUnauthenticated          ErrorCode = "unauthenticated"
+	ErrorCodeAdminRequired            ErrorCode = "admin-required"
+	ErrorCodePodNotFound              ErrorCode = "pod-not-found"
+	ErrorCodePodNotServing            ErrorCode = "pod-not-serving"
+	ErrorCodePodNameMismatch          ErrorCode = "pod-name-mismatch"
+	ErrorCodeAnnotationMismatch       ErrorCode = "annotation-mismatch"
+	ErrorCodeRegistrationConflict     ErrorCode = "registration-conflict"
+	ErrorCodeRegistrationNotFound     ErrorCode = "registration-not-found"
+	ErrorCodeRateLimited              ErrorCode = "rate-limited"
+	ErrorCodePasswordGenerationFailed ErrorCode = "password-generation-failed"
+	ErrorCodeVaultPolicyFailed        ErrorCode = "vault-policy-failed"
+	ErrorCodeVaultTokenFailed         ErrorCode = "vault-token-failed"
+	ErrorCodeVaultSecretFailed        ErrorCode = "vault-secret-failed"
+	ErrorCodeElasticUserFailed        ErrorCode = "elastic-user-failed"
+	ErrorCodeCredentialUserFailed     ErrorCode = "credential-user-failed"
+	ErrorCodeServiceUnavailable       ErrorCode = "service-unavailable"
+	ErrorCodeInternal                 ErrorCode = "internal-error"
+)
+
+func UnmarshalSolonError(data []byte) (SolonError, error) {
+	var r SolonError
+	err := json.Unmarshal(data, &r)
+	return r, err
+}
+
+func (r *SolonError) Marshal() ([]byte, error) {
+	return json.Marshal(r)
+}
+
+// swagger:model
+// SolonError is the envelope returned for every failed request
+type SolonError struct {
+	// example: 94374b4f-3dda-4ffb-b33b-2cb6ba092b84
+	// required: true
+	UniqueCode string `json:"uniqueCode"`
+	// example: annotation-mismatch
+	// required: true
+	Code ErrorCode `json:"code"`
+	// example: annotations
+	Field string `json:"field,omitempty"`
+	// example: illegal action detected: alexandros-79bbf86f4b-s48lc requested invalid annotations
+	// required: true
+	Message string `json:"message"`
+	// example: createSecret
+	FailedStep string `json:"failedStep,omitempty"`
+	// example: ["createUser"]
+	RolledBack []string `json:"rolledBack,omitempty"`
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+func UnmarshalHealthReport(data []byte) (HealthReport, error) {
+	var r HealthReport
+	err := json.Unmarshal(data, &r)
+	return r, err
+}
+
+func (r *HealthReport) Marshal() ([]byte, error) {
+	return json.Marshal(r)
+}
+
+// HealthStatus is the state of solon or of a single dependency
+type HealthStatus string
+
+const (
+	HealthStatusHealthy   HealthStatus = "healthy"
+	HealthStatusDegraded  HealthStatus = "degraded"
+	HealthStatusUnhealthy HealthStatus = "unhealthy"
+)
+
+// OverallHealth combines the status of every dependency into the status of solon:
+//   - unhealthy when a critical dependency is unhealthy, solon cannot register pods or issue tokens
+//   - degraded when a critical dependency is degraded or an optional dependency is unhealthy, requests are still served
+//   - healthy otherwise
+func OverallHealth(dependencies []DependencyHealth) HealthStatus {
+	status := HealthStatusHealthy
+	for _, dependency := range dependencies {
+		switch {
+		case dependency.Status == HealthStatusUnhealthy && dependency.Critical:
+			return HealthStatusUnhealthy
+		case dependency.Status != HealthStatusHealthy:
+			status = HealthStatusDegraded
+		}
+	}
+
+	return status
+}
+
+// Serving is true for every status in which solon still takes requests
+func (h HealthStatus) Serving() bool {
+	return h == HealthStatusHealthy || h == HealthStatusDegraded
+}
+
+// swagger:model
+// HealthReport lists the state of every dependency of solon, Status follows the rule of OverallHealth and Healthy
+// is true as long as solon is serving
+type HealthReport struct {
+	// example: true
+	// required: true
+	Healthy bool `json:"healthy"`
+	// example: degraded
+	// required: true
+	Status HealthStatus `json:"status"`
+	// example: 2024-11-02T10:15:00Z
+	// required: true
+	Time string `json:"time"`
+	// required: true
+	Dependencies []DependencyHealth `json:"dependencies"`
+}
+
+// swagger:model
+// DependencyHealth is the result of the latest check of a dependency, LastError and LastSuccess are kept between checks
+type DependencyHealth struct {
+	// example: vault
+	// required: true
+	Name string `json:"name"`
+	// example: healthy
+	// required: true
+	Status HealthStatus `json:"status"`
+	// example: true
+	// required: true
+	Critical bool `json:"critical"`
+	// example: 12
+	// required: true
+	LatencyMs int64 `json:"latencyMs"`
+	// example: vault is sealed
+	LastError string `json:"lastError,omitempty"`
+	// example: 2024-11-02T10:12:00Z
+	LastErrorAt *time.Time `json:"lastErrorAt,omitempty"`
+	// example: 2024-11-02T10:15:00Z
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+	// example: {"sealed":"false","standby":"false","leader":"true"}
+	Details map[string]string `json:"details,omitempty"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import "encoding/json"
+
+func UnmarshalReadyResponse(data []byte) (ReadyResponse, error) {
+	var r ReadyResponse
+	err := json.Unmarshal(data, &r)
+	return r, err
+}
+
+func (r *ReadyResponse) Marshal() ([]byte, error) {
+	return json.Marshal(r)
+}
+
+// swagger:model
+// ReadyResponse tells if solon can take requests, every dependency it needs is listed as a check
+type ReadyResponse struct {
+	// example: false
+	// required: true
+	Ready bool `json:"ready"`
+	// required: true
+	Checks []ReadyCheck `json:"checks"`
+}
+
+// swagger:model
+type ReadyCheck struct {
+	// example: podCache
+	// required: true
+	Name string `json:"name"`
+	// example: false
+	// required: true
+	Ready bool `json:"ready"`
+	// example: pod cache has not synced yet
+	Error string `json:"error,omitempty"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+func UnmarshalReconcileReport(data []byte) (ReconcileReport, error) {
+	var r ReconcileReport
+	err := json.Unmarshal(data, &r)
+	return r, err
+}
+
+func (r *ReconcileReport) Marshal() ([]byte, error) {
+	return json.Marshal(r)
+}
+
+// swagger:model
+// ReconcileReport describes a single sweep for resources that outlived their pod
+type ReconcileReport struct {
+	// example: 2024-11-02T10:15:00Z
+	// required: true
+	StartedAt time.Time `json:"startedAt"`
+	// example: 2024-11-02T10:15:02Z
+	// required: true
+	FinishedAt time.Time `json:"finishedAt"`
+	// example: true
+	// required: true
+	DryRun bool `json:"dryRun"`
+	// required: true
+	Orphans []Orphan `json:"orphans"`
+	// example: ["failed to list policies: permission denied"]
+	Errors []string `json:"errors,omitempty"`
+}
+
+// swagger:model
+// Orphan is a resource solon created for a pod that no longer exists
+type Orphan struct {
+	// example: vault_secret
+	// required: true
+	Resource string `json:"resource"`
+	// example: odysseia/alexandros-79bbf86f4b-s48lc
+	// required: true
+	Name string `json:"name"`
+	// example: alexandros-79bbf86f4b-s48lc
+	// required: true
+	Pod string `json:"pod"`
+	// example: odysseia
+	Namespace string `json:"namespace,omitempty"`
+	// example: false
+	// required: true
+	Removed bool `json:"removed"`
+	// example: permission denied
+	Error string `json:"error,omitempty"`
+}
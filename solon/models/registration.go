@@ -0,0 +1,95 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+func UnmarshalRegistrationList(data []byte) (RegistrationList, error) {
+	var r RegistrationList
+	err := json.Unmarshal(data, &r)
+	return r, err
+}
+
+func (r *RegistrationList) Marshal() ([]byte, error) {
+	return json.Marshal(r)
+}
+
+func UnmarshalRegistrationDetail(data []byte) (RegistrationDetail, error) {
+	var r RegistrationDetail
+	err := json.Unmarshal(data, &r)
+	return r, err
+}
+
+func (r *RegistrationDetail) Marshal() ([]byte, error) {
+	return json.Marshal(r)
+}
+
+// swagger:model
+// RegistrationList is every pod solon keeps a secret for in the namespaces it serves
+type RegistrationList struct {
+	// required: true
+	Registrations []RegistrationSummary `json:"registrations"`
+	// example: ["failed to read secret odysseia/sokrates-5d8f7c9b4-abcde: permission denied"]
+	Errors []string `json:"errors,omitempty"`
+}
+
+// swagger:model
+// RegistrationSummary is read from the vault secret of a pod, the token count comes from the audit events in elastic
+type RegistrationSummary struct {
+	// example: alexandros-79bbf86f4b-s48lc
+	// required: true
+	PodName string `json:"podName"`
+	// example: odysseia
+	// required: true
+	Namespace string `json:"namespace"`
+	// example: alexandross48lc
+	// required: true
+	Username string `json:"username"`
+	// example: ["dictionary_api"]
+	Roles []string `json:"roles,omitempty"`
+	// example: 3
+	// required: true
+	SecretVersion int `json:"secretVersion"`
+	// CreatedAt is empty for secrets written before solon kept a registration
+	// example: 2024-11-02T10:15:00Z
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+	// TokensIssued is empty when audit events are not stored in elastic
+	// example: 12
+	TokensIssued *int64 `json:"tokensIssued,omitempty"`
+}
+
+// swagger:model
+// RegistrationDetail is everything solon knows about the registration of a single pod, credentials are never included
+type RegistrationDetail struct {
+	RegistrationSummary
+	// example: 5b0e2a4c-1f7e-4a8e-9d57-2b1c6d3f8e90
+	PodUID string `json:"podUid,omitempty"`
+	// example: false
+	// required: true
+	SharedUsername bool `json:"sharedUsername"`
+	// example: policy.odysseia.alexandros-79bbf86f4b-s48lc
+	// required: true
+	Policy string `json:"policy"`
+	// Live is true while the pod is in the pod cache
+	// example: true
+	// required: true
+	Live bool `json:"live"`
+	// example: 2024-11-02T13:15:00Z
+	LeaseExpiresAt *time.Time    `json:"leaseExpiresAt,omitempty"`
+	Leases         []LeaseDetail `json:"leases,omitempty"`
+	// example: ["failed to count issued tokens: index_not_found_exception"]
+	Errors []string `json:"errors,omitempty"`
+}
+
+// swagger:model
+type LeaseDetail struct {
+	// example: alexandross48lc_1730548800
+	// required: true
+	Username string `json:"username"`
+	// example: 2024-11-02T13:15:00Z
+	// required: true
+	ExpiresAt time.Time `json:"expiresAt"`
+	// example: false
+	Revoked bool `json:"revoked,omitempty"`
+}
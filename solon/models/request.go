@@ -14,16 +14,17 @@ func (r *SolonCreationRequest) Marshal() ([]byte, error) {
 
 // swagger:model
 type SolonCreationRequest struct {
+	// Role applies to every index in Access that does not name its own role
 	// example: api
-	// required: true
-	Role string `json:"roles"`
-	// example: ["dictionary"]
+	Role string `json:"roles,omitempty"`
+	// Access lists an index or an index:role pair per entry, every pair has to be granted by the annotations of the pod
+	// example: ["dictionary","texts:seeder"]
 	// required: true
 	Access []string `json:"access"`
 	// example: alexandros-79bbf86f4b-s48lc
 	// required: true
 	PodName string `json:"podName"`
-	// example: alexandros
-	// required: true
-	Username string `json:"username"`
+	// Username is assigned by solon from the pod name, only set it when several pods share a user
+	// example: agreus
+	Username string `json:"username,omitempty"`
 }
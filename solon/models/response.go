@@ -11,4 +11,13 @@ type TokenResponse struct {
 	// example: s.0982371293fj
 	// required: true
 	Token string `json:"token"`
+	// Wrapped is true when Token is a response wrapping token, unwrapping it once returns the vault token under data.token
+	// example: false
+	Wrapped bool `json:"wrapped,omitempty"`
+	// TTL is empty when the token lives as long as vault allows by default
+	// example: 5m0s
+	TTL string `json:"ttl,omitempty"`
+	// NumUses is empty when the token is the default one time token
+	// example: 3
+	NumUses int `json:"numUses,omitempty"`
 }
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+func UnmarshalRotateRequest(data []byte) (RotateRequest, error) {
+	var r RotateRequest
+	err := json.Unmarshal(data, &r)
+	return r, err
+}
+
+func (r *RotateRequest) Marshal() ([]byte, error) {
+	return json.Marshal(r)
+}
+
+func (r *RotateResponse) Marshal() ([]byte, error) {
+	return json.Marshal(r)
+}
+
+// swagger:model
+// RotateRequest names the pod whose credentials are rotated, a pod may leave it empty to rotate its own
+type RotateRequest struct {
+	// example: alexandros-79bbf86f4b-s48lc
+	PodName string `json:"podName,omitempty"`
+	// Namespace defaults to the namespace solon runs in, only admins rotate pods other than their own
+	// example: odysseia
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// swagger:model
+// RotateResponse is returned once the new credentials are stored in vault
+type RotateResponse struct {
+	// example: alexandros-79bbf86f4b-s48lc
+	// required: true
+	PodName string `json:"podName"`
+	// example: odysseia
+	// required: true
+	Namespace string `json:"namespace"`
+	// example: alexandross48lc
+	// required: true
+	Username string `json:"username"`
+	// Version is the kv v2 version of the secret holding the new credentials
+	// example: 4
+	// required: true
+	Version int `json:"version"`
+	// example: 2024-11-03T10:15:00Z
+	LeaseExpiresAt *time.Time `json:"leaseExpiresAt,omitempty"`
+}